@@ -0,0 +1,367 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"scaler/dns_providers"
+	s "scaler/shared"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// Brings the A and AAAA records of the zone in line with the servers found by the provider, each cycle
+// Records are created for new servers and fixed when their IP is wrong, e.g. after a resize or a partial failure
+// Records carrying the description of the zone are deleted when their server is gone, other records are never changed
+type dnsReconciler struct {
+	provider   s.DNSProvider
+	recordName *template.Template
+	// Only logs the changes
+	dryRun bool
+	// Optional, nil if disabled
+	failover *dnsFailover
+	// Objects of the last reconcile, to reconcile again before a resize
+	objects []s.ScaledObject
+}
+
+func newDnsReconciler(provider s.DNSProvider, config s.DNSConfig) (*dnsReconciler, error) {
+	recordName, err := config.ParseRecordNameTemplate()
+	if err != nil {
+		return nil, err
+	}
+	reconciler := &dnsReconciler{provider: provider, recordName: recordName, dryRun: config.DryRun}
+	if config.Failover.Enabled() {
+		if reconciler.failover, err = newDnsFailover(config.Failover); err != nil {
+			return nil, err
+		}
+	}
+	return reconciler, nil
+}
+
+func initDNSProvider(t *s.DNSProviderType, configFile []byte) (*s.DNSProvider, error) {
+	switch *t {
+	case s.Otc:
+		otc, err := s.LoadConfig[dns_providers.Otc](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading otc dns config: %s", err)
+		}
+		if err := otc.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing otc dns: %s", err)
+		}
+		provider := s.DNSProvider(otc)
+		return &provider, nil
+	case s.IonosDns:
+		ionos, err := s.LoadConfig[dns_providers.IonosDns](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading ionos dns config: %s", err)
+		}
+		if err := ionos.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing ionos dns: %s", err)
+		}
+		provider := s.DNSProvider(ionos)
+		return &provider, nil
+	case s.Rfc2136:
+		rfc2136, err := s.LoadConfig[dns_providers.Rfc2136](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading rfc2136 config: %s", err)
+		}
+		if err := rfc2136.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing rfc2136: %s", err)
+		}
+		provider := s.DNSProvider(rfc2136)
+		return &provider, nil
+	}
+	return nil, fmt.Errorf("unknown dns provider type: %s", *t)
+}
+
+type dnsChangeAction string
+
+const (
+	dnsCreate dnsChangeAction = "+"
+	dnsUpdate dnsChangeAction = "~"
+	dnsDelete dnsChangeAction = "-"
+	// Changes of a single IP of the round robin record
+	dnsAddIp    dnsChangeAction = "+ip"
+	dnsRemoveIp dnsChangeAction = "-ip"
+)
+
+type dnsChange struct {
+	action     dnsChangeAction
+	name       string
+	recordType s.DNSRecordType
+	ips        []string
+	// Current IPs of an updated record
+	oldIps []string
+}
+
+// Diff line of the change, e.g. "~ bbb-1 A 10.0.0.1 -> 10.0.0.2"
+func (c dnsChange) String() string {
+	switch c.action {
+	case dnsUpdate:
+		return fmt.Sprintf("%s %s %s %s -> %s", c.action, c.name, c.recordType, strings.Join(c.oldIps, ","), strings.Join(c.ips, ","))
+	case dnsAddIp:
+		return fmt.Sprintf("%s %s %s %s", dnsCreate, c.name, c.recordType, strings.Join(c.ips, ","))
+	case dnsRemoveIp:
+		return fmt.Sprintf("%s %s %s %s", dnsDelete, c.name, c.recordType, strings.Join(c.ips, ","))
+	}
+	return fmt.Sprintf("%s %s %s %s", c.action, c.name, c.recordType, strings.Join(c.ips, ","))
+}
+
+// Identifies a record set of the zone
+type dnsRecordKey struct {
+	name       string
+	recordType s.DNSRecordType
+}
+
+// The record name of a server, lowercased and relative to the zone of the DNS provider
+func (d *dnsReconciler) recordNameOf(server *s.Server) (string, error) {
+	var name bytes.Buffer
+	if err := d.recordName.Execute(&name, server); err != nil {
+		return "", err
+	}
+	rendered := strings.ToLower(strings.TrimSpace(name.String()))
+	if rendered == "" {
+		return "", fmt.Errorf("record name of server %s is empty", server.ServerName)
+	}
+	return rendered, nil
+}
+
+// The first IP of each type
+func firstIps(server *s.Server) map[s.DNSRecordType]string {
+	first := map[s.DNSRecordType]string{}
+	for _, ip := range server.Ips {
+		recordType, err := s.DNSRecordTypeOf(ip)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Skipping IP of server %s: %s", server.ServerName, err))
+			continue
+		}
+		if _, ok := first[recordType]; !ok {
+			first[recordType] = ip
+		}
+	}
+	return first
+}
+
+// The IPs of the A and AAAA record of each server, the first IP of each type is used
+// The records of a server without IP are kept as they are, their IPs are nil
+// With failover, unhealthy servers point to the maintenance IPs and only healthy servers are in the round robin record
+func (d *dnsReconciler) desired(objects []s.ScaledObject) map[dnsRecordKey][]string {
+	servers := []*s.Server{}
+	for _, object := range objects {
+		if server, ok := object.(*s.Server); ok {
+			servers = append(servers, server)
+		}
+	}
+	healthy := map[*s.Server]bool{}
+	if d.failover != nil {
+		healthy = d.failover.check(servers)
+	}
+
+	desired := map[dnsRecordKey][]string{}
+	claimed := map[string]bool{}
+	roundRobin := map[s.DNSRecordType][]string{}
+	// Types of the IPs taken out of the round robin record
+	failed := map[s.DNSRecordType]bool{}
+	for _, server := range servers {
+		name, err := d.recordNameOf(server)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error while rendering the DNS record name of server %s: %s", server.ServerName, err))
+			continue
+		}
+		if claimed[name] {
+			slog.Warn(fmt.Sprintf("DNS record %s is claimed by several servers, keeping the first one", name))
+			continue
+		}
+		claimed[name] = true
+		if len(server.Ips) == 0 {
+			slog.Warn(fmt.Sprintf("Server %s has no IP, keeping its DNS records as they are", server.ServerName))
+			desired[dnsRecordKey{name, s.DNSRecordTypeA}] = nil
+			desired[dnsRecordKey{name, s.DNSRecordTypeAAAA}] = nil
+			continue
+		}
+		ips := firstIps(server)
+		for recordType, ip := range ips {
+			if healthy[server] {
+				roundRobin[recordType] = append(roundRobin[recordType], ip)
+			} else {
+				failed[recordType] = true
+			}
+		}
+		if !healthy[server] && d.failover != nil && len(d.failover.config.MaintenanceIps) > 0 {
+			ips = map[s.DNSRecordType]string{}
+			for _, ip := range d.failover.config.MaintenanceIps {
+				recordType, _ := s.DNSRecordTypeOf(ip)
+				desired[dnsRecordKey{name, recordType}] = append(desired[dnsRecordKey{name, recordType}], ip)
+			}
+		}
+		for recordType, ip := range ips {
+			desired[dnsRecordKey{name, recordType}] = []string{ip}
+		}
+	}
+
+	if d.failover == nil || d.failover.config.RoundRobinRecord == "" {
+		return desired
+	}
+	name := strings.ToLower(d.failover.config.RoundRobinRecord)
+	if claimed[name] {
+		slog.Error(fmt.Sprintf("DNS record %s is the record of a server, skipping the round robin record", name))
+		return desired
+	}
+	for _, recordType := range []s.DNSRecordType{s.DNSRecordTypeA, s.DNSRecordTypeAAAA} {
+		ips := roundRobin[recordType]
+		if len(ips) == 0 && failed[recordType] {
+			// Better some unhealthy servers than none at all
+			slog.Warn(fmt.Sprintf("No healthy server for DNS record %s %s, keeping it as it is", name, recordType))
+			desired[dnsRecordKey{name, recordType}] = nil
+			continue
+		}
+		if len(ips) > 0 {
+			slices.Sort(ips)
+			desired[dnsRecordKey{name, recordType}] = ips
+		}
+	}
+	return desired
+}
+
+func sameIps(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// Compares the desired records with the zone contents, the changes are sorted by name and type
+func (d *dnsReconciler) diff(objects []s.ScaledObject) ([]dnsChange, error) {
+	records, err := d.provider.ListRecords()
+	if err != nil {
+		return nil, fmt.Errorf("error while listing dns records: %s", err)
+	}
+	existing := map[dnsRecordKey]s.DNSRecord{}
+	for _, record := range records {
+		existing[dnsRecordKey{strings.ToLower(record.Name), record.Type}] = record
+	}
+	desired := d.desired(objects)
+
+	changes := []dnsChange{}
+	for key, ips := range desired {
+		record, ok := existing[key]
+		switch {
+		case ips == nil:
+		case ok && record.Managed && d.isRoundRobin(key):
+			changes = append(changes, d.roundRobinChanges(key, record.Ips, ips)...)
+		case !ok:
+			changes = append(changes, dnsChange{action: dnsCreate, name: key.name, recordType: key.recordType, ips: ips})
+		case sameIps(record.Ips, ips):
+		case !record.Managed:
+			slog.Warn(fmt.Sprintf("DNS record %s %s points to %v instead of %v but is not managed by the autoscaler, skipping it", key.name, key.recordType, record.Ips, ips))
+		default:
+			changes = append(changes, dnsChange{action: dnsUpdate, name: key.name, recordType: key.recordType, ips: ips, oldIps: record.Ips})
+		}
+	}
+	for key, record := range existing {
+		if _, ok := desired[key]; !ok && record.Managed {
+			changes = append(changes, dnsChange{action: dnsDelete, name: record.Name, recordType: record.Type, ips: record.Ips})
+		}
+	}
+	// Keeps the IPs added to the round robin record before the removed ones
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].name != changes[j].name {
+			return changes[i].name < changes[j].name
+		}
+		return changes[i].recordType < changes[j].recordType
+	})
+	return changes, nil
+}
+
+func (d *dnsReconciler) isRoundRobin(key dnsRecordKey) bool {
+	return d.failover != nil && key.name == strings.ToLower(d.failover.config.RoundRobinRecord)
+}
+
+// Adds and removes single IPs, the record keeps serving the other IPs
+func (d *dnsReconciler) roundRobinChanges(key dnsRecordKey, current []string, ips []string) []dnsChange {
+	changes := []dnsChange{}
+	for _, ip := range ips {
+		if !slices.Contains(current, ip) {
+			changes = append(changes, dnsChange{action: dnsAddIp, name: key.name, recordType: key.recordType, ips: []string{ip}})
+		}
+	}
+	for _, ip := range current {
+		if !slices.Contains(ips, ip) {
+			changes = append(changes, dnsChange{action: dnsRemoveIp, name: key.name, recordType: key.recordType, ips: []string{ip}})
+		}
+	}
+	return changes
+}
+
+func (d *dnsReconciler) apply(change dnsChange) error {
+	switch change.action {
+	case dnsCreate:
+		return d.provider.CreateRecord(change.name, change.recordType, change.ips)
+	case dnsUpdate:
+		return d.provider.UpdateRecord(change.name, change.recordType, change.ips)
+	case dnsDelete:
+		return d.provider.DeleteRecord(change.name, change.recordType)
+	case dnsAddIp:
+		return d.provider.AddRecordIp(change.name, change.recordType, change.ips[0])
+	case dnsRemoveIp:
+		return d.provider.RemoveRecordIp(change.name, change.recordType, change.ips[0])
+	}
+	return fmt.Errorf("unknown dns change: %s", change.action)
+}
+
+// Takes a server out of DNS before it is resized, like an unhealthy server
+// The next reconcile restores its records once it is ready and its health check succeeds
+func (d *dnsReconciler) beforeResize(object s.ScaledObject) {
+	server, ok := object.(*s.Server)
+	if !ok || d.failover == nil {
+		return
+	}
+	d.failover.resizing[server.ServerName] = true
+	defer delete(d.failover.resizing, server.ServerName)
+	d.reconcile(d.objects)
+}
+
+// Applies the diff, a failed change is retried in the next cycle
+func (d *dnsReconciler) reconcile(objects []s.ScaledObject) {
+	d.objects = objects
+	changes, err := d.diff(objects)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	for _, change := range changes {
+		if d.dryRun {
+			slog.Info(fmt.Sprintf("DNS dry run, skipping change: %s", change))
+			continue
+		}
+		slog.Info(fmt.Sprintf("Applying DNS change: %s", change))
+		if err := d.apply(change); err != nil {
+			slog.Error(fmt.Sprintf("Error while applying DNS change %s: %s", change, err))
+		}
+	}
+}
+
+// Writes the changes the next cycle would apply, one line per change
+func (sc *ScalerApp) WriteDNSDiff(w io.Writer) error {
+	if sc.dns == nil {
+		return fmt.Errorf("no dns provider configured")
+	}
+	scaledObjects, err := sc.provider.GetScaledObjects()
+	if err != nil {
+		return fmt.Errorf("error while getting scaled objects: %s", err)
+	}
+	changes, err := sc.dns.diff(scaledObjects)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if _, err := fmt.Fprintln(w, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
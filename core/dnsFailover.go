@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	s "scaler/shared"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const defaultDNSHealthCheckTimeoutSeconds = 5
+
+// Decides which servers are taken out of DNS
+// A server is healthy while it is ready and its health check, if configured, succeeds
+type dnsFailover struct {
+	config         s.DNSFailoverConfig
+	healthCheckUrl *template.Template
+	httpClient     *http.Client
+	// Names of the servers found unhealthy in the previous cycle, to log the changes only
+	unhealthy map[string]bool
+	// Names of the servers about to be resized, unhealthy without probing them
+	resizing map[string]bool
+}
+
+func newDnsFailover(config s.DNSFailoverConfig) (*dnsFailover, error) {
+	healthCheckUrl, err := config.ParseHealthCheckUrlTemplate()
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.HealthCheckTimeoutSeconds
+	if timeout == 0 {
+		timeout = defaultDNSHealthCheckTimeoutSeconds
+	}
+	return &dnsFailover{
+		config:         config,
+		healthCheckUrl: healthCheckUrl,
+		httpClient:     &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		unhealthy:      map[string]bool{},
+		resizing:       map[string]bool{},
+	}, nil
+}
+
+func (f *dnsFailover) probe(server *s.Server) error {
+	if !server.IsReady() {
+		return fmt.Errorf("server is not ready")
+	}
+	if f.healthCheckUrl == nil {
+		return nil
+	}
+	data := s.DNSHealthCheckData{Server: *server}
+	if len(server.Ips) > 0 {
+		data.Ip = server.Ips[0]
+	}
+	var url bytes.Buffer
+	if err := f.healthCheckUrl.Execute(&url, data); err != nil {
+		return fmt.Errorf("error while rendering the health check url: %s", err)
+	}
+	response, err := f.httpClient.Get(url.String())
+	if err != nil {
+		return fmt.Errorf("health check failed: %s", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("health check returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Probes the servers concurrently and returns the healthy ones
+func (f *dnsFailover) check(servers []*s.Server) map[*s.Server]bool {
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server *s.Server) {
+			defer wg.Done()
+			if f.resizing[server.ServerName] {
+				errs[i] = fmt.Errorf("server is about to be resized")
+				return
+			}
+			errs[i] = f.probe(server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	healthy := map[*s.Server]bool{}
+	unhealthy := map[string]bool{}
+	for i, server := range servers {
+		if errs[i] == nil {
+			healthy[server] = true
+			if f.unhealthy[server.ServerName] {
+				slog.Info(fmt.Sprintf("Server %s is healthy again, restoring its DNS records", server.ServerName))
+			}
+			continue
+		}
+		unhealthy[server.ServerName] = true
+		if !f.unhealthy[server.ServerName] {
+			slog.Warn(fmt.Sprintf("Server %s is unhealthy, taking it out of DNS: %s", server.ServerName, errs[i]))
+		}
+	}
+	f.unhealthy = unhealthy
+	return healthy
+}
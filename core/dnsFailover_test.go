@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Health check endpoint failing for the servers in unhealthy
+type fakeHealthCheck struct {
+	mutex     sync.Mutex
+	unhealthy map[string]bool
+}
+
+func (f *fakeHealthCheck) set(server string, unhealthy bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.unhealthy[server] = unhealthy
+}
+
+func newFakeHealthCheck(t *testing.T) (*fakeHealthCheck, string) {
+	health := &fakeHealthCheck{unhealthy: map[string]bool{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health.mutex.Lock()
+		defer health.mutex.Unlock()
+		if r.URL.Query().Get("ip") == "" || health.unhealthy[r.URL.Query().Get("server")] {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return health, server.URL + "/health?server={{ .ServerName }}&ip={{ .Ip }}"
+}
+
+func expectDnsDiff(t *testing.T, dns *dnsReconciler, objects []s.ScaledObject, expected string) {
+	t.Helper()
+	changes, err := dns.diff(objects)
+	if err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	if fmt.Sprint(changes) != expected {
+		t.Fatalf("Expected diff %s but got %v", expected, changes)
+	}
+}
+
+func TestDnsFailoverRoundRobin(t *testing.T) {
+	health, url := newFakeHealthCheck(t)
+	provider := &fakeDNSProvider{records: map[string]s.DNSRecord{
+		"bbb A":   managedRecord("bbb", s.DNSRecordTypeA, "10.0.0.1", "10.0.0.3"),
+		"bbb-1 A": managedRecord("bbb-1", s.DNSRecordTypeA, "10.0.0.1"),
+		"bbb-2 A": managedRecord("bbb-2", s.DNSRecordTypeA, "10.0.0.2"),
+		"bbb-3 A": managedRecord("bbb-3", s.DNSRecordTypeA, "10.0.0.3"),
+	}}
+	dns, err := newDnsReconciler(provider, s.DNSConfig{Failover: s.DNSFailoverConfig{RoundRobinRecord: "BBB", HealthCheckUrlTemplate: url}})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	bbb1 := &s.Server{ServerName: "bbb-1", Ips: []string{"10.0.0.1"}, Ready: true}
+	bbb2 := &s.Server{ServerName: "bbb-2", Ips: []string{"10.0.0.2", "fd00::2"}, Ready: true}
+	bbb3 := &s.Server{ServerName: "bbb-3", Ips: []string{"10.0.0.3"}}
+	objects := []s.ScaledObject{bbb1, bbb2, bbb3}
+
+	// bbb-2 is healthy again and bbb-3 is resizing, the records of the servers are kept
+	expectDnsDiff(t, dns, objects, "[+ bbb A 10.0.0.2 - bbb A 10.0.0.3 + bbb AAAA fd00::2 + bbb-2 AAAA fd00::2]")
+	dns.reconcile(objects)
+	if record := provider.records["bbb A"]; fmt.Sprint(record.Ips) != "[10.0.0.1 10.0.0.2]" {
+		t.Fatalf("Expected the round robin record with the healthy servers but got %v", record.Ips)
+	}
+
+	// The health check of bbb-1 fails
+	health.set("bbb-1", true)
+	bbb3.Ready = true
+	expectDnsDiff(t, dns, objects, "[+ bbb A 10.0.0.3 - bbb A 10.0.0.1]")
+
+	// The record is kept without healthy server
+	health.set("bbb-2", true)
+	health.set("bbb-3", true)
+	expectDnsDiff(t, dns, objects, "[]")
+
+	// The record is deleted without servers
+	expectDnsDiff(t, dns, []s.ScaledObject{}, "[- bbb A 10.0.0.1,10.0.0.2 - bbb AAAA fd00::2 - bbb-1 A 10.0.0.1 - bbb-2 A 10.0.0.2 - bbb-2 AAAA fd00::2 - bbb-3 A 10.0.0.3]")
+}
+
+func TestDnsFailoverMaintenance(t *testing.T) {
+	provider := &fakeDNSProvider{records: map[string]s.DNSRecord{
+		"bbb-1 A": managedRecord("bbb-1", s.DNSRecordTypeA, "10.0.0.1"),
+		"bbb-2 A": managedRecord("bbb-2", s.DNSRecordTypeA, "10.0.0.2"),
+	}}
+	dns, err := newDnsReconciler(provider, s.DNSConfig{Failover: s.DNSFailoverConfig{MaintenanceIps: []string{"10.0.0.250", "fd00::250"}}})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	bbb1 := &s.Server{ServerName: "bbb-1", Ips: []string{"10.0.0.1"}, Ready: true}
+	bbb2 := &s.Server{ServerName: "bbb-2", Ips: []string{"10.0.0.2"}}
+	objects := []s.ScaledObject{bbb1, bbb2}
+
+	// bbb-2 is resizing
+	expectDnsDiff(t, dns, objects, "[~ bbb-2 A 10.0.0.2 -> 10.0.0.250 + bbb-2 AAAA fd00::250]")
+	dns.reconcile(objects)
+
+	// The original record is restored once bbb-2 is ready
+	bbb2.Ready = true
+	expectDnsDiff(t, dns, objects, "[~ bbb-2 A 10.0.0.250 -> 10.0.0.2 - bbb-2 AAAA fd00::250]")
+	dns.reconcile(objects)
+	expected := map[string][]string{"bbb-1 A": {"10.0.0.1"}, "bbb-2 A": {"10.0.0.2"}}
+	if fmt.Sprint(provider.ips()) != fmt.Sprint(expected) {
+		t.Errorf("Expected records %v but got %v", expected, provider.ips())
+	}
+}
+
+// Service proposing the same resize for every object
+type fakeService struct {
+	proposal s.ResourceScalingProposal
+}
+
+func (f fakeService) Validate() error {
+	return nil
+}
+
+func (f fakeService) Init() error {
+	return nil
+}
+
+func (f fakeService) GetResources() s.Resources {
+	return s.Resources{}
+}
+
+func (f fakeService) GetCycleTimeSeconds() int {
+	return 60
+}
+
+func (f fakeService) ComputeScalingProposal(object s.ScaledObject) (s.ResourceScalingProposal, error) {
+	return f.proposal, nil
+}
+
+func TestDnsFailoverResize(t *testing.T) {
+	_, url := newFakeHealthCheck(t)
+	provider := &fakeDNSProvider{records: map[string]s.DNSRecord{
+		"bbb A":   managedRecord("bbb", s.DNSRecordTypeA, "10.0.0.1", "10.0.0.2"),
+		"bbb-1 A": managedRecord("bbb-1", s.DNSRecordTypeA, "10.0.0.1"),
+		"bbb-2 A": managedRecord("bbb-2", s.DNSRecordTypeA, "10.0.0.2"),
+	}}
+	dns, err := newDnsReconciler(provider, s.DNSConfig{Failover: s.DNSFailoverConfig{RoundRobinRecord: "bbb", HealthCheckUrlTemplate: url}})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	bbb1 := &s.Server{ServerName: "bbb-1", Ips: []string{"10.0.0.1"}, Ready: true, ResourceState: s.ResourceState{Cpu: &s.CpuResourceState{}, Memory: &s.MemoryResourceState{}}}
+	bbb2 := &s.Server{ServerName: "bbb-2", Ips: []string{"10.0.0.2"}, Ready: true}
+	objects := []s.ScaledObject{bbb1, bbb2}
+	dns.reconcile(objects)
+
+	lastScaleTimeGauge = prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_last_scale_time"})
+	// The round robin record at the time of the update
+	var resizedIps []string
+	scaler := ScalerApp{
+		appDefinition: &s.AppDefinition{ScalingMode: s.HeuristicScaling},
+		service:       fakeService{proposal: s.ResourceScalingProposal{Cpu: s.ScaleOp{Direction: s.ScaleNone}, Mem: s.ScaleOp{Direction: s.ScaleNone}}},
+		provider: &fakeProvider{objects: objects, updated: func(object s.ScaledObject, proposal s.ResourceScalingProposal) {
+			resizedIps = provider.records["bbb A"].Ips
+		}},
+		metricsSource: fakeMetricsSource{usage: 0.9},
+		dns:           dns,
+	}
+	if err := scaler.scaleObject(bbb1); err != nil {
+		t.Fatalf("Failed to scale: %v", err)
+	}
+	if fmt.Sprint(resizedIps) != "[10.0.0.1 10.0.0.2]" {
+		t.Fatalf("Expected the round robin record to be kept without resize but got %v", resizedIps)
+	}
+
+	// bbb-1 is taken out before its resize
+	scaler.service = fakeService{proposal: s.ResourceScalingProposal{Cpu: s.ScaleOp{Direction: s.ScaleUp, Amount: 2}, Mem: s.ScaleOp{Direction: s.ScaleNone}}}
+	if err := scaler.scaleObject(bbb1); err != nil {
+		t.Fatalf("Failed to scale: %v", err)
+	}
+	if fmt.Sprint(resizedIps) != "[10.0.0.2]" {
+		t.Fatalf("Expected bbb-1 out of the round robin record during its resize but got %v", resizedIps)
+	}
+
+	// bbb-1 reboots and is restored once it is ready again
+	bbb1.Ready = false
+	dns.reconcile(objects)
+	if record := provider.records["bbb A"]; fmt.Sprint(record.Ips) != "[10.0.0.2]" {
+		t.Fatalf("Expected bbb-1 out of the round robin record while it reboots but got %v", record.Ips)
+	}
+	bbb1.Ready = true
+	dns.reconcile(objects)
+	if record := provider.records["bbb A"]; !sameIps(record.Ips, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Fatalf("Expected bbb-1 back in the round robin record but got %v", record.Ips)
+	}
+}
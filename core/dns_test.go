@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	s "scaler/shared"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// DNS provider keeping the records in memory and counting the changes
+type fakeDNSProvider struct {
+	records map[string]s.DNSRecord
+	changes int
+	fail    bool
+}
+
+func fakeDNSKey(name string, recordType s.DNSRecordType) string {
+	return name + " " + string(recordType)
+}
+
+func (f *fakeDNSProvider) Validate() error {
+	return nil
+}
+
+func (f *fakeDNSProvider) Init() error {
+	return nil
+}
+
+func (f *fakeDNSProvider) ListRecords() ([]s.DNSRecord, error) {
+	if f.fail {
+		return nil, fmt.Errorf("dns api unavailable")
+	}
+	records := []s.DNSRecord{}
+	for _, record := range f.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (f *fakeDNSProvider) GetRecord(name string, recordType s.DNSRecordType) (*s.DNSRecord, error) {
+	record, ok := f.records[fakeDNSKey(name, recordType)]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (f *fakeDNSProvider) CreateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	f.records[fakeDNSKey(name, recordType)] = s.DNSRecord{Name: name, Type: recordType, Ips: ips, Description: s.DNSRecordDescription, Managed: true}
+	f.changes++
+	return nil
+}
+
+func (f *fakeDNSProvider) UpdateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	record := f.records[fakeDNSKey(name, recordType)]
+	record.Ips = ips
+	f.records[fakeDNSKey(name, recordType)] = record
+	f.changes++
+	return nil
+}
+
+func (f *fakeDNSProvider) DeleteRecord(name string, recordType s.DNSRecordType) error {
+	delete(f.records, fakeDNSKey(name, recordType))
+	f.changes++
+	return nil
+}
+
+func (f *fakeDNSProvider) AddRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	record, ok := f.records[fakeDNSKey(name, recordType)]
+	if !ok {
+		return f.CreateRecord(name, recordType, []string{ip})
+	}
+	if slices.Contains(record.Ips, ip) {
+		return nil
+	}
+	return f.UpdateRecord(name, recordType, append(slices.Clone(record.Ips), ip))
+}
+
+func (f *fakeDNSProvider) RemoveRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	record, ok := f.records[fakeDNSKey(name, recordType)]
+	if !ok || !slices.Contains(record.Ips, ip) {
+		return nil
+	}
+	remaining := slices.DeleteFunc(slices.Clone(record.Ips), func(existing string) bool { return existing == ip })
+	if len(remaining) == 0 {
+		return f.DeleteRecord(name, recordType)
+	}
+	return f.UpdateRecord(name, recordType, remaining)
+}
+
+func (f *fakeDNSProvider) ips() map[string][]string {
+	ips := map[string][]string{}
+	for key, record := range f.records {
+		ips[key] = record.Ips
+	}
+	return ips
+}
+
+func managedRecord(name string, recordType s.DNSRecordType, ips ...string) s.DNSRecord {
+	return s.DNSRecord{Name: name, Type: recordType, Ips: ips, Description: s.DNSRecordDescription, Managed: true}
+}
+
+func TestDnsReconciler(t *testing.T) {
+	provider := &fakeDNSProvider{records: map[string]s.DNSRecord{
+		"bbb-2 A":    managedRecord("bbb-2", s.DNSRecordTypeA, "10.0.0.99", "10.0.0.2"),
+		"bbb-3 A":    managedRecord("bbb-3", s.DNSRecordTypeA, "10.0.0.3"),
+		"bbb-9 A":    managedRecord("bbb-9", s.DNSRecordTypeA, "10.0.0.9"),
+		"bbb-2 AAAA": managedRecord("bbb-2", s.DNSRecordTypeAAAA, "fd00::2"),
+		"www A":      {Name: "www", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.80"}},
+		"bbb-4 A":    {Name: "bbb-4", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.98"}},
+	}}
+	dns, err := newDnsReconciler(provider, s.DNSConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	bbb1 := &s.Server{ServerName: "BBB-1", Ips: []string{"10.0.0.1", "192.168.0.1", "fd00::1"}}
+	bbb2 := &s.Server{ServerName: "bbb-2", Ips: []string{"10.0.0.2"}}
+	noIp := &s.Server{ServerName: "bbb-3"}
+	untagged := &s.Server{ServerName: "bbb-4", Ips: []string{"10.0.0.4"}}
+	cluster := &s.Cluster{ClusterName: "pg-1"}
+	objects := []s.ScaledObject{bbb1, bbb2, noIp, untagged, cluster}
+
+	// The missing records are created, the wrong IPs fixed and the orphans removed
+	// Records without the description and records of servers without IP are kept
+	changes, err := dns.diff(objects)
+	if err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	expected := "[+ bbb-1 A 10.0.0.1 + bbb-1 AAAA fd00::1 ~ bbb-2 A 10.0.0.99,10.0.0.2 -> 10.0.0.2 - bbb-2 AAAA fd00::2 - bbb-9 A 10.0.0.9]"
+	if fmt.Sprint(changes) != expected {
+		t.Fatalf("Expected diff %s but got %v", expected, changes)
+	}
+
+	// A dry run changes nothing
+	dns.dryRun = true
+	dns.reconcile(objects)
+	if provider.changes != 0 {
+		t.Fatalf("Expected no change in a dry run but got %d", provider.changes)
+	}
+
+	dns.dryRun = false
+	dns.reconcile(objects)
+	expectedIps := map[string][]string{"bbb-1 A": {"10.0.0.1"}, "bbb-1 AAAA": {"fd00::1"}, "bbb-2 A": {"10.0.0.2"}, "bbb-3 A": {"10.0.0.3"}, "bbb-4 A": {"10.0.0.98"}, "www A": {"10.0.0.80"}}
+	if fmt.Sprint(provider.ips()) != fmt.Sprint(expectedIps) || provider.changes != 5 {
+		t.Fatalf("Expected records %v after 5 changes but got %v after %d", expectedIps, provider.ips(), provider.changes)
+	}
+	if changes, err := dns.diff(objects); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes but got %v, %v", changes, err)
+	}
+
+	// Nothing is changed without the zone contents
+	provider.fail = true
+	dns.reconcile([]s.ScaledObject{})
+	provider.fail = false
+	if provider.changes != 5 {
+		t.Errorf("Expected no change but got %d", provider.changes-5)
+	}
+}
+
+func TestDnsReconcilerRecordNameTemplate(t *testing.T) {
+	provider := &fakeDNSProvider{records: map[string]s.DNSRecord{}}
+	if _, err := newDnsReconciler(provider, s.DNSConfig{RecordNameTemplate: "{{ .Unknown }}"}); err == nil {
+		t.Errorf("Expected error for an unknown field")
+	}
+	dns, err := newDnsReconciler(provider, s.DNSConfig{RecordNameTemplate: "{{ .ServerName }}.{{ .DatacenterId }}"})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	dns.reconcile([]s.ScaledObject{&s.Server{ServerName: "bbb-1", DatacenterId: "FRA", Ips: []string{"10.0.0.1"}}})
+	if _, ok := provider.records["bbb-1.fra A"]; !ok {
+		t.Errorf("Expected record bbb-1.fra but got %v", provider.records)
+	}
+}
+
+func TestWriteDNSDiff(t *testing.T) {
+	dns, _ := newDnsReconciler(&fakeDNSProvider{records: map[string]s.DNSRecord{}}, s.DNSConfig{})
+	app := &ScalerApp{dns: dns, provider: &fakeProvider{objects: []s.ScaledObject{&s.Server{ServerName: "bbb-1", Ips: []string{"10.0.0.1"}}}}}
+	var out bytes.Buffer
+	if err := app.WriteDNSDiff(&out); err != nil {
+		t.Fatalf("Failed to write diff: %v", err)
+	}
+	if out.String() != "+ bbb-1 A 10.0.0.1\n" {
+		t.Errorf("Unexpected diff %q", out.String())
+	}
+}
+
+// Provider returning a fixed list of objects
+type fakeProvider struct {
+	objects []s.ScaledObject
+	// Called on each update, if set
+	updated func(s.ScaledObject, s.ResourceScalingProposal)
+}
+
+func (f *fakeProvider) Validate() error {
+	return nil
+}
+
+func (f *fakeProvider) GetScaledObjects() ([]s.ScaledObject, error) {
+	return f.objects, nil
+}
+
+func (f *fakeProvider) UpdateScaledObject(scaledObject s.ScaledObject, targetRes s.ResourceScalingProposal) error {
+	if f.updated != nil {
+		f.updated(scaledObject, targetRes)
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ var (
 	instancesGauge          *prometheus.GaugeVec
 	maxScaledInstancesGauge *prometheus.GaugeVec
 	lastScaleTimeGauge      prometheus.Gauge
+	// Records which metrics source answered each reading
+	metricsSourceReadingsCounter *prometheus.CounterVec
 )
 
 func initMetricsExporter() error {
@@ -48,7 +50,11 @@ func initMetricsExporter() error {
 		Name: "autoscaler_last_scale_time",
 		Help: "The time of the last scale operation",
 	})
-	metrics := []prometheus.Collector{cyclesCounter, cycleTimeGauge, capacityTotalGauge, capacityUsedGauge, instancesGauge, maxScaledInstancesGauge, lastScaleTimeGauge}
+	metricsSourceReadingsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscaler_metrics_source_readings_total",
+		Help: "The total number of usage readings answered by a metrics source",
+	}, []string{"object", "resource_type", "source"})
+	metrics := []prometheus.Collector{cyclesCounter, cycleTimeGauge, capacityTotalGauge, capacityUsedGauge, instancesGauge, maxScaledInstancesGauge, lastScaleTimeGauge, metricsSourceReadingsCounter}
 	for _, metric := range metrics {
 		if err := prometheus.Register(metric); err != nil {
 			return err
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	s "scaler/shared"
+	"strings"
+
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+type routedMetricsSource struct {
+	definition s.MetricsSourceDefinition
+	source     s.MetricsSource
+}
+
+// Reads the metrics of an object from the first of its routed sources that answers
+type metricsRouter struct {
+	sources []routedMetricsSource
+}
+
+func initMetricsRouter(definitions []s.MetricsSourceDefinition) (*s.MetricsSource, error) {
+	router := metricsRouter{}
+	for _, definition := range definitions {
+		// The source config is loaded the same way as a top level config
+		configFile, err := yaml.Marshal(definition.Config)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading config of metrics source %s: %s", definition.Name, err)
+		}
+		source, err := initMetricsSource(&definition.Type, configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while initializing metrics source %s: %s", definition.Name, err)
+		}
+		router.sources = append(router.sources, routedMetricsSource{definition: definition, source: *source})
+	}
+	metrics := s.MetricsSource(router)
+	return &metrics, nil
+}
+
+func (r metricsRouter) Validate() error {
+	for _, routed := range r.sources {
+		if err := routed.source.Validate(); err != nil {
+			return fmt.Errorf("metrics source %s is invalid: %s", routed.definition.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r metricsRouter) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	return r.read(object, "cpu", s.MetricsSource.GetCpuUsage)
+}
+
+func (r metricsRouter) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	return r.read(object, "memory", s.MetricsSource.GetMemoryUsage)
+}
+
+// Tries the sources in order, falling back to the next one on error
+func (r metricsRouter) read(object s.ScaledObject, resource string, get func(s.MetricsSource, s.ScaledObject) (float32, error)) (float32, error) {
+	failures := []string{}
+	allInvalid := true
+	for _, routed := range r.sources {
+		if !routed.definition.Matches(object) {
+			continue
+		}
+		value, err := get(routed.source, object)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Error while reading %s usage for %s %s from %s: %s\n", resource, object.GetType(), object.GetName(), routed.definition.Name, err))
+			failures = append(failures, fmt.Sprintf("%s: %s", routed.definition.Name, err))
+			var invalidReading *s.InvalidReadingError
+			allInvalid = allInvalid && errors.As(err, &invalidReading)
+			continue
+		}
+		slog.Info(fmt.Sprintf("Read %s usage for %s %s from %s\n", resource, object.GetType(), object.GetName(), routed.definition.Name))
+		if metricsSourceReadingsCounter != nil {
+			metricsSourceReadingsCounter.WithLabelValues(object.GetName(), resource, routed.definition.Name).Inc()
+		}
+		return value, nil
+	}
+	if len(failures) == 0 {
+		return 0, fmt.Errorf("no metrics source is routed to %s %s", object.GetType(), object.GetName())
+	}
+	if allInvalid {
+		return 0, &s.InvalidReadingError{Reason: fmt.Sprintf("all metrics sources returned invalid readings: %s", strings.Join(failures, ", "))}
+	}
+	return 0, fmt.Errorf("all metrics sources failed: %s", strings.Join(failures, ", "))
+}
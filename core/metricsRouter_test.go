@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	s "scaler/shared"
+	"testing"
+)
+
+type fakeMetricsSource struct {
+	usage float32
+	err   error
+}
+
+func (f fakeMetricsSource) Validate() error {
+	return nil
+}
+
+func (f fakeMetricsSource) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	return f.usage, f.err
+}
+
+func (f fakeMetricsSource) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	return f.usage, f.err
+}
+
+func TestMetricsRouterFallback(t *testing.T) {
+	router := metricsRouter{sources: []routedMetricsSource{
+		{s.MetricsSourceDefinition{Name: "telemetry", ObjectType: s.ClusterType}, fakeMetricsSource{usage: 0.1}},
+		{s.MetricsSourceDefinition{Name: "primary"}, fakeMetricsSource{err: fmt.Errorf("no data found")}},
+		{s.MetricsSourceDefinition{Name: "secondary"}, fakeMetricsSource{usage: 0.5}},
+	}}
+
+	usage, err := router.GetCpuUsage(&s.Cluster{ClusterName: "pg-1"})
+	if err != nil || usage != 0.1 {
+		t.Fatalf("Expected 0.1 from telemetry but got %f, %v", usage, err)
+	}
+	usage, err = router.GetMemoryUsage(&s.Server{ServerName: "bbb-1"})
+	if err != nil || usage != 0.5 {
+		t.Fatalf("Expected 0.5 from secondary but got %f, %v", usage, err)
+	}
+
+	router.sources = router.sources[:2]
+	if _, err := router.GetCpuUsage(&s.Server{ServerName: "bbb-1"}); err == nil {
+		t.Fatalf("Expected error when all sources fail")
+	}
+	router.sources = router.sources[:1]
+	if _, err := router.GetCpuUsage(&s.Server{ServerName: "bbb-1"}); err == nil {
+		t.Fatalf("Expected error when no source is routed")
+	}
+}
+
+func TestMetricsRouterInvalidReadings(t *testing.T) {
+	router := metricsRouter{sources: []routedMetricsSource{
+		{s.MetricsSourceDefinition{Name: "primary"}, fakeMetricsSource{err: &s.InvalidReadingError{Reason: "stale"}}},
+		{s.MetricsSourceDefinition{Name: "secondary"}, fakeMetricsSource{err: &s.InvalidReadingError{Reason: "NaN"}}},
+	}}
+	_, err := router.GetCpuUsage(&s.Server{ServerName: "bbb-1"})
+	var invalidReading *s.InvalidReadingError
+	if !errors.As(err, &invalidReading) {
+		t.Fatalf("Expected an invalid reading error but got %v", err)
+	}
+
+	router.sources[1].source = fakeMetricsSource{err: fmt.Errorf("connection refused")}
+	_, err = router.GetCpuUsage(&s.Server{ServerName: "bbb-1"})
+	if err == nil || errors.As(err, &invalidReading) {
+		t.Fatalf("Expected a plain error but got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"scaler/metricssource"
 	"scaler/providers"
@@ -16,14 +17,10 @@ type ScalerApp struct {
 	service       s.Service
 	provider      s.Provider
 	metricsSource s.MetricsSource
+	// Optional, keeps the DNS records of the servers up to date
+	dns *dnsReconciler
 }
 
-// TODO: make these configurable
-var memIncrease int32 = 1024
-var memDecrease int32 = -1024
-var cpuIncrease int32 = 1
-var cpuDecrease int32 = -1
-
 func InitApp(configPath string) (*ScalerApp, error) {
 	configFile, err := s.OpenConfig(configPath)
 	if err != nil {
@@ -48,11 +45,28 @@ func InitApp(configPath string) (*ScalerApp, error) {
 		return nil, fmt.Errorf("error while initializing provider: %s", err)
 	}
 
-	metricsSource, err := initMetricsSource(&app.MetricsSourceType, configFile)
+	var metricsSource *s.MetricsSource
+	if len(app.MetricsSources) > 0 {
+		metricsSource, err = initMetricsRouter(app.MetricsSources)
+	} else {
+		metricsSource, err = initMetricsSource(&app.MetricsSourceType, configFile)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error while initializing metrics: %s", err)
 	}
 
+	var dns *dnsReconciler
+	if app.DNSProviderType != "" {
+		dnsProvider, err := initDNSProvider(&app.DNSProviderType, configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while initializing dns provider: %s", err)
+		}
+		dns, err = newDnsReconciler(*dnsProvider, app.DNSConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error while initializing dns reconciler: %s", err)
+		}
+	}
+
 	initMetricsExporter()
 	cycleTimeGauge.Set(float64((*service).GetCycleTimeSeconds()))
 
@@ -61,6 +75,7 @@ func InitApp(configPath string) (*ScalerApp, error) {
 		service:       *service,
 		provider:      *provider,
 		metricsSource: *metricsSource,
+		dns:           dns,
 	}, nil
 }
 
@@ -82,8 +97,45 @@ func initService(t *s.ServiceType, configFile []byte) (*s.Service, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error while loading postgres config: %s", err)
 		}
+		init_err := postgres.Init()
+		if init_err != nil {
+			return nil, fmt.Errorf("error while initializing postgres: %s", init_err)
+		}
 		service := s.Service(postgres)
 		return &service, nil
+	case s.Redis:
+		redis, err := s.LoadConfig[services.RedisService](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading redis config: %s", err)
+		}
+		init_err := redis.Init()
+		if init_err != nil {
+			return nil, fmt.Errorf("error while initializing redis: %s", init_err)
+		}
+		service := s.Service(redis)
+		return &service, nil
+	case s.Jitsi:
+		jitsi, err := s.LoadConfig[services.JitsiService](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading jitsi config: %s", err)
+		}
+		init_err := jitsi.Init()
+		if init_err != nil {
+			return nil, fmt.Errorf("error while initializing jitsi: %s", init_err)
+		}
+		service := s.Service(jitsi)
+		return &service, nil
+	case s.Generic:
+		generic, err := s.LoadConfig[services.GenericService](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading generic config: %s", err)
+		}
+		init_err := generic.Init()
+		if init_err != nil {
+			return nil, fmt.Errorf("error while initializing generic: %s", init_err)
+		}
+		service := s.Service(generic)
+		return &service, nil
 	}
 	return nil, fmt.Errorf("unknown service type: %s", *t)
 }
@@ -119,6 +171,56 @@ func initMetricsSource(t *s.MetricsSourceType, configFile []byte) (*s.MetricsSou
 		}
 		metrics := s.MetricsSource(prometheus)
 		return &metrics, nil
+	case s.IonosMonitoring:
+		ionos, err := s.LoadConfig[metricssource.IonosMonitoring](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading ionos monitoring config: %s", err)
+		}
+		if err := ionos.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing ionos monitoring: %s", err)
+		}
+		metrics := s.MetricsSource(ionos)
+		return &metrics, nil
+	case s.Replay:
+		replay, err := s.LoadConfig[metricssource.Replay](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading replay config: %s", err)
+		}
+		if err := replay.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing replay: %s", err)
+		}
+		metrics := s.MetricsSource(replay)
+		return &metrics, nil
+	case s.Otlp:
+		otlp, err := s.LoadConfig[metricssource.Otlp](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading otlp config: %s", err)
+		}
+		if err := otlp.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing otlp: %s", err)
+		}
+		metrics := s.MetricsSource(otlp)
+		return &metrics, nil
+	case s.InfluxDB:
+		influxdb, err := s.LoadConfig[metricssource.InfluxDB](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading influxdb config: %s", err)
+		}
+		if err := influxdb.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing influxdb: %s", err)
+		}
+		metrics := s.MetricsSource(influxdb)
+		return &metrics, nil
+	case s.NodeExporter:
+		nodeExporter, err := s.LoadConfig[metricssource.NodeExporter](configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading node exporter config: %s", err)
+		}
+		if err := nodeExporter.Init(); err != nil {
+			return nil, fmt.Errorf("error while initializing node exporter: %s", err)
+		}
+		metrics := s.MetricsSource(nodeExporter)
+		return &metrics, nil
 	}
 	return nil, fmt.Errorf("unknown metrics type: %s", *t)
 }
@@ -128,12 +230,12 @@ func (sc ScalerApp) scaleObject(object s.ScaledObject) error {
 	resourceState := object.GetResourceState()
 	resourceState.Cpu.CurrentUsage, err = sc.metricsSource.GetCpuUsage(object)
 	if err != nil {
-		return fmt.Errorf("error while getting cpu usage for %s %s: %s", object.GetType(), object.GetName(), err)
+		return fmt.Errorf("error while getting cpu usage for %s %s: %w", object.GetType(), object.GetName(), err)
 	}
 	slog.Info(fmt.Sprintf("CPU usage for %s %s: %f\n", object.GetType(), object.GetName(), resourceState.Cpu.CurrentUsage))
 	resourceState.Memory.CurrentUsage, err = sc.metricsSource.GetMemoryUsage(object)
 	if err != nil {
-		return fmt.Errorf("error while getting memory usage for %s %s: %s", object.GetType(), object.GetName(), err)
+		return fmt.Errorf("error while getting memory usage for %s %s: %w", object.GetType(), object.GetName(), err)
 	}
 	slog.Info(fmt.Sprintf("Memory usage for %s %s: %f\n", object.GetType(), object.GetName(), resourceState.Memory.CurrentUsage))
 	object.SetResourceState(resourceState)
@@ -141,37 +243,30 @@ func (sc ScalerApp) scaleObject(object s.ScaledObject) error {
 	// Get scaling proposal from service
 	scalingProposal, err := sc.service.ComputeScalingProposal(object)
 	if err != nil {
-		return fmt.Errorf("error while getting scaling proposal for %s %s: %s", object.GetType(), object.GetName(), err)
+		return fmt.Errorf("error while getting scaling proposal for %s %s: %w", object.GetType(), object.GetName(), err)
 	}
 
 	// Scale
 	// Override heuristic target resource
-	if sc.appDefinition.ScalingMode == s.DirectScaling {
-		// Scale up CPU
-		if scalingProposal.Cpu.Direction == s.ScaleUp {
-			scalingProposal.Cpu.Amount = cpuIncrease
-		}
-		// Scale up RAM
-		if scalingProposal.Mem.Direction == s.ScaleUp {
-			scalingProposal.Mem.Amount = memIncrease
-		}
-		// Scale down CPU
-		if scalingProposal.Cpu.Direction == s.ScaleDown {
-			scalingProposal.Cpu.Amount = cpuDecrease
-		}
-		// Scale down RAM
-		if scalingProposal.Mem.Direction == s.ScaleDown {
-			scalingProposal.Mem.Amount = memDecrease
-		}
-	}
+	scalingProposal = sc.appDefinition.ScalingMode.Override(scalingProposal)
 	slog.Info(fmt.Sprintf("Scaling proposal for %s: %+v\n", object.GetName(), scalingProposal))
 
+	resizing := scalingProposal.Cpu.Direction != s.ScaleNone || scalingProposal.Mem.Direction != s.ScaleNone
+	if resizing && sc.dns != nil {
+		// Users should not resolve the server while it reboots
+		sc.dns.beforeResize(object)
+	}
 	err = sc.provider.UpdateScaledObject(object, scalingProposal)
 	if err != nil {
 		return fmt.Errorf("error while setting resources for %s %s: %s", object.GetType(), object.GetName(), err)
 	}
-	if scalingProposal.Cpu.Direction != s.ScaleNone || scalingProposal.Mem.Direction != s.ScaleNone {
+	if resizing {
 		lastScaleTimeGauge.SetToCurrentTime()
+		if listener, ok := sc.service.(s.UpdateListener); ok {
+			if err := listener.ScaledObjectUpdated(object, scalingProposal); err != nil {
+				return fmt.Errorf("error after resizing %s %s: %s", object.GetType(), object.GetName(), err)
+			}
+		}
 	}
 	return nil
 }
@@ -183,13 +278,19 @@ func (sc *ScalerApp) Scale() {
 		scaledObjects, err := sc.provider.GetScaledObjects()
 		if err != nil {
 			slog.Error(fmt.Sprint("Error while getting scaled objects: ", err))
+		} else if sc.dns != nil {
+			// Without the list of objects, the records of all servers would look orphaned
+			sc.dns.reconcile(scaledObjects)
 		}
 
 		go sc.calculateMetrics(scaledObjects)
 
 		for _, scaledObject := range scaledObjects {
 			err := sc.scaleObject(scaledObject)
-			if err != nil {
+			var invalidReading *s.InvalidReadingError
+			if errors.As(err, &invalidReading) {
+				slog.Warn(fmt.Sprintf("Skipping %s %s for this cycle: %s", scaledObject.GetType(), scaledObject.GetName(), err))
+			} else if err != nil {
 				slog.Error(err.Error())
 			}
 		}
@@ -0,0 +1,218 @@
+// IONOS Cloud DNS management for the BBB autoscaler implementation
+// https://api.ionos.com/docs/dns/v1/
+package dns_providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dnsRecordTypeTXT    string = "TXT"
+	defaultIonosDnsUrl  string = "https://dns.de-fra.ionos.com"
+	ionosDnsHttpTimeout        = 10 * time.Second
+	ionosDnsPageLimit   int    = 1000
+)
+
+// The DNS client we use to trigger our DNS actions.
+type IonosDnsClient struct {
+	Url        string
+	httpClient *http.Client
+	// Sets the credentials of a request
+	authorize func(*http.Request)
+}
+
+type IonosDnsZone struct {
+	Id         string `json:"id"`
+	Properties struct {
+		ZoneName string `json:"zoneName"`
+	} `json:"properties"`
+}
+
+type IonosDnsRecordProperties struct {
+	// Name relative to the zone
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Ttl     int    `json:"ttl,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+type IonosDnsRecord struct {
+	Id         string                   `json:"id"`
+	Properties IonosDnsRecordProperties `json:"properties"`
+}
+
+// Creates a client authenticated with a token, or with username and password if the token is empty
+func NewIonosDnsClient(baseUrl, token, username, password string) *IonosDnsClient {
+	if baseUrl == "" {
+		baseUrl = defaultIonosDnsUrl
+	}
+	return &IonosDnsClient{
+		Url:        strings.TrimSuffix(baseUrl, "/"),
+		httpClient: &http.Client{Timeout: ionosDnsHttpTimeout},
+		authorize: func(request *http.Request) {
+			if token != "" {
+				request.Header.Set("Authorization", "Bearer "+token)
+			} else {
+				request.SetBasicAuth(username, password)
+			}
+		},
+	}
+}
+
+// Sends a request and decodes the JSON response into result, if not nil
+func (dnsClient *IonosDnsClient) do(method, path string, query url.Values, body interface{}, result interface{}) error {
+	endpoint := dnsClient.Url + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	dnsClient.authorize(request)
+	response, err := dnsClient.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// ===========================================================================
+// Zones
+// ===========================================================================
+
+// Retrieves a Zone by its name.
+func (dnsClient *IonosDnsClient) GetHostedZone(zoneName string) (*IonosDnsZone, error) {
+	var zones struct {
+		Items []IonosDnsZone `json:"items"`
+	}
+	zoneName = strings.TrimSuffix(zoneName, ".")
+	if err := dnsClient.do(http.MethodGet, "/zones", url.Values{"filter.zoneName": {zoneName}}, nil, &zones); err != nil {
+		return nil, fmt.Errorf("zone %s not found: %s", zoneName, err)
+	}
+
+	// The filter matches partial names
+	matching := []IonosDnsZone{}
+	for _, zone := range zones.Items {
+		if zone.Properties.ZoneName == zoneName {
+			matching = append(matching, zone)
+		}
+	}
+
+	// We need exactly 1 zone to operate on
+	if len(matching) != 1 {
+		return nil, fmt.Errorf("zone query with %s returned %d zones. Expected: 1", zoneName, len(matching))
+	}
+	return &matching[0], nil
+}
+
+// ===========================================================================
+// Records
+// ===========================================================================
+
+// List all records of a type in the zone
+func (dnsClient *IonosDnsClient) ListRecords(zone *IonosDnsZone, recordType string) ([]IonosDnsRecord, error) {
+	records, err := dnsClient.listRecords(zone, url.Values{"filter.type": {recordType}})
+	if err != nil {
+		return nil, fmt.Errorf("list records failed for zone %s: %s", zone.Properties.ZoneName, err)
+	}
+	return filterRecords(records, func(record IonosDnsRecord) bool {
+		return record.Properties.Type == recordType
+	}), nil
+}
+
+// Get the records of a record set by name and type, empty if there are none
+func (dnsClient *IonosDnsClient) GetRecords(zone *IonosDnsZone, name string, recordType string) ([]IonosDnsRecord, error) {
+	records, err := dnsClient.listRecords(zone, url.Values{"filter.name": {name}, "filter.type": {recordType}})
+	if err != nil {
+		return nil, fmt.Errorf("list records failed for dns entry %s: %s", name, err)
+	}
+	// The filter matches partial names, e.g. bbb-1 and bbb-10 for bbb
+	return filterRecords(records, func(record IonosDnsRecord) bool {
+		return record.Properties.Name == name && record.Properties.Type == recordType
+	}), nil
+}
+
+// Pages through the records of the zone matching the filters of the query
+func (dnsClient *IonosDnsClient) listRecords(zone *IonosDnsZone, query url.Values) ([]IonosDnsRecord, error) {
+	all := []IonosDnsRecord{}
+	for offset := 0; ; offset += ionosDnsPageLimit {
+		var records struct {
+			Items []IonosDnsRecord `json:"items"`
+		}
+		query.Set("limit", strconv.Itoa(ionosDnsPageLimit))
+		query.Set("offset", strconv.Itoa(offset))
+		if err := dnsClient.do(http.MethodGet, "/zones/"+zone.Id+"/records", query, nil, &records); err != nil {
+			return nil, err
+		}
+		all = append(all, records.Items...)
+		if len(records.Items) < ionosDnsPageLimit {
+			return all, nil
+		}
+	}
+}
+
+func filterRecords(records []IonosDnsRecord, keep func(IonosDnsRecord) bool) []IonosDnsRecord {
+	matching := []IonosDnsRecord{}
+	for _, record := range records {
+		if keep(record) {
+			matching = append(matching, record)
+		}
+	}
+	return matching
+}
+
+// Create a new record with name and content, e.g. an IP
+func (dnsClient *IonosDnsClient) CreateRecord(zone *IonosDnsZone, name string, recordType string, content string, ttl int) (*IonosDnsRecord, error) {
+	body := map[string]interface{}{
+		"properties": IonosDnsRecordProperties{
+			Name:    name,
+			Type:    recordType,
+			Content: content,
+			Ttl:     ttl,
+			Enabled: true,
+		},
+	}
+	var created IonosDnsRecord
+	if err := dnsClient.do(http.MethodPost, "/zones/"+zone.Id+"/records", nil, body, &created); err != nil {
+		return nil, fmt.Errorf("creation of record %s failed: %s", name, err)
+	}
+	return &created, nil
+}
+
+// Delete a record by its id
+func (dnsClient *IonosDnsClient) DeleteRecordById(zone *IonosDnsZone, recordId string) error {
+	if err := dnsClient.do(http.MethodDelete, "/zones/"+zone.Id+"/records/"+recordId, nil, nil, nil); err != nil {
+		return fmt.Errorf("deletion of record with zoneId %s and recordId %s failed: %s", zone.Id, recordId, err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// DNSProvider implementation on top of the IONOS Cloud DNS client
+package dns_providers
+
+import (
+	"fmt"
+	"net/url"
+	s "scaler/shared"
+
+	"golang.org/x/exp/slices"
+)
+
+// Subset of the Ionos provider config
+type IonosDnsCredentials struct {
+	Token    s.StringFromEnv `yaml:"token"`
+	Username s.StringFromEnv `yaml:"username"`
+	Password s.StringFromEnv `yaml:"password"`
+}
+
+type IonosDnsConfig struct {
+	// Name of the zone holding the records, e.g. example.com
+	Zone string `yaml:"zone"`
+	// Defaults to https://dns.de-fra.ionos.com
+	Url              string `yaml:"url"`
+	s.DNSZoneOptions `yaml:",inline"`
+}
+
+// The credentials are read from the ionos_config of the Ionos provider
+type IonosDns struct {
+	Credentials IonosDnsCredentials `yaml:"ionos_config"`
+	Config      IonosDnsConfig      `yaml:"ionos_dns_config"`
+	client      *IonosDnsClient
+	zone        *IonosDnsZone
+}
+
+func (i IonosDns) Validate() error {
+	if i.Config.Zone == "" {
+		return fmt.Errorf("ionos_dns.zone is empty")
+	}
+	if i.Credentials.Token == "" && (i.Credentials.Username == "" || i.Credentials.Password == "") {
+		return fmt.Errorf("ionos.token or ionos.username and ionos.password must be set")
+	}
+	if err := i.Config.DNSZoneOptions.Validate(); err != nil {
+		return fmt.Errorf("ionos_dns.%s", err)
+	}
+	if i.Config.Url != "" {
+		urlParsed, err := url.Parse(i.Config.Url)
+		if err != nil {
+			return fmt.Errorf("ionos_dns.url is invalid: %v", err)
+		}
+		if urlParsed.Scheme != "http" && urlParsed.Scheme != "https" {
+			return fmt.Errorf("ionos_dns.url scheme is invalid: %s", urlParsed.Scheme)
+		}
+	}
+	return nil
+}
+
+func (i *IonosDns) Init() error {
+	i.client = NewIonosDnsClient(i.Config.Url, string(i.Credentials.Token), string(i.Credentials.Username), string(i.Credentials.Password))
+	zone, err := i.client.GetHostedZone(i.Config.Zone)
+	if err != nil {
+		return err
+	}
+	i.zone = zone
+	return nil
+}
+
+// IONOS records have no description, a TXT record of the same name with the description marks our records
+// Each IP of a record set is a record of its own
+func (i IonosDns) markers() (map[string]IonosDnsRecord, error) {
+	found, err := i.client.ListRecords(i.zone, dnsRecordTypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	markers := map[string]IonosDnsRecord{}
+	for _, marker := range found {
+		if marker.Properties.Content == i.Config.GetDescription() {
+			markers[marker.Properties.Name] = marker
+		}
+	}
+	return markers, nil
+}
+
+// Groups the records by name, in the order of the records
+func (i IonosDns) toRecords(found []IonosDnsRecord, markers map[string]IonosDnsRecord) []s.DNSRecord {
+	records := []s.DNSRecord{}
+	index := map[string]int{}
+	for _, record := range found {
+		if position, ok := index[record.Properties.Name]; ok {
+			records[position].Ips = append(records[position].Ips, record.Properties.Content)
+			continue
+		}
+		index[record.Properties.Name] = len(records)
+		grouped := s.DNSRecord{
+			Name: record.Properties.Name,
+			Type: s.DNSRecordType(record.Properties.Type),
+			Ips:  []string{record.Properties.Content},
+			Ttl:  record.Properties.Ttl,
+		}
+		if marker, ok := markers[record.Properties.Name]; ok {
+			grouped.Description = marker.Properties.Content
+			grouped.Managed = true
+		}
+		records = append(records, grouped)
+	}
+	return records
+}
+
+func (i IonosDns) ListRecords() ([]s.DNSRecord, error) {
+	markers, err := i.markers()
+	if err != nil {
+		return nil, err
+	}
+	records := []s.DNSRecord{}
+	for _, recordType := range []s.DNSRecordType{s.DNSRecordTypeA, s.DNSRecordTypeAAAA} {
+		found, err := i.client.ListRecords(i.zone, string(recordType))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, i.toRecords(found, markers)...)
+	}
+	return records, nil
+}
+
+func (i IonosDns) GetRecord(name string, recordType s.DNSRecordType) (*s.DNSRecord, error) {
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	markers, err := i.markers()
+	if err != nil {
+		return nil, err
+	}
+	return &i.toRecords(found, markers)[0], nil
+}
+
+func (i IonosDns) addMarker(name string) error {
+	markers, err := i.markers()
+	if err != nil {
+		return err
+	}
+	if _, ok := markers[name]; ok {
+		return nil
+	}
+	_, err = i.client.CreateRecord(i.zone, name, dnsRecordTypeTXT, i.Config.GetDescription(), i.Config.GetTtl())
+	return err
+}
+
+// Creates the records after their marker, so that a failure never leaves records of ours unmarked
+// The marker is removed again when no record of the name could be created
+func (i IonosDns) createMarkedRecords(name string, recordType s.DNSRecordType, ips []string) error {
+	if err := i.addMarker(name); err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if _, err := i.client.CreateRecord(i.zone, name, string(recordType), ip, i.Config.GetTtl()); err != nil {
+			if removeErr := i.removeUnusedMarker(name); removeErr != nil {
+				return fmt.Errorf("%s, and the marker of %s could not be removed: %s", err, name, removeErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the marker once the name has neither A nor AAAA records
+func (i IonosDns) removeUnusedMarker(name string) error {
+	for _, recordType := range []s.DNSRecordType{s.DNSRecordTypeA, s.DNSRecordTypeAAAA} {
+		found, err := i.client.GetRecords(i.zone, name, string(recordType))
+		if err != nil || len(found) > 0 {
+			return err
+		}
+	}
+	markers, err := i.markers()
+	if err != nil {
+		return err
+	}
+	marker, ok := markers[name]
+	if !ok {
+		return nil
+	}
+	return i.client.DeleteRecordById(i.zone, marker.Id)
+}
+
+func (i IonosDns) CreateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("record %s of type %s exists already", name, recordType)
+	}
+	return i.createMarkedRecords(name, recordType, ips)
+}
+
+func (i IonosDns) UpdateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("record %s of type %s not found", name, recordType)
+	}
+	// Creates the new IPs before deleting the stale ones, so the name always resolves
+	existing := map[string]bool{}
+	for _, record := range found {
+		existing[record.Properties.Content] = true
+	}
+	for _, ip := range ips {
+		if existing[ip] {
+			continue
+		}
+		if _, err := i.client.CreateRecord(i.zone, name, string(recordType), ip, i.Config.GetTtl()); err != nil {
+			return err
+		}
+	}
+	for _, record := range found {
+		if slices.Contains(ips, record.Properties.Content) {
+			continue
+		}
+		if err := i.client.DeleteRecordById(i.zone, record.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i IonosDns) DeleteRecord(name string, recordType s.DNSRecordType) error {
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("record %s of type %s not found", name, recordType)
+	}
+	for _, record := range found {
+		if err := i.client.DeleteRecordById(i.zone, record.Id); err != nil {
+			return err
+		}
+	}
+	return i.removeUnusedMarker(name)
+}
+
+func (i IonosDns) AddRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	if err := recordType.ValidateIps([]string{ip}); err != nil {
+		return err
+	}
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil {
+		return err
+	}
+	for _, record := range found {
+		if record.Properties.Content == ip {
+			return nil
+		}
+	}
+	return i.createMarkedRecords(name, recordType, []string{ip})
+}
+
+func (i IonosDns) RemoveRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	found, err := i.client.GetRecords(i.zone, name, string(recordType))
+	if err != nil {
+		return err
+	}
+	for _, record := range found {
+		if record.Properties.Content != ip {
+			continue
+		}
+		if err := i.client.DeleteRecordById(i.zone, record.Id); err != nil {
+			return err
+		}
+		return i.removeUnusedMarker(name)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package dns_providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateIonosDns(t *testing.T) {
+	s.ValidatePass(t, IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com"}})
+	s.ValidatePass(t, IonosDns{Credentials: IonosDnsCredentials{Username: "user", Password: "password"}, Config: IonosDnsConfig{Zone: "example.com", Url: "https://dns.example.com"}})
+	s.ValidateFail(t, IonosDns{Credentials: IonosDnsCredentials{Token: "token"}})
+	s.ValidateFail(t, IonosDns{Config: IonosDnsConfig{Zone: "example.com"}})
+	s.ValidateFail(t, IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com", Url: "ftp://dns.example.com"}})
+	s.ValidateFail(t, IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com", DNSZoneOptions: s.DNSZoneOptions{Ttl: -1}}})
+}
+
+// In-memory fake of the zones and records endpoints of the IONOS Cloud DNS API
+type fakeIonosDnsApi struct {
+	mutex   sync.Mutex
+	zones   []IonosDnsZone
+	records map[string][]IonosDnsRecord
+	nextId  int
+	// Creations of records of this type fail
+	failType string
+}
+
+func newFakeIonosDnsApi(t *testing.T, zoneNames ...string) (*fakeIonosDnsApi, *httptest.Server) {
+	api := &fakeIonosDnsApi{records: map[string][]IonosDnsRecord{}}
+	for i, zoneName := range zoneNames {
+		zone := IonosDnsZone{Id: fmt.Sprintf("zone-%d", i)}
+		zone.Properties.ZoneName = zoneName
+		api.zones = append(api.zones, zone)
+	}
+	return api, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		api.mutex.Lock()
+		defer api.mutex.Unlock()
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "zones" && r.Method == http.MethodGet:
+			items := []IonosDnsZone{}
+			for _, zone := range api.zones {
+				if strings.Contains(zone.Properties.ZoneName, r.URL.Query().Get("filter.zoneName")) {
+					items = append(items, zone)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+		case len(parts) == 3 && parts[2] == "records" && r.Method == http.MethodGet:
+			items := []IonosDnsRecord{}
+			for _, record := range api.records[parts[1]] {
+				if strings.Contains(record.Properties.Name, r.URL.Query().Get("filter.name")) && record.Properties.Type == r.URL.Query().Get("filter.type") {
+					items = append(items, record)
+				}
+			}
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			if limit == 0 {
+				limit = 100
+			}
+			items = items[min(offset, len(items)):min(offset+limit, len(items))]
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+		case len(parts) == 3 && parts[2] == "records" && r.Method == http.MethodPost:
+			var record IonosDnsRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			if record.Properties.Type == api.failType {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			api.nextId++
+			record.Id = fmt.Sprintf("record-%d", api.nextId)
+			api.records[parts[1]] = append(api.records[parts[1]], record)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(record)
+		case len(parts) == 4 && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+			records := api.records[parts[1]]
+			for i, record := range records {
+				if record.Id != parts[3] {
+					continue
+				}
+				if r.Method == http.MethodDelete {
+					api.records[parts[1]] = append(records[:i], records[i+1:]...)
+				} else {
+					json.NewDecoder(r.Body).Decode(&records[i])
+					records[i].Id = record.Id
+					json.NewEncoder(w).Encode(records[i])
+				}
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestIonosDns(t *testing.T) {
+	_, server := newFakeIonosDnsApi(t, "example.com", "sub.example.com")
+	defer server.Close()
+
+	if err := (&IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.org", Url: server.URL}}).Init(); err == nil {
+		t.Errorf("Expected error for an unknown zone")
+	}
+	if err := (&IonosDns{Credentials: IonosDnsCredentials{Token: "wrong"}, Config: IonosDnsConfig{Zone: "example.com", Url: server.URL}}).Init(); err == nil {
+		t.Errorf("Expected error for wrong credentials")
+	}
+	provider := &IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com.", Url: server.URL, DNSZoneOptions: s.DNSZoneOptions{Ttl: 60}}}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if provider.zone.Id != "zone-0" {
+		t.Fatalf("Expected zone-0 but got %s", provider.zone.Id)
+	}
+
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || record != nil {
+		t.Fatalf("Expected no record but got %v, %v", record, err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when updating a missing record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"fd00::1"}); err == nil {
+		t.Errorf("Expected error for an IPv6 address in an A record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when creating an existing record")
+	}
+	if err := provider.CreateRecord("bbb-10", s.DNSRecordTypeA, []string{"10.0.0.10"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	// AAAA records of the same name are kept apart
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeAAAA, []string{"fd00::1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.11", "10.0.0.12"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	expected := s.DNSRecord{Name: "bbb-1", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.11", "10.0.0.12"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || fmt.Sprint(record) != fmt.Sprint(&expected) {
+		t.Fatalf("Expected record %v but got %v, %v", expected, record, err)
+	}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeAAAA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[fd00::1]" {
+		t.Fatalf("Expected AAAA record with fd00::1 but got %v, %v", record, err)
+	}
+
+	// Records created by others have no description
+	if _, err := provider.client.CreateRecord(provider.zone, "www", string(s.DNSRecordTypeA), "10.0.0.80", 3600); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	records, err := provider.ListRecords()
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	expectedRecords := []s.DNSRecord{
+		{Name: "bbb-10", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.10"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true},
+		expected,
+		{Name: "www", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.80"}, Ttl: 3600},
+		{Name: "bbb-1", Type: s.DNSRecordTypeAAAA, Ips: []string{"fd00::1"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(expectedRecords) {
+		t.Errorf("Expected %v but got %v", expectedRecords, records)
+	}
+
+	// Single IPs of a round robin record
+	if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, "10.0.0.10"); err != nil {
+		t.Fatalf("Failed to add IP: %v", err)
+	}
+	if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, "10.0.0.11"); err != nil {
+		t.Fatalf("Failed to add IP: %v", err)
+	}
+	if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, "10.0.0.11"); err != nil {
+		t.Fatalf("Failed to add IP: %v", err)
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.10 10.0.0.11]" || !record.Managed {
+		t.Fatalf("Expected managed record with 2 IPs but got %v, %v", record, err)
+	}
+	for _, ip := range []string{"10.0.0.10", "10.0.0.99", "10.0.0.11"} {
+		if err := provider.RemoveRecordIp("bbb", s.DNSRecordTypeA, ip); err != nil {
+			t.Fatalf("Failed to remove IP: %v", err)
+		}
+	}
+	if found, err := provider.client.GetRecords(provider.zone, "bbb", dnsRecordTypeTXT); err != nil || len(found) != 0 {
+		t.Fatalf("Expected the TXT record to be deleted with the last IP but got %v, %v", found, err)
+	}
+
+	// The description is kept until the last record of the name is deleted
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if found, err := provider.client.GetRecords(provider.zone, "bbb-1", dnsRecordTypeTXT); err != nil || len(found) != 1 {
+		t.Fatalf("Expected the TXT record of the AAAA record but got %v, %v", found, err)
+	}
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeAAAA); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if found, err := provider.client.GetRecords(provider.zone, "bbb-1", dnsRecordTypeTXT); err != nil || len(found) != 0 {
+		t.Fatalf("Expected the TXT record to be deleted but got %v, %v", found, err)
+	}
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err == nil {
+		t.Errorf("Expected error when deleting a missing record")
+	}
+	if record, err := provider.GetRecord("bbb-10", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.10]" {
+		t.Fatalf("Expected record with 10.0.0.10 but got %v, %v", record, err)
+	}
+
+	// Records with another description are not managed
+	other := &IonosDns{Credentials: provider.Credentials, Config: IonosDnsConfig{Zone: "example.com", Url: server.URL, DNSZoneOptions: s.DNSZoneOptions{Description: "Other"}}}
+	if err := other.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if record, err := other.GetRecord("bbb-10", s.DNSRecordTypeA); err != nil || record == nil || record.Managed {
+		t.Fatalf("Expected unmanaged record but got %v, %v", record, err)
+	}
+}
+
+func TestIonosDnsMarkerFailure(t *testing.T) {
+	api, server := newFakeIonosDnsApi(t, "example.com")
+	defer server.Close()
+	provider := &IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com", Url: server.URL}}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+
+	// No unmarked record is left behind when the marker cannot be created
+	api.failType = dnsRecordTypeTXT
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when the marker cannot be created")
+	}
+	if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, "10.0.0.1"); err == nil {
+		t.Errorf("Expected error when the marker cannot be created")
+	}
+	for _, name := range []string{"bbb-1", "bbb"} {
+		if found, err := provider.client.GetRecords(provider.zone, name, string(s.DNSRecordTypeA)); err != nil || len(found) != 0 {
+			t.Fatalf("Expected no A record of %s but got %v, %v", name, found, err)
+		}
+	}
+
+	// The marker is removed again when the records cannot be created
+	api.failType = string(s.DNSRecordTypeA)
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when the record cannot be created")
+	}
+	if found, err := provider.client.GetRecords(provider.zone, "bbb-1", dnsRecordTypeTXT); err != nil || len(found) != 0 {
+		t.Fatalf("Expected the marker to be removed but got %v, %v", found, err)
+	}
+}
+
+func TestIonosDnsRecordPages(t *testing.T) {
+	api, server := newFakeIonosDnsApi(t, "example.com")
+	defer server.Close()
+	provider := &IonosDns{Credentials: IonosDnsCredentials{Token: "token"}, Config: IonosDnsConfig{Zone: "example.com", Url: server.URL}}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+
+	// The partial matches of the name filter fill the first page
+	for i := 0; i < ionosDnsPageLimit; i++ {
+		record := IonosDnsRecord{Id: fmt.Sprintf("other-%d", i), Properties: IonosDnsRecordProperties{Name: fmt.Sprintf("bbb-%d", i), Type: string(s.DNSRecordTypeA), Content: "10.0.1.1"}}
+		api.records["zone-0"] = append(api.records["zone-0"], record)
+	}
+	if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, "10.0.0.1"); err != nil {
+		t.Fatalf("Failed to add IP: %v", err)
+	}
+	if found, err := provider.client.GetRecords(provider.zone, "bbb", string(s.DNSRecordTypeA)); err != nil || len(found) != 1 || found[0].Properties.Content != "10.0.0.1" {
+		t.Fatalf("Expected the record of bbb on the second page but got %v, %v", found, err)
+	}
+
+	// The current IPs are kept when the new ones cannot be created
+	api.failType = string(s.DNSRecordTypeA)
+	if err := provider.UpdateRecord("bbb", s.DNSRecordTypeA, []string{"10.0.0.2"}); err == nil {
+		t.Errorf("Expected error when the record cannot be created")
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.1]" {
+		t.Fatalf("Expected record with 10.0.0.1 but got %v, %v", record, err)
+	}
+	api.failType = ""
+	if err := provider.UpdateRecord("bbb", s.DNSRecordTypeA, []string{"10.0.0.2"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.2]" {
+		t.Fatalf("Expected record with 10.0.0.2 but got %v, %v", record, err)
+	}
+}
@@ -0,0 +1,258 @@
+// RFC 2136 dynamic DNS management for the BBB autoscaler implementation
+// Works with the UPDATE support of BIND, PowerDNS, Knot and others, signed with TSIG (RFC 8945)
+package dns_providers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	rfc2136TsigFudge   uint16 = 300
+	rfc2136DialTimeout        = 10 * time.Second
+)
+
+// The DNS client we use to trigger our DNS actions.
+type Rfc2136DnsClient struct {
+	// Primary server of the zone, host:port
+	Server string
+	// Fully qualified zone name, e.g. example.com.
+	Zone string
+	// TSIG key, the updates are unsigned without key name
+	TsigKeyName   string
+	TsigSecret    string
+	TsigAlgorithm string
+	// TTL of the created records
+	Ttl    uint32
+	client *dns.Client
+}
+
+func NewRfc2136DnsClient(server, zone, tsigKeyName, tsigSecret, tsigAlgorithm string, ttl uint32) *Rfc2136DnsClient {
+	client := &dns.Client{Net: "tcp", Timeout: rfc2136DialTimeout}
+	if tsigKeyName != "" {
+		client.TsigSecret = map[string]string{dns.Fqdn(tsigKeyName): tsigSecret}
+	}
+	return &Rfc2136DnsClient{
+		Server:        server,
+		Zone:          dns.Fqdn(zone),
+		TsigKeyName:   dns.Fqdn(tsigKeyName),
+		TsigSecret:    tsigSecret,
+		TsigAlgorithm: dns.Fqdn(tsigAlgorithm),
+		Ttl:           ttl,
+		client:        client,
+	}
+}
+
+// Signs the message if a TSIG key is configured and sends it to the server
+func (dnsClient *Rfc2136DnsClient) exchange(m *dns.Msg) (*dns.Msg, error) {
+	if dnsClient.client.TsigSecret != nil {
+		m.SetTsig(dnsClient.TsigKeyName, dnsClient.TsigAlgorithm, rfc2136TsigFudge, time.Now().Unix())
+	}
+	response, _, err := dnsClient.client.Exchange(m, dnsClient.Server)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ===========================================================================
+// RecordSets
+// ===========================================================================
+
+// Query the records of a type by DNS Name, empty if there are none
+func (dnsClient *Rfc2136DnsClient) query(dnsName string, recordType uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(dnsName), recordType)
+	// Ask the primary for its own data
+	m.RecursionDesired = false
+	response, err := dnsClient.exchange(m)
+	if err != nil {
+		return nil, fmt.Errorf("query failed for dns entry %s: %s", dnsName, err)
+	}
+	if response.Rcode == dns.RcodeNameError {
+		// Query was successful, but no results
+		return nil, nil
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("query failed for dns entry %s: %s", dnsName, dns.RcodeToString[response.Rcode])
+	}
+	records := []dns.RR{}
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype == recordType {
+			records = append(records, rr)
+		}
+	}
+	return records, nil
+}
+
+// Get the records of a record set by DNS Name and type, empty if there are none
+func (dnsClient *Rfc2136DnsClient) GetRecordSet(dnsName string, recordType uint16) ([]dns.RR, error) {
+	return dnsClient.query(dnsName, recordType)
+}
+
+// Get the texts of the TXT records by DNS Name
+func (dnsClient *Rfc2136DnsClient) GetTXTRecords(dnsName string) ([]string, error) {
+	records, err := dnsClient.query(dnsName, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	texts := []string{}
+	for _, rr := range records {
+		texts = append(texts, strings.Join(rr.(*dns.TXT).Txt, ""))
+	}
+	return texts, nil
+}
+
+// Transfer all records of the zone, the server has to allow AXFR for the key
+func (dnsClient *Rfc2136DnsClient) ListRecordSets() ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(dnsClient.Zone)
+	transfer := &dns.Transfer{DialTimeout: rfc2136DialTimeout, ReadTimeout: rfc2136DialTimeout, TsigSecret: dnsClient.client.TsigSecret}
+	if dnsClient.client.TsigSecret != nil {
+		m.SetTsig(dnsClient.TsigKeyName, dnsClient.TsigAlgorithm, rfc2136TsigFudge, time.Now().Unix())
+	}
+	envelopes, err := transfer.In(m, dnsClient.Server)
+	if err != nil {
+		return nil, fmt.Errorf("transfer failed for zone %s: %s", dnsClient.Zone, err)
+	}
+	records := []dns.RR{}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("transfer failed for zone %s: %s", dnsClient.Zone, envelope.Error)
+		}
+		records = append(records, envelope.RR...)
+	}
+	return records, nil
+}
+
+// Creates an A record for an IPv4 and an AAAA record for an IPv6 address
+func (dnsClient *Rfc2136DnsClient) newRecord(dnsName string, recordType uint16, ipValue string) (dns.RR, error) {
+	header := dns.RR_Header{Name: dns.Fqdn(dnsName), Rrtype: recordType, Class: dns.ClassINET, Ttl: dnsClient.Ttl}
+	ip := net.ParseIP(ipValue)
+	switch {
+	case recordType == dns.TypeA && ip != nil && ip.To4() != nil:
+		return &dns.A{Hdr: header, A: ip.To4()}, nil
+	case recordType == dns.TypeAAAA && ip != nil && ip.To4() == nil:
+		return &dns.AAAA{Hdr: header, AAAA: ip}, nil
+	}
+	return nil, fmt.Errorf("%s is not valid in a %s record", ipValue, dns.TypeToString[recordType])
+}
+
+func (dnsClient *Rfc2136DnsClient) newRecords(dnsName string, recordType uint16, ipValues []string) ([]dns.RR, error) {
+	records := []dns.RR{}
+	for _, ipValue := range ipValues {
+		record, err := dnsClient.newRecord(dnsName, recordType, ipValue)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (dnsClient *Rfc2136DnsClient) newTXTRecord(dnsName string, text string) *dns.TXT {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(dnsName), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: dnsClient.Ttl},
+		Txt: []string{text},
+	}
+}
+
+// Adds the TXT record with the description to the update, replacing a TXT record with the same text
+// It goes ahead of the records it describes, the server applies all the changes of an update or none
+func (dnsClient *Rfc2136DnsClient) insertDescription(m *dns.Msg, dnsName string, description string) {
+	if description == "" {
+		return
+	}
+	m.Remove([]dns.RR{dnsClient.newTXTRecord(dnsName, description)})
+	m.Insert([]dns.RR{dnsClient.newTXTRecord(dnsName, description)})
+}
+
+// Sends an update of the zone and checks its response code
+func (dnsClient *Rfc2136DnsClient) update(m *dns.Msg, action string, dnsName string) error {
+	response, err := dnsClient.exchange(m)
+	if err != nil {
+		return fmt.Errorf("%s of record %s failed: %s", action, dnsName, err)
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("%s of record %s failed: %s", action, dnsName, dns.RcodeToString[response.Rcode])
+	}
+	return nil
+}
+
+// Create new record set with DNS Name and IPs, fails if the name has a record set of the type already
+// A TXT record with the description is added in the same update, if the description is not empty
+func (dnsClient *Rfc2136DnsClient) CreateRecordSet(dnsName string, recordType uint16, ipValues []string, description string) error {
+	records, err := dnsClient.newRecords(dnsName, recordType, ipValues)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	m.RRsetNotUsed(records[:1])
+	dnsClient.insertDescription(m, dnsName, description)
+	m.Insert(records)
+	return dnsClient.update(m, "creation", dnsName)
+}
+
+// Delete the record set by DNS Name and type, fails if there is none
+func (dnsClient *Rfc2136DnsClient) DeleteRecordSet(dnsName string, recordType uint16) error {
+	record := &dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(dnsName), Rrtype: recordType}}
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	m.RRsetUsed([]dns.RR{record})
+	m.RemoveRRset([]dns.RR{record})
+	return dnsClient.update(m, "deletion", dnsName)
+}
+
+// Replace the IPs of the record set by DNS Name and type, fails if there is none
+func (dnsClient *Rfc2136DnsClient) UpdateRecordSet(dnsName string, recordType uint16, newIPValues []string) error {
+	records, err := dnsClient.newRecords(dnsName, recordType, newIPValues)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	m.RRsetUsed(records[:1])
+	m.RemoveRRset(records[:1])
+	m.Insert(records)
+	return dnsClient.update(m, "update", dnsName)
+}
+
+// Add an IP to the record set by DNS Name and type, the record set is created if there is none
+// A TXT record with the description is added in the same update, if the description is not empty
+func (dnsClient *Rfc2136DnsClient) AddRecordSetIp(dnsName string, recordType uint16, ipValue string, description string) error {
+	record, err := dnsClient.newRecord(dnsName, recordType, ipValue)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	dnsClient.insertDescription(m, dnsName, description)
+	// Adding an existing record is ignored by the server
+	m.Insert([]dns.RR{record})
+	return dnsClient.update(m, "update", dnsName)
+}
+
+// Remove an IP from the record set by DNS Name and type, the server deletes the record set with its last IP
+func (dnsClient *Rfc2136DnsClient) RemoveRecordSetIp(dnsName string, recordType uint16, ipValue string) error {
+	record, err := dnsClient.newRecord(dnsName, recordType, ipValue)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	m.Remove([]dns.RR{record})
+	return dnsClient.update(m, "update", dnsName)
+}
+
+// Remove the TXT record with the description by DNS Name
+func (dnsClient *Rfc2136DnsClient) RemoveDescription(dnsName string, description string) error {
+	m := new(dns.Msg)
+	m.SetUpdate(dnsClient.Zone)
+	m.Remove([]dns.RR{dnsClient.newTXTRecord(dnsName, description)})
+	return dnsClient.update(m, "deletion", dnsName)
+}
@@ -0,0 +1,235 @@
+// DNSProvider implementation on top of the RFC 2136 client
+package dns_providers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	s "scaler/shared"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/exp/slices"
+)
+
+type Rfc2136Config struct {
+	// Primary server of the zone accepting updates, host or host:port
+	Server string `yaml:"server"`
+	// Name of the zone holding the records, e.g. example.com
+	Zone        string          `yaml:"zone"`
+	TsigKeyName string          `yaml:"tsig_key_name"`
+	TsigSecret  s.StringFromEnv `yaml:"tsig_secret"`
+	// hmac-sha256, hmac-sha512 or hmac-sha1, defaults to hmac-sha256
+	TsigAlgorithm    string `yaml:"tsig_algorithm"`
+	s.DNSZoneOptions `yaml:",inline"`
+}
+
+type Rfc2136 struct {
+	Config Rfc2136Config `yaml:"rfc2136_config"`
+	client *Rfc2136DnsClient
+}
+
+var rfc2136TsigAlgorithms = map[string]string{
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+	"hmac-sha1":   dns.HmacSHA1,
+}
+
+func (c Rfc2136Config) tsigAlgorithm() string {
+	if c.TsigAlgorithm == "" {
+		return dns.HmacSHA256
+	}
+	return rfc2136TsigAlgorithms[c.TsigAlgorithm]
+}
+
+// Adds the default DNS port if the server has none
+func (c Rfc2136Config) serverAddress() string {
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		return net.JoinHostPort(c.Server, "53")
+	}
+	return c.Server
+}
+
+func (r Rfc2136) Validate() error {
+	if r.Config.Server == "" {
+		return fmt.Errorf("rfc2136.server is empty")
+	}
+	if r.Config.Zone == "" {
+		return fmt.Errorf("rfc2136.zone is empty")
+	}
+	if err := r.Config.DNSZoneOptions.Validate(); err != nil {
+		return fmt.Errorf("rfc2136.%s", err)
+	}
+	if r.Config.TsigKeyName == "" {
+		return nil
+	}
+	if r.Config.TsigAlgorithm != "" && rfc2136TsigAlgorithms[r.Config.TsigAlgorithm] == "" {
+		return fmt.Errorf("rfc2136.tsig_algorithm %s is not supported", r.Config.TsigAlgorithm)
+	}
+	if r.Config.TsigSecret == "" {
+		return fmt.Errorf("rfc2136.tsig_secret is empty")
+	}
+	if _, err := base64.StdEncoding.DecodeString(string(r.Config.TsigSecret)); err != nil {
+		return fmt.Errorf("rfc2136.tsig_secret is not base64: %s", err)
+	}
+	return nil
+}
+
+func (r *Rfc2136) Init() error {
+	r.client = NewRfc2136DnsClient(r.Config.serverAddress(), r.Config.Zone, r.Config.TsigKeyName, string(r.Config.TsigSecret), r.Config.tsigAlgorithm(), uint32(r.Config.GetTtl()))
+	// Checks that the server is reachable and the key is accepted
+	if _, err := r.client.GetRecordSet(r.client.Zone, dns.TypeSOA); err != nil {
+		return fmt.Errorf("error while querying zone %s: %s", r.client.Zone, err)
+	}
+	return nil
+}
+
+func (r Rfc2136) fqdn(name string) string {
+	return name + "." + r.client.Zone
+}
+
+var rfc2136RecordTypes = map[s.DNSRecordType]uint16{
+	s.DNSRecordTypeA:    dns.TypeA,
+	s.DNSRecordTypeAAAA: dns.TypeAAAA,
+}
+
+func (r Rfc2136) recordType(recordType s.DNSRecordType) (uint16, error) {
+	rrtype, ok := rfc2136RecordTypes[recordType]
+	if !ok {
+		return 0, fmt.Errorf("record type %s is not supported", recordType)
+	}
+	return rrtype, nil
+}
+
+// The description of a record is held by a TXT record of the same name
+func (r Rfc2136) managed(texts []string) bool {
+	return slices.Contains(texts, r.Config.GetDescription())
+}
+
+// Groups the A and AAAA records by name and type, in the order of the records
+func (r Rfc2136) toRecords(rrs []dns.RR, texts map[string][]string) []s.DNSRecord {
+	records := []s.DNSRecord{}
+	index := map[string]int{}
+	for _, rr := range rrs {
+		var ip string
+		switch address := rr.(type) {
+		case *dns.A:
+			ip = address.A.String()
+		case *dns.AAAA:
+			ip = address.AAAA.String()
+		default:
+			continue
+		}
+		key := rr.Header().Name + " " + dns.TypeToString[rr.Header().Rrtype]
+		if position, ok := index[key]; ok {
+			records[position].Ips = append(records[position].Ips, ip)
+			continue
+		}
+		index[key] = len(records)
+		record := s.DNSRecord{
+			Name: strings.TrimSuffix(strings.TrimSuffix(rr.Header().Name, r.client.Zone), "."),
+			Type: s.DNSRecordType(dns.TypeToString[rr.Header().Rrtype]),
+			Ips:  []string{ip},
+			Ttl:  int(rr.Header().Ttl),
+		}
+		if r.managed(texts[rr.Header().Name]) {
+			record.Description = r.Config.GetDescription()
+			record.Managed = true
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func (r Rfc2136) ListRecords() ([]s.DNSRecord, error) {
+	rrs, err := r.client.ListRecordSets()
+	if err != nil {
+		return nil, err
+	}
+	texts := map[string][]string{}
+	for _, rr := range rrs {
+		if txt, ok := rr.(*dns.TXT); ok {
+			texts[txt.Hdr.Name] = append(texts[txt.Hdr.Name], strings.Join(txt.Txt, ""))
+		}
+	}
+	return r.toRecords(rrs, texts), nil
+}
+
+func (r Rfc2136) GetRecord(name string, recordType s.DNSRecordType) (*s.DNSRecord, error) {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return nil, err
+	}
+	rrs, err := r.client.GetRecordSet(r.fqdn(name), rrtype)
+	if err != nil || len(rrs) == 0 {
+		return nil, err
+	}
+	texts, err := r.client.GetTXTRecords(r.fqdn(name))
+	if err != nil {
+		return nil, err
+	}
+	return &r.toRecords(rrs, map[string][]string{r.fqdn(name): texts})[0], nil
+}
+
+// Deletes the TXT record with the description once the name has neither A nor AAAA records
+func (r Rfc2136) removeUnusedDescription(name string) error {
+	for _, rrtype := range rfc2136RecordTypes {
+		rrs, err := r.client.GetRecordSet(r.fqdn(name), rrtype)
+		if err != nil || len(rrs) > 0 {
+			return err
+		}
+	}
+	return r.client.RemoveDescription(r.fqdn(name), r.Config.GetDescription())
+}
+
+func (r Rfc2136) CreateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return err
+	}
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	return r.client.CreateRecordSet(r.fqdn(name), rrtype, ips, r.Config.GetDescription())
+}
+
+func (r Rfc2136) UpdateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return err
+	}
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	return r.client.UpdateRecordSet(r.fqdn(name), rrtype, ips)
+}
+
+func (r Rfc2136) DeleteRecord(name string, recordType s.DNSRecordType) error {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return err
+	}
+	if err := r.client.DeleteRecordSet(r.fqdn(name), rrtype); err != nil {
+		return err
+	}
+	return r.removeUnusedDescription(name)
+}
+
+func (r Rfc2136) AddRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return err
+	}
+	return r.client.AddRecordSetIp(r.fqdn(name), rrtype, ip, r.Config.GetDescription())
+}
+
+func (r Rfc2136) RemoveRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	rrtype, err := r.recordType(recordType)
+	if err != nil {
+		return err
+	}
+	if err := r.client.RemoveRecordSetIp(r.fqdn(name), rrtype, ip); err != nil {
+		return err
+	}
+	return r.removeUnusedDescription(name)
+}
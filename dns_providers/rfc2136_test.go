@@ -0,0 +1,265 @@
+package dns_providers
+
+import (
+	"fmt"
+	"net"
+	s "scaler/shared"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testTsigKeyName = "bbb-autoscaler."
+	testTsigSecret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+)
+
+func TestValidateRfc2136(t *testing.T) {
+	s.ValidatePass(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com", Zone: "example.com"}})
+	s.ValidatePass(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com:5353", Zone: "example.com", TsigKeyName: "key", TsigSecret: testTsigSecret, TsigAlgorithm: "hmac-sha512"}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Zone: "example.com"}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com", Zone: "example.com", DNSZoneOptions: s.DNSZoneOptions{Ttl: -1}}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com"}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com", Zone: "example.com", TsigKeyName: "key"}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com", Zone: "example.com", TsigKeyName: "key", TsigSecret: "not base64!"}})
+	s.ValidateFail(t, Rfc2136{Config: Rfc2136Config{Server: "ns1.example.com", Zone: "example.com", TsigKeyName: "key", TsigSecret: testTsigSecret, TsigAlgorithm: "md5"}})
+}
+
+// Primary server of a zone accepting queries, transfers and updates signed with the test key
+type fakeDnsServer struct {
+	mutex   sync.Mutex
+	zone    string
+	soa     dns.RR
+	records map[string][]dns.RR
+}
+
+func (f *fakeDnsServer) hasType(name string, rrtype uint16) bool {
+	for _, rr := range f.records[name] {
+		if rrtype == dns.TypeANY || rr.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the records of a name matching the filter, and the name without records
+func (f *fakeDnsServer) remove(name string, matches func(dns.RR) bool) {
+	kept := []dns.RR{}
+	for _, rr := range f.records[name] {
+		if !matches(rr) {
+			kept = append(kept, rr)
+		}
+	}
+	if len(kept) == 0 {
+		delete(f.records, name)
+	} else {
+		f.records[name] = kept
+	}
+}
+
+func (f *fakeDnsServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	defer func() {
+		if r.IsTsig() != nil {
+			m.SetTsig(testTsigKeyName, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+		w.WriteMsg(m)
+	}()
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.Rcode = dns.RcodeNotAuth
+		return
+	}
+
+	if r.Opcode == dns.OpcodeQuery {
+		question := r.Question[0]
+		if question.Qtype == dns.TypeAXFR {
+			m.Answer = append(m.Answer, f.soa)
+			for _, rrs := range f.records {
+				m.Answer = append(m.Answer, rrs...)
+			}
+			m.Answer = append(m.Answer, f.soa)
+			return
+		}
+		if _, ok := f.records[question.Name]; !ok && question.Name != f.zone {
+			m.Rcode = dns.RcodeNameError
+			return
+		}
+		for _, rr := range f.records[question.Name] {
+			if rr.Header().Rrtype == question.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		return
+	}
+
+	// Prerequisites
+	for _, rr := range r.Answer {
+		exists := f.hasType(rr.Header().Name, rr.Header().Rrtype)
+		if rr.Header().Class == dns.ClassANY && !exists {
+			m.Rcode = dns.RcodeNXRrset
+			return
+		}
+		if rr.Header().Class == dns.ClassNONE && exists {
+			m.Rcode = dns.RcodeYXRrset
+			return
+		}
+	}
+	// Updates
+	for _, rr := range r.Ns {
+		name, rrtype := rr.Header().Name, rr.Header().Rrtype
+		switch rr.Header().Class {
+		case dns.ClassINET:
+			// Duplicates are ignored
+			duplicate := false
+			for _, existing := range f.records[name] {
+				duplicate = duplicate || dns.IsDuplicate(existing, rr)
+			}
+			if !duplicate {
+				f.records[name] = append(f.records[name], rr)
+			}
+		case dns.ClassANY:
+			f.remove(name, func(existing dns.RR) bool {
+				return rrtype == dns.TypeANY || existing.Header().Rrtype == rrtype
+			})
+		case dns.ClassNONE:
+			f.remove(name, func(existing dns.RR) bool {
+				existing = dns.Copy(existing)
+				existing.Header().Class, existing.Header().Ttl = dns.ClassNONE, 0
+				return dns.IsDuplicate(existing, rr)
+			})
+		}
+	}
+}
+
+func newFakeDnsServer(t *testing.T) (*fakeDnsServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	soa, _ := dns.NewRR("example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300")
+	fake := &fakeDnsServer{zone: "example.com.", soa: soa, records: map[string][]dns.RR{}}
+	started := make(chan bool)
+	server := &dns.Server{
+		Listener:          listener,
+		Net:               "tcp",
+		Handler:           fake,
+		TsigSecret:        map[string]string{testTsigKeyName: testTsigSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default only accepts queries and notifies
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return fake, listener.Addr().String()
+}
+
+func TestRfc2136(t *testing.T) {
+	fake, address := newFakeDnsServer(t)
+
+	unsigned := &Rfc2136{Config: Rfc2136Config{Server: address, Zone: "example.com"}}
+	if err := unsigned.Init(); err == nil {
+		t.Errorf("Expected error without TSIG key")
+	}
+	wrongKey := &Rfc2136{Config: Rfc2136Config{Server: address, Zone: "example.com", TsigKeyName: "bbb-autoscaler", TsigSecret: "d3Jvbmc="}}
+	if err := wrongKey.Init(); err == nil {
+		t.Errorf("Expected error with a wrong TSIG secret")
+	}
+
+	provider := &Rfc2136{Config: Rfc2136Config{Server: address, Zone: "example.com", TsigKeyName: "bbb-autoscaler", TsigSecret: testTsigSecret, DNSZoneOptions: s.DNSZoneOptions{Ttl: 60}}}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || record != nil {
+		t.Fatalf("Expected no record but got %v, %v", record, err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when updating a missing record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.2"}); err == nil {
+		t.Errorf("Expected error when creating an existing record")
+	}
+	if err := provider.CreateRecord("bbb-2", s.DNSRecordTypeA, []string{"fd00::2"}); err == nil {
+		t.Errorf("Expected error for an IPv6 address in an A record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeAAAA, []string{"fd00::1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.11", "10.0.0.12"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	expected := s.DNSRecord{Name: "bbb-1", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.11", "10.0.0.12"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || fmt.Sprint(record) != fmt.Sprint(&expected) {
+		t.Fatalf("Expected record %v but got %v, %v", expected, record, err)
+	}
+	// 2 A, 1 AAAA and 1 TXT record
+	if len(fake.records["bbb-1.example.com."]) != 4 {
+		t.Errorf("Expected the update to replace the A records but got %v", fake.records)
+	}
+
+	// Records created by others have no description
+	www, _ := dns.NewRR("www.example.com. 3600 IN A 10.0.0.80")
+	spf, _ := dns.NewRR(`bbb-1.example.com. 300 IN TXT "v=spf1 -all"`)
+	fake.records["www.example.com."] = []dns.RR{www}
+	fake.records["bbb-1.example.com."] = append(fake.records["bbb-1.example.com."], spf)
+	records, err := provider.ListRecords()
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name+string(records[i].Type) < records[j].Name+string(records[j].Type)
+	})
+	expectedRecords := []s.DNSRecord{
+		expected,
+		{Name: "bbb-1", Type: s.DNSRecordTypeAAAA, Ips: []string{"fd00::1"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true},
+		{Name: "www", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.80"}, Ttl: 3600},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(expectedRecords) {
+		t.Errorf("Expected %v but got %v", expectedRecords, records)
+	}
+
+	// Single IPs of a round robin record
+	for _, ip := range []string{"10.0.0.10", "10.0.0.11", "10.0.0.11"} {
+		if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, ip); err != nil {
+			t.Fatalf("Failed to add IP: %v", err)
+		}
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.10 10.0.0.11]" || !record.Managed {
+		t.Fatalf("Expected managed record with 2 IPs but got %v, %v", record, err)
+	}
+	for _, ip := range []string{"10.0.0.10", "10.0.0.11"} {
+		if err := provider.RemoveRecordIp("bbb", s.DNSRecordTypeA, ip); err != nil {
+			t.Fatalf("Failed to remove IP: %v", err)
+		}
+	}
+	if rrs, ok := fake.records["bbb.example.com."]; ok {
+		t.Errorf("Expected the TXT record to be deleted with the last IP but got %v", rrs)
+	}
+
+	// The description is kept until the last record of the name is deleted
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeAAAA); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if rrs := fake.records["bbb-1.example.com."]; len(rrs) != 1 || rrs[0] != spf {
+		t.Errorf("Expected only the foreign TXT record to be kept but got %v", rrs)
+	}
+	delete(fake.records, "bbb-1.example.com.")
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || record != nil {
+		t.Fatalf("Expected no record but got %v, %v", record, err)
+	}
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err == nil {
+		t.Errorf("Expected error when deleting a missing record")
+	}
+}
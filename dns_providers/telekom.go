@@ -11,11 +11,7 @@ import (
 	otc "github.com/opentelekomcloud/gophertelekomcloud"
 	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
 	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
-)
-
-const (
-	dnsRecordTypeA       string = "A"
-	dnsRecordDescription string = "BBB Autoscaler"
+	"golang.org/x/exp/slices"
 )
 
 // The DNS client we use to trigger our DNS actions.
@@ -63,89 +59,155 @@ func (dnsClient *OtcDnsClient) GetHostedZone(zoneName string) (*zones.Zone, erro
 // RecordSets
 // ===========================================================================
 
-// Get Recordset by DNS Name
-func (dnsClient *OtcDnsClient) GetARecordSet(zone *zones.Zone, dnsName string) *recordsets.RecordSet {
+// Get a RecordSet by DNS Name and type, nil if there is none
+func (dnsClient *OtcDnsClient) GetRecordSet(zone *zones.Zone, dnsName string, recordType string) (*recordsets.RecordSet, error) {
 	listOpts := recordsets.ListOpts{
-		Type: dnsRecordTypeA,
+		Type: recordType,
 		Name: dnsName,
 	}
 
 	allPages, err := recordsets.ListByZone(dnsClient.Sc, zone.ID, listOpts).AllPages()
 	if err != nil {
-		fmt.Printf("list records failed for dns entry %s: %s", dnsName, err)
-		return nil
+		return nil, fmt.Errorf("list records failed for dns entry %s: %s", dnsName, err)
 	}
 
 	allRRs, err := recordsets.ExtractRecordSets(allPages)
 	if err != nil {
-		fmt.Printf("extract recordset failed for dns entry %s: %s", dnsName, err)
-		return nil
+		return nil, fmt.Errorf("extract recordset failed for dns entry %s: %s", dnsName, err)
 	}
 
-	// Debug
-	//for _, rr := range allRRs {
-	//	fmt.Printf("%+v\n", rr)
-	//}
+	// The name filter matches partial names
+	matching := []recordsets.RecordSet{}
+	for _, rr := range allRRs {
+		if rr.Name == dnsName && rr.Type == recordType {
+			matching = append(matching, rr)
+		}
+	}
 
-	if len(allRRs) == 1 {
-		// We need exactly 1 recordset to operate on
-		return &allRRs[0]
-	} else if len(allRRs) == 0 {
+	if len(matching) == 0 {
 		// Query was successful, but no results
-		return nil
-	} else {
-		// More than 1 result.
-		fmt.Printf("query with %s returned %d recordsets. Expected: 1", dnsName, len(allRRs))
-		return nil
+		return nil, nil
+	} else if len(matching) > 1 {
+		// We need exactly 1 recordset to operate on
+		return nil, fmt.Errorf("query with %s returned %d recordsets. Expected: 1", dnsName, len(matching))
 	}
+	return &matching[0], nil
 }
 
-// Create new A DNS RecordSet with DNS Name and IP
-func (dnsClient *OtcDnsClient) CreateRecordSet(zone *zones.Zone, dnsName string, ipValue string) (*recordsets.RecordSet, error) {
+// List all RecordSets of a type in the zone
+func (dnsClient *OtcDnsClient) ListRecordSets(zone *zones.Zone, recordType string) ([]recordsets.RecordSet, error) {
+	listOpts := recordsets.ListOpts{
+		Type: recordType,
+	}
+
+	allPages, err := recordsets.ListByZone(dnsClient.Sc, zone.ID, listOpts).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("list records failed for zone %s: %s", zone.Name, err)
+	}
+
+	allRRs, err := recordsets.ExtractRecordSets(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("extract recordsets failed for zone %s: %s", zone.Name, err)
+	}
+	return allRRs, nil
+}
+
+// Create new DNS RecordSet with DNS Name and IPs
+func (dnsClient *OtcDnsClient) CreateRecordSet(zone *zones.Zone, dnsName string, recordType string, ipValues []string, ttl int, description string) (*recordsets.RecordSet, error) {
 
 	createOpts := recordsets.CreateOpts{
 		Name:        dnsName,
-		Description: dnsRecordDescription,
-		Type:        dnsRecordTypeA,
-		Records:     []string{ipValue},
-		TTL:         300,
+		Description: description,
+		Type:        recordType,
+		Records:     ipValues,
+		TTL:         ttl,
 	}
 
-	var pCreatedRecordset *recordsets.RecordSet
-	pCreatedRecordset, err := recordsets.Create(dnsClient.Sc, zone.ID, createOpts).Extract()
+	createdRecordSet, err := recordsets.Create(dnsClient.Sc, zone.ID, createOpts).Extract()
 	if err != nil {
-		fmt.Printf("Error creating DNS record: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("creation of record %s failed: %s", dnsName, err)
 	}
-	return pCreatedRecordset, nil
+	return createdRecordSet, nil
 }
 
-// Delete a RecordSet by DNS Name
-func (dnsClient *OtcDnsClient) DeleteRecordSet(zone *zones.Zone, dnsName string) error {
+// Delete a RecordSet by DNS Name and type
+func (dnsClient *OtcDnsClient) DeleteRecordSet(zone *zones.Zone, dnsName string, recordType string) error {
 	//get DNS details
-	recordSet := dnsClient.GetARecordSet(zone, dnsName)
-	//Call delete function
-	err := recordsets.Delete(dnsClient.Sc, zone.ID, recordSet.ID).ExtractErr()
+	recordSet, err := dnsClient.GetRecordSet(zone, dnsName, recordType)
 	if err != nil {
-		fmt.Printf("deletion of record with zoneId %s and recordsetId %s failed: %s", zone.ID, recordSet.ID, err)
 		return err
 	}
+	if recordSet == nil {
+		return fmt.Errorf("record %s of type %s not found", dnsName, recordType)
+	}
+	//Call delete function
+	err = recordsets.Delete(dnsClient.Sc, zone.ID, recordSet.ID).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("deletion of record with zoneId %s and recordsetId %s failed: %s", zone.ID, recordSet.ID, err)
+	}
 	return nil
 }
 
-// Updating a RecordSet IP by DNS Name TODO cant use the same client?
-func (dnsClient *OtcDnsClient) UpdateRecordSet(zone *zones.Zone, dnsName string, newIPValue string) (*recordsets.RecordSet, error) {
+// Replace the IPs of a RecordSet by DNS Name and type, along with its TTL and description
+func (dnsClient *OtcDnsClient) UpdateRecordSet(zone *zones.Zone, dnsName string, recordType string, newIPValues []string, ttl int, description string) (*recordsets.RecordSet, error) {
 	//get DNS details
-	recordSet := dnsClient.GetARecordSet(zone, dnsName)
+	recordSet, err := dnsClient.GetRecordSet(zone, dnsName, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if recordSet == nil {
+		return nil, fmt.Errorf("record %s of type %s not found", dnsName, recordType)
+	}
+	return dnsClient.updateRecordSet(zone, recordSet, newIPValues, ttl, description)
+}
 
+func (dnsClient *OtcDnsClient) updateRecordSet(zone *zones.Zone, recordSet *recordsets.RecordSet, newIPValues []string, ttl int, description string) (*recordsets.RecordSet, error) {
 	updateOpts := recordsets.UpdateOpts{
-		Records: []string{newIPValue},
+		Description: description,
+		Records:     newIPValues,
+		TTL:         ttl,
 	}
 
 	updatedRecordSet, err := recordsets.Update(dnsClient.Sc, zone.ID, recordSet.ID, updateOpts).Extract()
 	if err != nil {
-		fmt.Printf("Error updating DNS record: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("update of record %s failed: %s", recordSet.Name, err)
 	}
 	return updatedRecordSet, nil
 }
+
+// Add an IP to a RecordSet by DNS Name and type, the RecordSet is created if there is none
+func (dnsClient *OtcDnsClient) AddRecordSetIp(zone *zones.Zone, dnsName string, recordType string, ipValue string, ttl int, description string) error {
+	recordSet, err := dnsClient.GetRecordSet(zone, dnsName, recordType)
+	if err != nil {
+		return err
+	}
+	if recordSet == nil {
+		_, err := dnsClient.CreateRecordSet(zone, dnsName, recordType, []string{ipValue}, ttl, description)
+		return err
+	}
+	if slices.Contains(recordSet.Records, ipValue) {
+		return nil
+	}
+	_, err = dnsClient.updateRecordSet(zone, recordSet, append(recordSet.Records, ipValue), ttl, description)
+	return err
+}
+
+// Remove an IP from a RecordSet by DNS Name and type, the RecordSet is deleted with its last IP
+func (dnsClient *OtcDnsClient) RemoveRecordSetIp(zone *zones.Zone, dnsName string, recordType string, ipValue string, ttl int, description string) error {
+	recordSet, err := dnsClient.GetRecordSet(zone, dnsName, recordType)
+	if err != nil {
+		return err
+	}
+	if recordSet == nil || !slices.Contains(recordSet.Records, ipValue) {
+		return nil
+	}
+	remaining := slices.DeleteFunc(slices.Clone(recordSet.Records), func(ip string) bool { return ip == ipValue })
+	if len(remaining) == 0 {
+		if err := recordsets.Delete(dnsClient.Sc, zone.ID, recordSet.ID).ExtractErr(); err != nil {
+			return fmt.Errorf("deletion of record with zoneId %s and recordsetId %s failed: %s", zone.ID, recordSet.ID, err)
+		}
+		return nil
+	}
+	_, err = dnsClient.updateRecordSet(zone, recordSet, remaining, ttl, description)
+	return err
+}
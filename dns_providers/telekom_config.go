@@ -96,7 +96,12 @@ func getProviderClientProfile(otcProfileName string) (*otc.ProviderClient, error
 // Creates a new DNSv2 ServiceClient.
 // See also gophertelekomcloud/acceptance/clients/clients.go
 func NewDNSV2Client() (*OtcDnsClient, error) {
-	cloudsConfig, err := getCloud()
+	return NewDNSV2ClientProfile(OtcProfileNameUser)
+}
+
+// Creates a new DNSv2 ServiceClient with the given clouds.yaml profile or OS_ environment.
+func NewDNSV2ClientProfile(otcProfileName string) (*OtcDnsClient, error) {
+	cloudsConfig, err := getCloudProfile(otcProfileName)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +109,7 @@ func NewDNSV2Client() (*OtcDnsClient, error) {
 		Region: cloudsConfig.RegionName,
 	}
 
-	providerClient, err := getProviderClient()
+	providerClient, err := getProviderClientProfile(otcProfileName)
 	if err != nil {
 		return nil, err
 	}
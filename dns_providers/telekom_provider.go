@@ -0,0 +1,127 @@
+// DNSProvider implementation on top of the OTC DNS client
+package dns_providers
+
+import (
+	"fmt"
+	s "scaler/shared"
+	"strings"
+
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+)
+
+type OtcDnsConfig struct {
+	// Name of the zone holding the records, e.g. example.com
+	Zone string `yaml:"zone"`
+	// Profile of clouds.yaml or of the OS_ environment variables, defaults to otcuser
+	Profile          string `yaml:"profile"`
+	s.DNSZoneOptions `yaml:",inline"`
+}
+
+type Otc struct {
+	Config OtcDnsConfig `yaml:"otc_dns_config"`
+	client *OtcDnsClient
+	zone   *zones.Zone
+}
+
+func (o Otc) Validate() error {
+	if o.Config.Zone == "" {
+		return fmt.Errorf("otc_dns.zone is empty")
+	}
+	if err := o.Config.DNSZoneOptions.Validate(); err != nil {
+		return fmt.Errorf("otc_dns.%s", err)
+	}
+	return nil
+}
+
+func (o *Otc) Init() error {
+	profile := o.Config.Profile
+	if profile == "" {
+		profile = OtcProfileNameUser
+	}
+	client, err := NewDNSV2ClientProfile(profile)
+	if err != nil {
+		return fmt.Errorf("error while creating otc dns client: %s", err)
+	}
+	zone, err := client.GetHostedZone(o.zoneName())
+	if err != nil {
+		return err
+	}
+	o.client = client
+	o.zone = zone
+	return nil
+}
+
+// OTC zone names end with a dot
+func (o Otc) zoneName() string {
+	return strings.TrimSuffix(o.Config.Zone, ".") + "."
+}
+
+func (o Otc) fqdn(name string) string {
+	return name + "." + o.zoneName()
+}
+
+func (o Otc) toRecord(recordSet recordsets.RecordSet) s.DNSRecord {
+	return s.DNSRecord{
+		Name:        strings.TrimSuffix(strings.TrimSuffix(recordSet.Name, o.zoneName()), "."),
+		Type:        s.DNSRecordType(recordSet.Type),
+		Ips:         recordSet.Records,
+		Ttl:         recordSet.TTL,
+		Description: recordSet.Description,
+		Managed:     recordSet.Description == o.Config.GetDescription(),
+	}
+}
+
+func (o Otc) ListRecords() ([]s.DNSRecord, error) {
+	records := []s.DNSRecord{}
+	for _, recordType := range []s.DNSRecordType{s.DNSRecordTypeA, s.DNSRecordTypeAAAA} {
+		recordSets, err := o.client.ListRecordSets(o.zone, string(recordType))
+		if err != nil {
+			return nil, err
+		}
+		for _, recordSet := range recordSets {
+			records = append(records, o.toRecord(recordSet))
+		}
+	}
+	return records, nil
+}
+
+func (o Otc) GetRecord(name string, recordType s.DNSRecordType) (*s.DNSRecord, error) {
+	recordSet, err := o.client.GetRecordSet(o.zone, o.fqdn(name), string(recordType))
+	if err != nil || recordSet == nil {
+		return nil, err
+	}
+	record := o.toRecord(*recordSet)
+	return &record, nil
+}
+
+func (o Otc) CreateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	_, err := o.client.CreateRecordSet(o.zone, o.fqdn(name), string(recordType), ips, o.Config.GetTtl(), o.Config.GetDescription())
+	return err
+}
+
+func (o Otc) UpdateRecord(name string, recordType s.DNSRecordType, ips []string) error {
+	if err := recordType.ValidateIps(ips); err != nil {
+		return err
+	}
+	_, err := o.client.UpdateRecordSet(o.zone, o.fqdn(name), string(recordType), ips, o.Config.GetTtl(), o.Config.GetDescription())
+	return err
+}
+
+func (o Otc) DeleteRecord(name string, recordType s.DNSRecordType) error {
+	return o.client.DeleteRecordSet(o.zone, o.fqdn(name), string(recordType))
+}
+
+func (o Otc) AddRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	if err := recordType.ValidateIps([]string{ip}); err != nil {
+		return err
+	}
+	return o.client.AddRecordSetIp(o.zone, o.fqdn(name), string(recordType), ip, o.Config.GetTtl(), o.Config.GetDescription())
+}
+
+func (o Otc) RemoveRecordIp(name string, recordType s.DNSRecordType, ip string) error {
+	return o.client.RemoveRecordSetIp(o.zone, o.fqdn(name), string(recordType), ip, o.Config.GetTtl(), o.Config.GetDescription())
+}
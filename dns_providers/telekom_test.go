@@ -0,0 +1,177 @@
+package dns_providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"strings"
+	"sync"
+	"testing"
+
+	golangsdk "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+)
+
+func TestValidateOtc(t *testing.T) {
+	s.ValidatePass(t, Otc{Config: OtcDnsConfig{Zone: "example.com"}})
+	s.ValidatePass(t, Otc{Config: OtcDnsConfig{Zone: "example.com", DNSZoneOptions: s.DNSZoneOptions{Ttl: 60, Description: "Autoscaler"}}})
+	s.ValidateFail(t, Otc{})
+	s.ValidateFail(t, Otc{Config: OtcDnsConfig{Zone: "example.com", DNSZoneOptions: s.DNSZoneOptions{Ttl: -1}}})
+}
+
+// In-memory fake of the recordsets endpoints of the OTC DNS API for a single zone
+type fakeOtcDnsApi struct {
+	mutex      sync.Mutex
+	recordSets []recordsets.RecordSet
+	nextId     int
+}
+
+func newFakeOtcDnsApi(t *testing.T) (*fakeOtcDnsApi, *httptest.Server) {
+	api := &fakeOtcDnsApi{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mutex.Lock()
+		defer api.mutex.Unlock()
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodGet:
+			items := []recordsets.RecordSet{}
+			for _, recordSet := range api.recordSets {
+				if strings.Contains(recordSet.Name, r.URL.Query().Get("name")) && recordSet.Type == r.URL.Query().Get("type") {
+					items = append(items, recordSet)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"recordsets": items})
+		case len(parts) == 3 && r.Method == http.MethodPost:
+			var recordSet recordsets.RecordSet
+			json.NewDecoder(r.Body).Decode(&recordSet)
+			api.nextId++
+			recordSet.ID = fmt.Sprintf("recordset-%d", api.nextId)
+			api.recordSets = append(api.recordSets, recordSet)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(recordSet)
+		case len(parts) == 4:
+			for i, recordSet := range api.recordSets {
+				if recordSet.ID != parts[3] {
+					continue
+				}
+				if r.Method == http.MethodDelete {
+					api.recordSets = append(api.recordSets[:i], api.recordSets[i+1:]...)
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				var update recordsets.UpdateOpts
+				json.NewDecoder(r.Body).Decode(&update)
+				api.recordSets[i].Records = update.Records
+				if update.TTL > 0 {
+					api.recordSets[i].TTL = update.TTL
+				}
+				if update.Description != "" {
+					api.recordSets[i].Description = update.Description
+				}
+				json.NewEncoder(w).Encode(api.recordSets[i])
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return api, server
+}
+
+func TestOtc(t *testing.T) {
+	api, server := newFakeOtcDnsApi(t)
+	defer server.Close()
+	client := &OtcDnsClient{Sc: &golangsdk.ServiceClient{ProviderClient: &golangsdk.ProviderClient{}, Endpoint: server.URL + "/"}}
+	provider := &Otc{Config: OtcDnsConfig{Zone: "example.com", DNSZoneOptions: s.DNSZoneOptions{Ttl: 60}}, client: client, zone: &zones.Zone{ID: "zone-0", Name: "example.com."}}
+
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || record != nil {
+		t.Fatalf("Expected no record but got %v, %v", record, err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error when updating a missing record")
+	}
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err == nil {
+		t.Errorf("Expected error when deleting a missing record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeAAAA, []string{"10.0.0.1"}); err == nil {
+		t.Errorf("Expected error for an IPv4 address in an AAAA record")
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.CreateRecord("bbb-10", s.DNSRecordTypeA, []string{"10.0.0.10"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.CreateRecord("bbb-1", s.DNSRecordTypeAAAA, []string{"fd00::1"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.11", "10.0.0.12"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	expected := s.DNSRecord{Name: "bbb-1", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.11", "10.0.0.12"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || fmt.Sprint(record) != fmt.Sprint(&expected) {
+		t.Fatalf("Expected record %v but got %v, %v", expected, record, err)
+	}
+
+	// Records created by others have another description
+	api.recordSets = append(api.recordSets, recordsets.RecordSet{ID: "www", Name: "www.example.com.", Type: "A", Records: []string{"10.0.0.80"}, TTL: 3600})
+	records, err := provider.ListRecords()
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	expectedRecords := []s.DNSRecord{
+		expected,
+		{Name: "bbb-10", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.10"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true},
+		{Name: "www", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.80"}, Ttl: 3600},
+		{Name: "bbb-1", Type: s.DNSRecordTypeAAAA, Ips: []string{"fd00::1"}, Ttl: 60, Description: s.DNSRecordDescription, Managed: true},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(expectedRecords) {
+		t.Errorf("Expected %v but got %v", expectedRecords, records)
+	}
+
+	// Single IPs of a round robin record
+	for _, ip := range []string{"10.0.0.10", "10.0.0.11", "10.0.0.11"} {
+		if err := provider.AddRecordIp("bbb", s.DNSRecordTypeA, ip); err != nil {
+			t.Fatalf("Failed to add IP: %v", err)
+		}
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record == nil || fmt.Sprint(record.Ips) != "[10.0.0.10 10.0.0.11]" || !record.Managed {
+		t.Fatalf("Expected managed record with 2 IPs but got %v, %v", record, err)
+	}
+	for _, ip := range []string{"10.0.0.10", "10.0.0.99", "10.0.0.11"} {
+		if err := provider.RemoveRecordIp("bbb", s.DNSRecordTypeA, ip); err != nil {
+			t.Fatalf("Failed to remove IP: %v", err)
+		}
+	}
+	if record, err := provider.GetRecord("bbb", s.DNSRecordTypeA); err != nil || record != nil {
+		t.Fatalf("Expected the record to be deleted with the last IP but got %v, %v", record, err)
+	}
+
+	// Updates apply the TTL and description of the zone
+	provider.Config.DNSZoneOptions = s.DNSZoneOptions{Ttl: 120, Description: "Autoscaler"}
+	if err := provider.UpdateRecord("bbb-1", s.DNSRecordTypeA, []string{"10.0.0.11"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	expected = s.DNSRecord{Name: "bbb-1", Type: s.DNSRecordTypeA, Ips: []string{"10.0.0.11"}, Ttl: 120, Description: "Autoscaler", Managed: true}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err != nil || fmt.Sprint(record) != fmt.Sprint(&expected) {
+		t.Fatalf("Expected record %v but got %v, %v", expected, record, err)
+	}
+
+	if err := provider.DeleteRecord("bbb-1", s.DNSRecordTypeA); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if record, err := provider.GetRecord("bbb-1", s.DNSRecordTypeAAAA); err != nil || record == nil {
+		t.Fatalf("Expected the AAAA record to be kept but got %v, %v", record, err)
+	}
+
+	// API errors are returned
+	server.Close()
+	if _, err := provider.GetRecord("bbb-1", s.DNSRecordTypeA); err == nil {
+		t.Errorf("Expected error when the API is unavailable")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"os"
 	c "scaler/core"
 
 	"golang.org/x/exp/slog"
@@ -9,12 +10,19 @@ import (
 
 func main() {
 	configPath := flag.String("config", "config/scaler_config.yml", "path to config file")
+	dnsDiff := flag.Bool("dns-diff", false, "print the changes to the DNS records and exit")
 	flag.Parse()
 
 	app, err := c.InitApp(*configPath)
 	if err != nil {
 		panic(err)
 	}
+	if *dnsDiff {
+		if err := app.WriteDNSDiff(os.Stdout); err != nil {
+			panic(err)
+		}
+		return
+	}
 	go app.Scale()
 	slog.Error(app.ServeMetrics().Error())
 }
@@ -0,0 +1,180 @@
+package metricssource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"golang.org/x/exp/slog"
+)
+
+// Aggregation of a usage reading over a window instead of the instant value, so a single spike does not trigger scaling
+type Aggregation struct {
+	// last, avg, max, quantile or ewma
+	Function      string `yaml:"function"`
+	WindowSeconds int    `yaml:"window_seconds"`
+	// Resolution of the samples in the window
+	StepSeconds int `yaml:"step_seconds"`
+	// Quantile for the quantile function, defaults to 0.95
+	Quantile float64 `yaml:"quantile"`
+	// Weight of the newest sample for the ewma function, defaults to 0.3
+	Alpha float64 `yaml:"alpha"`
+}
+
+// Aggregation per resource, a missing aggregation uses the instant value
+// The aggregate is the usage of the resource for all the rules of a service, scale-up and scale-down rules alike,
+// since a metrics source returns a single usage per resource. A max or high quantile makes scale-ups quicker
+// and scale-downs slower, an avg or ewma does the opposite.
+type Aggregations struct {
+	Cpu    *Aggregation `yaml:"cpu"`
+	Memory *Aggregation `yaml:"memory"`
+}
+
+const (
+	AggregationLast     = "last"
+	AggregationAvg      = "avg"
+	AggregationMax      = "max"
+	AggregationQuantile = "quantile"
+	AggregationEwma     = "ewma"
+)
+
+const (
+	defaultAggregationStepSeconds = 30
+	defaultAggregationQuantile    = 0.95
+	defaultAggregationAlpha       = 0.3
+)
+
+func (a Aggregation) step() time.Duration {
+	if a.StepSeconds == 0 {
+		return defaultAggregationStepSeconds * time.Second
+	}
+	return time.Duration(a.StepSeconds) * time.Second
+}
+
+func (a Aggregation) quantile() float64 {
+	if a.Quantile == 0 {
+		return defaultAggregationQuantile
+	}
+	return a.Quantile
+}
+
+func (a Aggregation) alpha() float64 {
+	if a.Alpha == 0 {
+		return defaultAggregationAlpha
+	}
+	return a.Alpha
+}
+
+// Wraps a query in a subquery aggregating it over the window, the ewma is computed locally instead
+func (a Aggregation) wrap(query string) string {
+	subquery := fmt.Sprintf("(%s)[%ds:%ds]", query, a.WindowSeconds, int(a.step().Seconds()))
+	switch a.Function {
+	case AggregationAvg:
+		return fmt.Sprintf("avg_over_time(%s)", subquery)
+	case AggregationMax:
+		return fmt.Sprintf("max_over_time(%s)", subquery)
+	case AggregationQuantile:
+		return fmt.Sprintf("quantile_over_time(%g, %s)", a.quantile(), subquery)
+	default:
+		return query
+	}
+}
+
+// Computes the exponentially weighted moving average of the samples, from the oldest to the newest
+func ewma(values []float64, alpha float64) float64 {
+	average := values[0]
+	for _, value := range values[1:] {
+		average = alpha*value + (1-alpha)*average
+	}
+	return average
+}
+
+// Runs a query aggregated over the window, without aggregation the instant value is returned
+func (p *Prometheus) QueryAggregated(query string, aggregation *Aggregation) (float32, error) {
+	if aggregation == nil || aggregation.Function == "" || aggregation.Function == AggregationLast {
+		return p.Query(query)
+	}
+	if aggregation.Function != AggregationEwma {
+		return p.Query(aggregation.wrap(query))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
+	defer cancel()
+	now := time.Now()
+	queryRange := v1.Range{
+		Start: now.Add(-time.Duration(aggregation.WindowSeconds) * time.Second),
+		End:   now,
+		Step:  aggregation.step(),
+	}
+	result, warnings, err := p.API.QueryRange(ctx, query, queryRange, v1.WithTimeout(timeout))
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	if len(warnings) > 0 {
+		slog.Warn(fmt.Sprintf("Warnings: %v\n", warnings))
+	}
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		p.errorsTotalCounter.Inc()
+		return 0, fmt.Errorf("unexpected type: %v", result.Type())
+	}
+	if len(matrix) > 1 {
+		slog.Warn(fmt.Sprintf("Unexpected matrix length: %v\n", len(matrix)))
+	}
+	averages := []float64{}
+	for _, series := range matrix {
+		if len(series.Values) == 0 {
+			continue
+		}
+		values := make([]float64, len(series.Values))
+		for i, sample := range series.Values {
+			values[i] = float64(sample.Value)
+		}
+		averages = append(averages, ewma(values, aggregation.alpha()))
+	}
+	value, err := p.PrometheusConfig.Checks.combine(averages)
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+	}
+	return value, err
+}
+
+func (a Aggregation) Validate() error {
+	switch a.Function {
+	case AggregationLast:
+		return nil
+	case AggregationAvg, AggregationMax, AggregationQuantile, AggregationEwma:
+	default:
+		return fmt.Errorf("aggregation function %s is not supported", a.Function)
+	}
+	if a.WindowSeconds <= 0 {
+		return fmt.Errorf("aggregation window_seconds must be greater than 0 but got %d", a.WindowSeconds)
+	}
+	if a.StepSeconds < 0 || a.StepSeconds > a.WindowSeconds {
+		return fmt.Errorf("aggregation step_seconds must be between 0 and window_seconds (%d) but got %d", a.WindowSeconds, a.StepSeconds)
+	}
+	if a.Quantile < 0 || a.Quantile > 1 {
+		return fmt.Errorf("aggregation quantile must be between 0 and 1 but got %f", a.Quantile)
+	}
+	if a.Alpha < 0 || a.Alpha > 1 {
+		return fmt.Errorf("aggregation alpha must be between 0 and 1 but got %f", a.Alpha)
+	}
+	return nil
+}
+
+func (a Aggregations) Validate() error {
+	if a.Cpu != nil {
+		if err := a.Cpu.Validate(); err != nil {
+			return fmt.Errorf("prometheus.aggregations.cpu is invalid: %s", err)
+		}
+	}
+	if a.Memory != nil {
+		if err := a.Memory.Validate(); err != nil {
+			return fmt.Errorf("prometheus.aggregations.memory is invalid: %s", err)
+		}
+	}
+	return nil
+}
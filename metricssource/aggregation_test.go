@@ -0,0 +1,95 @@
+package metricssource
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"testing"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestValidateAggregation(t *testing.T) {
+	s.ValidatePass(t, Aggregation{Function: AggregationLast})
+	s.ValidatePass(t, Aggregation{Function: AggregationQuantile, WindowSeconds: 300, Quantile: 0.9})
+	s.ValidateFail(t, Aggregation{Function: "median", WindowSeconds: 300})
+	s.ValidateFail(t, Aggregation{Function: AggregationAvg})
+	s.ValidateFail(t, Aggregation{Function: AggregationAvg, WindowSeconds: 60, StepSeconds: 120})
+	s.ValidateFail(t, Aggregation{Function: AggregationEwma, WindowSeconds: 300, Alpha: 1.5})
+
+	prometheus := &Prometheus{
+		PrometheusConfig: PrometheusConfig{
+			Url:          "https://prometheus.example.com",
+			Aggregations: Aggregations{Memory: &Aggregation{Function: AggregationMax}},
+		},
+	}
+	s.ValidateFail(t, prometheus)
+}
+
+func TestWrapAggregation(t *testing.T) {
+	query := `node_load1{instance="bbb"}`
+	tests := []struct {
+		aggregation Aggregation
+		expected    string
+	}{
+		{Aggregation{Function: AggregationAvg, WindowSeconds: 300}, `avg_over_time((node_load1{instance="bbb"})[300s:30s])`},
+		{Aggregation{Function: AggregationMax, WindowSeconds: 120, StepSeconds: 10}, `max_over_time((node_load1{instance="bbb"})[120s:10s])`},
+		{Aggregation{Function: AggregationQuantile, WindowSeconds: 600}, `quantile_over_time(0.95, (node_load1{instance="bbb"})[600s:30s])`},
+	}
+	for _, test := range tests {
+		if got := test.aggregation.wrap(query); got != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, got)
+		}
+	}
+}
+
+func TestEwma(t *testing.T) {
+	// A single spike at the end only moves the average by alpha
+	got := ewma([]float64{0.2, 0.2, 0.2, 1}, 0.25)
+	if math.Abs(got-0.4) > 1e-9 {
+		t.Fatalf("Expected 0.4 but got %f", got)
+	}
+}
+
+// Fake Prometheus API answering instant and range queries
+func TestQueryAggregated(t *testing.T) {
+	var lastQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		lastQuery = r.Form.Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/query":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.5"]}]}}`))
+		case "/api/v1/query_range":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,"0.2"],[1700000030,"0.2"],[1700000060,"0.2"],[1700000090,"1"]]}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	prometheus := &Prometheus{API: v1.NewAPI(client)}
+
+	value, err := prometheus.QueryAggregated("up", &Aggregation{Function: AggregationAvg, WindowSeconds: 300})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if value != 0.5 || lastQuery != "avg_over_time((up)[300s:30s])" {
+		t.Fatalf("Unexpected value %f for query %s", value, lastQuery)
+	}
+
+	value, err = prometheus.QueryAggregated("up", &Aggregation{Function: AggregationEwma, WindowSeconds: 90, Alpha: 0.25})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if math.Abs(float64(value)-0.4) > 1e-6 || lastQuery != "up" {
+		t.Fatalf("Unexpected value %f for query %s", value, lastQuery)
+	}
+}
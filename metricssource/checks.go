@@ -0,0 +1,109 @@
+package metricssource
+
+import (
+	"fmt"
+	"math"
+	s "scaler/shared"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Sanity checks applied to every reading
+type ReadingChecks struct {
+	// Maximum age of the newest raw sample behind a reading, 0 disables the check
+	// Prometheus drops series that stopped reporting after its staleness period, this catches old responses, e.g. from caching proxies
+	MaxSampleAgeSeconds int `yaml:"max_sample_age_seconds"`
+	// What to do when a query returns several series: error, avg or max
+	// Duplicate series can occur if Prometheus has multiple jobs with the same targets
+	MultipleSeries string `yaml:"multiple_series"`
+}
+
+const (
+	MultipleSeriesError = "error"
+	MultipleSeriesAvg   = "avg"
+	MultipleSeriesMax   = "max"
+)
+
+// Invalid readings are counted by the source returning them
+func invalidReading(format string, args ...interface{}) error {
+	return &s.InvalidReadingError{Reason: fmt.Sprintf(format, args...)}
+}
+
+func (c ReadingChecks) multipleSeries() string {
+	if c.MultipleSeries == "" {
+		return MultipleSeriesMax
+	}
+	return c.MultipleSeries
+}
+
+func (c ReadingChecks) checkAge(timestamp, now time.Time) error {
+	maxAge := time.Duration(c.MaxSampleAgeSeconds) * time.Second
+	if age := now.Sub(timestamp); c.MaxSampleAgeSeconds > 0 && age > maxAge {
+		return invalidReading("sample is %s old, more than %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// Reduces the values of several series to one reading according to the policy
+func (c ReadingChecks) combine(values []float64) (float32, error) {
+	if len(values) == 0 {
+		return 0, invalidReading("no data found")
+	}
+	for _, value := range values {
+		if err := checkUsage(value); err != nil {
+			return 0, err
+		}
+	}
+	if len(values) == 1 {
+		return float32(values[0]), nil
+	}
+	switch c.multipleSeries() {
+	case MultipleSeriesAvg:
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return float32(sum / float64(len(values))), nil
+	case MultipleSeriesMax:
+		max := values[0]
+		for _, value := range values[1:] {
+			max = math.Max(max, value)
+		}
+		return float32(max), nil
+	default:
+		return 0, invalidReading("query returned %d series instead of 1", len(values))
+	}
+}
+
+// The sample timestamps of instant query results are the evaluation time, their age is checked separately
+func (c ReadingChecks) checkVector(vector model.Vector) (float32, error) {
+	values := make([]float64, 0, len(vector))
+	for _, sample := range vector {
+		values = append(values, float64(sample.Value))
+	}
+	return c.combine(values)
+}
+
+// Usage readings are ratios
+func checkUsage(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return invalidReading("value is %f", value)
+	}
+	if value < 0 || value > 1 {
+		return invalidReading("value %f is outside [0, 1]", value)
+	}
+	return nil
+}
+
+func (c ReadingChecks) Validate() error {
+	if c.MaxSampleAgeSeconds < 0 {
+		return fmt.Errorf("checks.max_sample_age_seconds must be greater than or equal to 0 but got %d", c.MaxSampleAgeSeconds)
+	}
+	switch c.multipleSeries() {
+	case MultipleSeriesError, MultipleSeriesAvg, MultipleSeriesMax:
+		return nil
+	default:
+		return fmt.Errorf("checks.multiple_series must be %s, %s or %s but got %s", MultipleSeriesError, MultipleSeriesAvg, MultipleSeriesMax, c.MultipleSeries)
+	}
+}
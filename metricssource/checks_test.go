@@ -0,0 +1,118 @@
+package metricssource
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestValidateReadingChecks(t *testing.T) {
+	s.ValidatePass(t, ReadingChecks{})
+	s.ValidatePass(t, ReadingChecks{MaxSampleAgeSeconds: 120, MultipleSeries: MultipleSeriesError})
+	s.ValidateFail(t, ReadingChecks{MaxSampleAgeSeconds: -1})
+	s.ValidateFail(t, ReadingChecks{MultipleSeries: "first"})
+}
+
+func TestCheckVector(t *testing.T) {
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	sample := func(value float64) *model.Sample {
+		return &model.Sample{Value: model.SampleValue(value), Timestamp: model.TimeFromUnixNano(now.UnixNano())}
+	}
+
+	tests := []struct {
+		name     string
+		checks   ReadingChecks
+		vector   model.Vector
+		expected float32
+		valid    bool
+	}{
+		{"single", ReadingChecks{}, model.Vector{sample(0.4)}, 0.4, true},
+		{"empty", ReadingChecks{}, model.Vector{}, 0, false},
+		{"max of duplicates", ReadingChecks{}, model.Vector{sample(0.4), sample(0.6)}, 0.6, true},
+		{"avg of duplicates", ReadingChecks{MultipleSeries: MultipleSeriesAvg}, model.Vector{sample(0.4), sample(0.6)}, 0.5, true},
+		{"error on duplicates", ReadingChecks{MultipleSeries: MultipleSeriesError}, model.Vector{sample(0.4), sample(0.6)}, 0, false},
+		{"NaN", ReadingChecks{}, model.Vector{sample(math.NaN())}, 0, false},
+		{"Inf", ReadingChecks{}, model.Vector{sample(math.Inf(1))}, 0, false},
+		{"above 1", ReadingChecks{}, model.Vector{sample(1.2)}, 0, false},
+		{"below 0", ReadingChecks{}, model.Vector{sample(-0.1)}, 0, false},
+	}
+	for _, test := range tests {
+		value, err := test.checks.checkVector(test.vector)
+		if test.valid {
+			if err != nil || math.Abs(float64(value-test.expected)) > 1e-6 {
+				t.Errorf("%s: expected %f but got %f, %v", test.name, test.expected, value, err)
+			}
+			continue
+		}
+		var invalidReading *s.InvalidReadingError
+		if !errors.As(err, &invalidReading) {
+			t.Errorf("%s: expected an invalid reading error but got %v", test.name, err)
+		}
+	}
+}
+
+// Fake Prometheus API evaluating the usage now while the samples behind it are old
+func TestCheckSampleAge(t *testing.T) {
+	var sampleTime time.Time
+	var lastQueries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		query := r.Form.Get("query")
+		lastQueries = append(lastQueries, query)
+		now := time.Now().Unix()
+		value := "0.5"
+		if strings.Contains(query, "timestamp(") {
+			value = fmt.Sprint(sampleTime.Unix())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%d,"%s"]}]}}`, now, value)
+	}))
+	defer server.Close()
+
+	prometheus := &Prometheus{PrometheusConfig: PrometheusConfig{Url: server.URL, Checks: ReadingChecks{MaxSampleAgeSeconds: 60}}}
+	if err := prometheus.Init(); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	object := &s.Server{ServerName: "bbb.example.com"}
+
+	sampleTime = time.Now().Add(-10 * time.Second)
+	value, err := prometheus.GetCpuUsage(object)
+	if err != nil || value != 0.5 {
+		t.Fatalf("Expected 0.5 but got %f, %v", value, err)
+	}
+	if lastQueries[0] != `max(timestamp(node_cpu_seconds_total{mode="idle",instance=~"bbb.example.com"}))` {
+		t.Fatalf("Unexpected sample time query %s", lastQueries[0])
+	}
+
+	sampleTime = time.Now().Add(-5 * time.Minute)
+	_, err = prometheus.GetCpuUsage(object)
+	var invalidReading *s.InvalidReadingError
+	if !errors.As(err, &invalidReading) {
+		t.Fatalf("Expected an invalid reading error but got %v", err)
+	}
+
+	// Customized usage queries need their own sample time query
+	prometheus.PrometheusConfig.Queries.ServerMemory = `node_memory_usage{instance="{{ .ServerName }}"}`
+	s.ValidateFail(t, prometheus)
+	prometheus.PrometheusConfig.Queries.ServerSampleTime = `timestamp(node_memory_usage{instance="{{ .ServerName }}"})`
+	prometheus.PrometheusConfig.Queries.ClusterSampleTime = `max(timestamp(node_memory_usage))`
+	s.ValidatePass(t, prometheus)
+	if err := prometheus.Init(); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	lastQueries = nil
+	if _, err = prometheus.GetMemoryUsage(object); !errors.As(err, &invalidReading) {
+		t.Fatalf("Expected an invalid reading error but got %v", err)
+	}
+	if lastQueries[0] != `timestamp(node_memory_usage{instance="bbb.example.com"})` {
+		t.Fatalf("Unexpected sample time query %s", lastQueries[0])
+	}
+}
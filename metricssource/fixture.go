@@ -0,0 +1,138 @@
+package metricssource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Records the API responses to a file, or replays them from the file without network access
+type FixtureConfig struct {
+	// record or replay
+	Mode string `yaml:"mode"`
+	File string `yaml:"file"`
+}
+
+const (
+	FixtureRecord = "record"
+	FixtureReplay = "replay"
+)
+
+type fixtureResponse struct {
+	StatusCode int    `json:"status_code"`
+	Body       string `json:"body"`
+}
+
+type fixtureRoundTripper struct {
+	config    FixtureConfig
+	next      http.RoundTripper
+	mutex     sync.Mutex
+	responses map[string]fixtureResponse
+}
+
+// Parameters that change with every request and are left out of the fixture key
+var volatileFixtureParameters = map[string]bool{"time": true, "start": true, "end": true, "timeout": true}
+
+func newFixtureRoundTripper(config FixtureConfig, next http.RoundTripper) (*fixtureRoundTripper, error) {
+	rt := &fixtureRoundTripper{config: config, next: next, responses: make(map[string]fixtureResponse)}
+	raw, err := os.ReadFile(config.File)
+	if os.IsNotExist(err) && config.Mode == FixtureRecord {
+		return rt, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading fixture file: %s", err)
+	}
+	if err := json.Unmarshal(raw, &rt.responses); err != nil {
+		return nil, fmt.Errorf("error while parsing fixture file: %s", err)
+	}
+	return rt, nil
+}
+
+// Identifies a request by its path and its stable parameters, from the query string or the form body
+func fixtureKey(request *http.Request) (string, error) {
+	parameters := request.URL.Query()
+	if request.Body != nil {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return "", err
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", err
+		}
+		for name, values := range form {
+			parameters[name] = append(parameters[name], values...)
+		}
+	}
+	keys := []string{}
+	for name, values := range parameters {
+		if volatileFixtureParameters[name] {
+			continue
+		}
+		for _, value := range values {
+			keys = append(keys, name+"="+value)
+		}
+	}
+	sort.Strings(keys)
+	return request.URL.Path + "?" + strings.Join(keys, "&"), nil
+}
+
+func (rt *fixtureRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	key, err := fixtureKey(request)
+	if err != nil {
+		return nil, err
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	if rt.config.Mode == FixtureReplay {
+		recorded, ok := rt.responses[key]
+		if !ok {
+			return nil, fmt.Errorf("no recorded response for %s", key)
+		}
+		return &http.Response{
+			StatusCode: recorded.StatusCode,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(recorded.Body)),
+			Request:    request,
+		}, nil
+	}
+
+	response, err := rt.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	rt.responses[key] = fixtureResponse{StatusCode: response.StatusCode, Body: string(body)}
+	raw, err := json.MarshalIndent(rt.responses, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(rt.config.File, raw, 0644); err != nil {
+		return nil, fmt.Errorf("error while writing fixture file: %s", err)
+	}
+	return response, nil
+}
+
+func (config FixtureConfig) Validate() error {
+	if config.Mode != FixtureRecord && config.Mode != FixtureReplay {
+		return fmt.Errorf("fixture.mode must be %s or %s but got %s", FixtureRecord, FixtureReplay, config.Mode)
+	}
+	if config.File == "" {
+		return fmt.Errorf("fixture.file is empty")
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package metricssource
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	s "scaler/shared"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reads the usage from InfluxDB with Flux or InfluxQL queries, e.g. for hosts monitored by Telegraf
+type InfluxDB struct {
+	Config             InfluxDBConfig `yaml:"influxdb_config"`
+	templates          *prometheusTemplates
+	httpClient         *http.Client
+	errorsTotalCounter prometheus.Counter
+}
+
+type InfluxDBConfig struct {
+	Url string `yaml:"url"`
+	// flux or influxql, defaults to flux
+	Language string `yaml:"language"`
+	// API token, sent as "Authorization: Token"
+	Token s.StringFromEnv `yaml:"token"`
+	// Credentials of InfluxDB 1.x for InfluxQL
+	Username s.StringFromEnv `yaml:"username"`
+	Password s.StringFromEnv `yaml:"password"`
+	// Organization of the Flux queries
+	Org string `yaml:"org"`
+	// Database of the InfluxQL queries, the bucket is mapped to a database in InfluxDB 2.x
+	Database string `yaml:"database"`
+	// Same templates as the Prometheus queries, in the configured language
+	// An empty query uses the default query for Telegraf, there is no default for clusters
+	// The sample time queries are not used, the results carry the time of the samples
+	Queries PrometheusQueries `yaml:"queries"`
+	Checks  ReadingChecks     `yaml:"checks"`
+}
+
+const (
+	InfluxFlux     = "flux"
+	InfluxInfluxQL = "influxql"
+)
+
+var defaultFluxQueries = PrometheusQueries{
+	ServerCpu: `from(bucket: "telegraf")
+  |> range(start: -1m)
+  |> filter(fn: (r) => r._measurement == "cpu" and r._field == "usage_idle" and r.cpu == "cpu-total" and r.host == "{{ .ServerName }}")
+  |> last()
+  |> map(fn: (r) => ({r with _value: 1.0 - r._value / 100.0}))`,
+	ServerMemory: `from(bucket: "telegraf")
+  |> range(start: -1m)
+  |> filter(fn: (r) => r._measurement == "mem" and r._field == "used_percent" and r.host == "{{ .ServerName }}")
+  |> last()
+  |> map(fn: (r) => ({r with _value: r._value / 100.0}))`,
+}
+
+var defaultInfluxQLQueries = PrometheusQueries{
+	ServerCpu:    `SELECT 1 - last("usage_idle") / 100 FROM "cpu" WHERE "cpu" = 'cpu-total' AND "host" = '{{ .ServerName }}' AND time > now() - 1m`,
+	ServerMemory: `SELECT last("used_percent") / 100 FROM "mem" WHERE "host" = '{{ .ServerName }}' AND time > now() - 1m`,
+}
+
+func (c InfluxDBConfig) language() string {
+	if c.Language == "" {
+		return InfluxFlux
+	}
+	return c.Language
+}
+
+func (c InfluxDBConfig) queries() PrometheusQueries {
+	if c.language() == InfluxInfluxQL {
+		return c.Queries.withDefaults(defaultInfluxQLQueries)
+	}
+	return c.Queries.withDefaults(defaultFluxQueries)
+}
+
+func (i *InfluxDB) Init() error {
+	var err error
+	if i.templates, err = i.Config.queries().parse(); err != nil {
+		return err
+	}
+	i.httpClient = &http.Client{Timeout: 2 * timeout}
+	if i.errorsTotalCounter, err = initMetricsExporter("influxdb"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	return nil
+}
+
+func (i InfluxDB) authorize(request *http.Request) {
+	if i.Config.Token != "" {
+		request.Header.Set("Authorization", "Token "+string(i.Config.Token))
+	} else if i.Config.Username != "" {
+		request.SetBasicAuth(string(i.Config.Username), string(i.Config.Password))
+	}
+}
+
+// Sends the request and returns the body of a successful response
+func (i InfluxDB) do(request *http.Request) ([]byte, error) {
+	i.authorize(request)
+	response, err := i.httpClient.Do(request)
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		i.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("influxdb returned status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Runs a query and returns the last value of each series with its time
+func (i InfluxDB) Query(query string) (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
+	defer cancel()
+	now := time.Now()
+	var samples []influxSample
+	var err error
+	if i.Config.language() == InfluxInfluxQL {
+		samples, err = i.queryInfluxQL(ctx, query)
+	} else {
+		samples, err = i.queryFlux(ctx, query)
+	}
+	if err != nil {
+		return 0, err
+	}
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		if err := i.Config.Checks.checkAge(sample.time, now); err != nil {
+			i.errorsTotalCounter.Inc()
+			return 0, err
+		}
+		values = append(values, sample.value)
+	}
+	value, err := i.Config.Checks.combine(values)
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+	}
+	return value, err
+}
+
+type influxSample struct {
+	time  time.Time
+	value float64
+}
+
+// Runs a Flux query with the /api/v2/query endpoint, the response is an annotated CSV with one table per series
+func (i InfluxDB) queryFlux(ctx context.Context, query string) ([]influxSample, error) {
+	endpoint, err := url.JoinPath(i.Config.Url, "api/v2/query")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"?"+url.Values{"org": {i.Config.Org}}.Encode(), strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/vnd.flux")
+	request.Header.Set("Accept", "application/csv")
+	body, err := i.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(body)))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("error while parsing flux response: %s", err)
+	}
+	// Tables with another schema start with a new header, the last row of a table is its latest value
+	var columns map[string]int
+	tables := map[string]influxSample{}
+	order := []string{}
+	for _, record := range records {
+		if len(record) > 2 && record[1] == "error" {
+			columns = nil
+			continue
+		}
+		if len(record) > 2 && record[1] == "result" && record[2] == "table" {
+			columns = map[string]int{}
+			for index, column := range record {
+				columns[column] = index
+			}
+			continue
+		}
+		if columns == nil {
+			// Error tables have the columns error and reference
+			if len(record) > 1 && record[1] != "" {
+				i.errorsTotalCounter.Inc()
+				return nil, fmt.Errorf("flux query failed: %s", record[1])
+			}
+			continue
+		}
+		valueIndex, ok := columns["_value"]
+		if !ok || valueIndex >= len(record) {
+			i.errorsTotalCounter.Inc()
+			return nil, fmt.Errorf("flux response has no _value column")
+		}
+		value, err := strconv.ParseFloat(record[valueIndex], 64)
+		if err != nil {
+			i.errorsTotalCounter.Inc()
+			return nil, fmt.Errorf("flux response has an invalid value: %s", err)
+		}
+		sample := influxSample{value: value}
+		if timeIndex, ok := columns["_time"]; ok && timeIndex < len(record) {
+			if sample.time, err = time.Parse(time.RFC3339Nano, record[timeIndex]); err != nil {
+				i.errorsTotalCounter.Inc()
+				return nil, fmt.Errorf("flux response has an invalid time: %s", err)
+			}
+		} else {
+			// Aggregates without time are as recent as the query
+			sample.time = time.Now()
+		}
+		table := ""
+		if tableIndex, ok := columns["table"]; ok && tableIndex < len(record) {
+			table = record[tableIndex]
+		}
+		if _, ok := tables[table]; !ok {
+			order = append(order, table)
+		}
+		tables[table] = sample
+	}
+	samples := make([]influxSample, 0, len(order))
+	for _, table := range order {
+		samples = append(samples, tables[table])
+	}
+	return samples, nil
+}
+
+// Subset of a response of the /query endpoint
+type influxQLResponse struct {
+	Results []struct {
+		Series []struct {
+			Columns []string        `json:"columns"`
+			Values  [][]interface{} `json:"values"`
+		} `json:"series"`
+		Error string `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+// Runs an InfluxQL query with the /query endpoint, available in InfluxDB 1.x and as compatibility API in 2.x
+func (i InfluxDB) queryInfluxQL(ctx context.Context, query string) ([]influxSample, error) {
+	endpoint, err := url.JoinPath(i.Config.Url, "query")
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"db": {i.Config.Database}, "q": {query}, "epoch": {"ms"}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := i.do(request)
+	if err != nil {
+		return nil, err
+	}
+	var response influxQLResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		i.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("error while parsing influxql response: %s", err)
+	}
+	if response.Error != "" {
+		i.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("influxql query failed: %s", response.Error)
+	}
+	samples := []influxSample{}
+	for _, result := range response.Results {
+		if result.Error != "" {
+			i.errorsTotalCounter.Inc()
+			return nil, fmt.Errorf("influxql query failed: %s", result.Error)
+		}
+		for _, series := range result.Series {
+			if len(series.Values) == 0 {
+				continue
+			}
+			// The first column is the time, the second the selected value
+			last := series.Values[len(series.Values)-1]
+			if len(series.Columns) < 2 || len(last) < 2 {
+				i.errorsTotalCounter.Inc()
+				return nil, fmt.Errorf("influxql series has %d columns instead of at least 2", len(last))
+			}
+			millis, ok := last[0].(float64)
+			if !ok {
+				i.errorsTotalCounter.Inc()
+				return nil, fmt.Errorf("influxql series has an invalid time: %v", last[0])
+			}
+			value, ok := last[1].(float64)
+			if !ok {
+				// null when there is no sample in the time range
+				i.errorsTotalCounter.Inc()
+				return nil, invalidReading("influxql series has no value: %v", last[1])
+			}
+			samples = append(samples, influxSample{time: time.UnixMilli(int64(millis)), value: value})
+		}
+	}
+	return samples, nil
+}
+
+func (i InfluxDB) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	query, err := renderQuery(object, i.templates.serverCpu, i.templates.clusterCpu)
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	return i.Query(query)
+}
+
+func (i InfluxDB) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	query, err := renderQuery(object, i.templates.serverMemory, i.templates.clusterMemory)
+	if err != nil {
+		i.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	return i.Query(query)
+}
+
+func (i InfluxDB) Validate() error {
+	if i.Config.Url == "" {
+		return fmt.Errorf("influxdb.url is empty")
+	}
+	urlParsed, err := url.Parse(i.Config.Url)
+	if err != nil {
+		return fmt.Errorf("influxdb.url is invalid: %v", err)
+	}
+	if urlParsed.Scheme != "http" && urlParsed.Scheme != "https" {
+		return fmt.Errorf("influxdb.url scheme is invalid: %s", urlParsed.Scheme)
+	}
+	if urlParsed.Host == "" {
+		return fmt.Errorf("influxdb.url host is empty")
+	}
+	switch i.Config.language() {
+	case InfluxFlux:
+		if i.Config.Org == "" {
+			return fmt.Errorf("influxdb.org is empty")
+		}
+	case InfluxInfluxQL:
+		if i.Config.Database == "" {
+			return fmt.Errorf("influxdb.database is empty")
+		}
+	default:
+		return fmt.Errorf("influxdb.language must be %s or %s but got %s", InfluxFlux, InfluxInfluxQL, i.Config.Language)
+	}
+	if i.Config.Token != "" && i.Config.Username != "" {
+		return fmt.Errorf("influxdb.token and influxdb.username are mutually exclusive")
+	}
+	if _, err := i.Config.queries().parse(); err != nil {
+		return fmt.Errorf("influxdb.%s", err)
+	}
+	if err := i.Config.Checks.Validate(); err != nil {
+		return fmt.Errorf("influxdb.%s", err)
+	}
+	return nil
+}
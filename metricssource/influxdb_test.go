@@ -0,0 +1,127 @@
+package metricssource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateInfluxDB(t *testing.T) {
+	s.ValidatePass(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Org: "example", Token: "token"}})
+	s.ValidatePass(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Language: InfluxInfluxQL, Database: "telegraf", Username: "user", Password: "password"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Org: "example"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "ftp://localhost:8086", Org: "example"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Language: InfluxInfluxQL}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Language: "sql", Database: "telegraf"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Org: "example", Token: "token", Username: "user"}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Org: "example", Queries: PrometheusQueries{ServerCpu: "{{ .Unknown }}"}}})
+	s.ValidateFail(t, InfluxDB{Config: InfluxDBConfig{Url: "http://localhost:8086", Org: "example", Checks: ReadingChecks{MaxSampleAgeSeconds: -1}}})
+}
+
+// Fake InfluxDB answering Flux queries with the response for the host in the query
+func newFakeFlux(t *testing.T, responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" || r.URL.Query().Get("org") != "example" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Unexpected authorization %s", r.Header.Get("Authorization"))
+		}
+		query, _ := io.ReadAll(r.Body)
+		for host, response := range responses {
+			if strings.Contains(string(query), fmt.Sprintf(`r.host == "%s"`, host)) {
+				w.Write([]byte(response))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"invalid","message":"unknown host"}`))
+	}))
+}
+
+func TestInfluxDBFlux(t *testing.T) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	old := time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339Nano)
+	server := newFakeFlux(t, map[string]string{
+		"bbb-1": ",result,table,_start,_stop,_time,_value,_field,_measurement,cpu,host\r\n" +
+			",_result,0,2024-01-01T00:00:00Z,2024-01-01T00:01:00Z," + now + ",0.25,usage_idle,cpu,cpu-total,bbb-1\r\n\r\n",
+		// Two tables, e.g. from two Telegraf agents on the host
+		"bbb-2": ",result,table,_time,_value\r\n" +
+			",_result,0," + now + ",0.4\r\n" +
+			",_result,1," + now + ",0.6\r\n\r\n",
+		"bbb-3": ",result,table,_time,_value\r\n,_result,0," + old + ",0.4\r\n\r\n",
+		"bbb-4": ",error,reference\r\n,type error: undefined identifier,\r\n\r\n",
+		"bbb-5": "",
+	})
+	defer server.Close()
+
+	influx := &InfluxDB{Config: InfluxDBConfig{Url: server.URL, Org: "example", Token: "secret", Checks: ReadingChecks{MaxSampleAgeSeconds: 60}}}
+	if err := influx.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	expectUsage(t, influx.GetCpuUsage, &s.Server{ServerName: "bbb-1"}, 0.25)
+	expectUsage(t, influx.GetMemoryUsage, &s.Server{ServerName: "bbb-2"}, 0.6)
+
+	var invalid *s.InvalidReadingError
+	for _, host := range []string{"bbb-3", "bbb-5"} {
+		if _, err := influx.GetCpuUsage(&s.Server{ServerName: host}); !errors.As(err, &invalid) {
+			t.Errorf("Expected invalid reading for %s but got %v", host, err)
+		}
+	}
+	for _, host := range []string{"bbb-4", "bbb-6"} {
+		if _, err := influx.GetCpuUsage(&s.Server{ServerName: host}); err == nil || errors.As(err, &invalid) {
+			t.Errorf("Expected query error for %s but got %v", host, err)
+		}
+	}
+	if _, err := influx.GetCpuUsage(&s.Cluster{ClusterId: "abcd"}); err == nil {
+		t.Errorf("Expected error for a cluster without query")
+	}
+}
+
+func TestInfluxDBInfluxQL(t *testing.T) {
+	now := time.Now().UnixMilli()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query" || r.URL.Query().Get("db") != "telegraf" || r.URL.Query().Get("epoch") != "ms" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "password" {
+			t.Errorf("Unexpected credentials %s:%s", username, password)
+		}
+		query := r.URL.Query().Get("q")
+		switch {
+		case strings.Contains(query, "'bbb-1'") && strings.Contains(query, `FROM "cpu"`):
+			fmt.Fprintf(w, `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","last"],"values":[[%d,0.35]]}]}]}`, now)
+		case strings.Contains(query, "'bbb-1'") && strings.Contains(query, `FROM "mem"`):
+			fmt.Fprintf(w, `{"results":[{"statement_id":0,"series":[{"name":"mem","columns":["time","last"],"values":[[%d,1.5]]}]}]}`, now)
+		case strings.Contains(query, "'bbb-2'"):
+			w.Write([]byte(`{"results":[{"statement_id":0,"error":"database not found: telegraf"}]}`))
+		default:
+			w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+		}
+	}))
+	defer server.Close()
+
+	influx := &InfluxDB{Config: InfluxDBConfig{Url: server.URL, Language: InfluxInfluxQL, Database: "telegraf", Username: "user", Password: "password"}}
+	if err := influx.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	expectUsage(t, influx.GetCpuUsage, &s.Server{ServerName: "bbb-1"}, 0.35)
+
+	var invalid *s.InvalidReadingError
+	if _, err := influx.GetMemoryUsage(&s.Server{ServerName: "bbb-1"}); !errors.As(err, &invalid) {
+		t.Errorf("Expected invalid reading for a value above 1 but got %v", err)
+	}
+	if _, err := influx.GetCpuUsage(&s.Server{ServerName: "bbb-2"}); err == nil || errors.As(err, &invalid) {
+		t.Errorf("Expected query error but got %v", err)
+	}
+	if _, err := influx.GetCpuUsage(&s.Server{ServerName: "bbb-3"}); !errors.As(err, &invalid) {
+		t.Errorf("Expected invalid reading without series but got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package metricssource
+
+import (
+	"fmt"
+	"net/http"
+	s "scaler/shared"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/config"
+)
+
+// Reads the usage from the IONOS telemetry API, for servers without node_exporter
+// The credentials are read from the ionos_config of the Ionos provider
+type IonosMonitoring struct {
+	IonosCredentials IonosCredentials      `yaml:"ionos_config"`
+	Config           IonosMonitoringConfig `yaml:"ionos_monitoring_config"`
+	prometheus       *Prometheus
+}
+
+// Subset of the Ionos provider config
+type IonosCredentials struct {
+	Username s.StringFromEnv `yaml:"username"`
+	Password s.StringFromEnv `yaml:"password"`
+	Token    s.StringFromEnv `yaml:"token"`
+}
+
+type IonosMonitoringConfig struct {
+	Url          string            `yaml:"url"`
+	Queries      PrometheusQueries `yaml:"queries"`
+	Aggregations Aggregations      `yaml:"aggregations"`
+	Checks       ReadingChecks     `yaml:"checks"`
+	Fixture      *FixtureConfig    `yaml:"fixture"`
+}
+
+const defaultIonosMonitoringUrl = "https://api.ionos.com/telemetry/"
+
+// The telemetry API reports the utilisation of servers in percent, labeled by the server ID
+var defaultIonosMonitoringQueries = PrometheusQueries{
+	ServerCpu:         `instance_cpu_utilization_average{instance_id="{{ .ServerId }}"} / 100`,
+	ServerMemory:      `instance_memory_utilization_average{instance_id="{{ .ServerId }}"} / 100`,
+	ClusterCpu:        defaultPrometheusQueries.ClusterCpu,
+	ClusterMemory:     defaultPrometheusQueries.ClusterMemory,
+	ServerSampleTime:  `max(timestamp(instance_cpu_utilization_average{instance_id="{{ .ServerId }}"}))`,
+	ClusterSampleTime: defaultPrometheusQueries.ClusterSampleTime,
+}
+
+// Builds the Prometheus client of the telemetry API, which is compatible with the Prometheus HTTP API
+func (i IonosMonitoring) newPrometheus() *Prometheus {
+	url := i.Config.Url
+	if url == "" {
+		url = defaultIonosMonitoringUrl
+	}
+	return &Prometheus{
+		PrometheusConfig: PrometheusConfig{
+			Url:          url,
+			Queries:      i.Config.Queries.withDefaults(defaultIonosMonitoringQueries),
+			Aggregations: i.Config.Aggregations,
+			Checks:       i.Config.Checks,
+		},
+	}
+}
+
+func (i *IonosMonitoring) Init() error {
+	var rt http.RoundTripper = api.DefaultRoundTripper
+	if i.IonosCredentials.Token != "" {
+		rt = config.NewAuthorizationCredentialsRoundTripper("Bearer", config.NewInlineSecret(string(i.IonosCredentials.Token)), rt)
+	} else {
+		rt = config.NewBasicAuthRoundTripper(config.NewInlineSecret(string(i.IonosCredentials.Username)), config.NewInlineSecret(string(i.IonosCredentials.Password)), rt)
+	}
+	if i.Config.Fixture != nil {
+		fixture, err := newFixtureRoundTripper(*i.Config.Fixture, rt)
+		if err != nil {
+			return err
+		}
+		rt = fixture
+	}
+	i.prometheus = i.newPrometheus()
+	return i.prometheus.initWithRoundTripper(rt, "ionos_monitoring")
+}
+
+func (i IonosMonitoring) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	return i.prometheus.GetCpuUsage(object)
+}
+
+func (i IonosMonitoring) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	return i.prometheus.GetMemoryUsage(object)
+}
+
+func (i IonosMonitoring) Validate() error {
+	// Credentials are not needed to replay a fixture
+	replay := i.Config.Fixture != nil && i.Config.Fixture.Mode == FixtureReplay
+	if !replay && i.IonosCredentials.Token == "" && (i.IonosCredentials.Username == "" || i.IonosCredentials.Password == "") {
+		return fmt.Errorf("ionos.token or ionos.username and ionos.password must be set")
+	}
+	if i.Config.Fixture != nil {
+		if err := i.Config.Fixture.Validate(); err != nil {
+			return fmt.Errorf("ionos_monitoring.%s", err)
+		}
+	}
+	if err := i.newPrometheus().Validate(); err != nil {
+		return fmt.Errorf("ionos_monitoring config is invalid: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package metricssource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	s "scaler/shared"
+	"testing"
+)
+
+func TestValidateIonosMonitoring(t *testing.T) {
+	ionos := IonosMonitoring{IonosCredentials: IonosCredentials{Token: "token"}}
+	s.ValidatePass(t, ionos)
+	s.ValidateFail(t, IonosMonitoring{})
+	s.ValidateFail(t, IonosMonitoring{IonosCredentials: IonosCredentials{Username: "user"}})
+
+	ionos.Config.Fixture = &FixtureConfig{Mode: "rewind", File: "fixture.json"}
+	s.ValidateFail(t, ionos)
+	// Replaying needs no credentials
+	s.ValidatePass(t, IonosMonitoring{Config: IonosMonitoringConfig{Fixture: &FixtureConfig{Mode: FixtureReplay, File: "fixture.json"}}})
+}
+
+func TestParseIonosMonitoringConfig(t *testing.T) {
+	raw := `
+ionos_config:
+  token: token
+  contract_id: 1234
+ionos_monitoring_config:
+  queries:
+    server_memory: node_memory_usage{instance="{{ .ServerName }}"}
+`
+	ionos, err := s.LoadConfig[IonosMonitoring]([]byte(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	queries := ionos.newPrometheus().PrometheusConfig.Queries
+	if queries.ServerCpu != defaultIonosMonitoringQueries.ServerCpu || queries.ServerMemory != `node_memory_usage{instance="{{ .ServerName }}"}` {
+		t.Fatalf("Unexpected queries: %+v", queries)
+	}
+}
+
+// Replays the recorded telemetry responses without network access
+func TestIonosMonitoringReplay(t *testing.T) {
+	ionos := IonosMonitoring{
+		Config: IonosMonitoringConfig{
+			Fixture: &FixtureConfig{Mode: FixtureReplay, File: "test_files/ionos_monitoring_fixture.json"},
+		},
+	}
+	if err := ionos.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	server := &s.Server{ServerId: "0b5e6cf0-8f4c-4c5a-9f6b-1d1a2b3c4d5e", ServerName: "bbb-1"}
+	cluster := &s.Cluster{ClusterId: "5a1c9e2d-7b3f-4e6a-8d2c-9f0e1a2b3c4d", ClusterName: "pg-1"}
+	tests := []struct {
+		name     string
+		get      func(s.ScaledObject) (float32, error)
+		object   s.ScaledObject
+		expected float32
+	}{
+		{"server cpu", ionos.GetCpuUsage, server, 0.42},
+		{"server memory", ionos.GetMemoryUsage, server, 0.61},
+		{"cluster cpu", ionos.GetCpuUsage, cluster, 0.17},
+		{"cluster memory", ionos.GetMemoryUsage, cluster, 0.55},
+	}
+	for _, test := range tests {
+		usage, err := test.get(test.object)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if usage != test.expected {
+			t.Errorf("%s: expected %f but got %f", test.name, test.expected, usage)
+		}
+	}
+	if _, err := ionos.GetCpuUsage(&s.Server{ServerId: "unknown"}); err == nil {
+		t.Fatalf("Expected error for a request that was not recorded")
+	}
+}
+
+// Records the responses of a fake telemetry API and replays them
+func TestFixtureRecordReplay(t *testing.T) {
+	requests := 0
+	telemetry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.3"]}]}}`))
+	}))
+	defer telemetry.Close()
+
+	file := filepath.Join(t.TempDir(), "fixture.json")
+	recorder, err := newFixtureRoundTripper(FixtureConfig{Mode: FixtureRecord, File: file}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	request, _ := http.NewRequest(http.MethodGet, telemetry.URL+"/api/v1/query?query=up&time=1700000000", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	if _, err := recorder.RoundTrip(request); err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+
+	replayer, err := newFixtureRoundTripper(FixtureConfig{Mode: FixtureReplay, File: file}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	// The time parameter changes between runs and is not part of the key
+	request, _ = http.NewRequest(http.MethodGet, telemetry.URL+"/api/v1/query?query=up&time=1700000060", nil)
+	response, err := replayer.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || requests != 1 {
+		t.Fatalf("Expected a replayed response without request but got %d after %d requests", response.StatusCode, requests)
+	}
+}
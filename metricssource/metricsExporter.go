@@ -2,26 +2,21 @@ package metricssource
 
 import "github.com/prometheus/client_golang/prometheus"
 
-var (
-	errorsTotalCounter prometheus.Counter
-)
+// Errors of the metrics sources by type, several sources can be used side by side
+var errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name:        "autoscaler_component_errors_total",
+	Help:        "The total number of errors encountered by a component of the autoscaler",
+	ConstLabels: map[string]string{"component": "metricssource"},
+}, []string{"component_type"})
 
-func initMetricsExporter(serviceName string) error {
-	constLabels := map[string]string{
-		"component_type": serviceName,
-		"component":      "metricssource",
-	}
-	errorsTotalCounter = prometheus.NewCounter(prometheus.CounterOpts{
-		Name:        "autoscaler_component_errors_total",
-		Help:        "The total number of errors encountered by a component of the autoscaler",
-		ConstLabels: constLabels,
-	})
-	metrics := []prometheus.Collector{errorsTotalCounter}
-	for _, metric := range metrics {
-		if err := prometheus.Register(metric); err != nil {
-			return err
+// Returns the errors counter of a source, sources of the same type share it
+func initMetricsExporter(componentType string) (prometheus.Counter, error) {
+	if err := prometheus.Register(errorsTotal); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return nil, err
 		}
 	}
-	errorsTotalCounter.Add(0)
-	return nil
+	counter := errorsTotal.WithLabelValues(componentType)
+	counter.Add(0)
+	return counter, nil
 }
@@ -0,0 +1,26 @@
+package metricssource
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Check that each source type counts its own errors
+func TestErrorsCounterPerSource(t *testing.T) {
+	prometheusErrors, err := initMetricsExporter("prometheus_test")
+	if err != nil {
+		t.Fatalf("Failed to init metrics: %v", err)
+	}
+	influxErrors, err := initMetricsExporter("influxdb_test")
+	if err != nil {
+		t.Fatalf("Failed to init metrics: %v", err)
+	}
+	prometheusErrors.Inc()
+	if got := testutil.ToFloat64(influxErrors); got != 0 {
+		t.Errorf("Expected no influxdb errors but got %f", got)
+	}
+	if got := testutil.ToFloat64(prometheusErrors); got != 1 {
+		t.Errorf("Expected 1 prometheus error but got %f", got)
+	}
+}
@@ -0,0 +1,289 @@
+package metricssource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	s "scaler/shared"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Scrapes the node_exporter of each server, for small deployments without a Prometheus server
+// The usage is computed with the formulas of the default Prometheus queries
+type NodeExporter struct {
+	Config      NodeExporterConfig `yaml:"node_exporter_config"`
+	urlTemplate *template.Template
+	httpClient  *http.Client
+	// Replaceable to run the tests without waiting
+	sleep func(time.Duration)
+	// Second scrape of the CPU usage by server name, kept until the memory usage of the same cycle reuses it
+	scrapes            map[string]nodeExporterScrape
+	errorsTotalCounter prometheus.Counter
+}
+
+type nodeExporterScrape struct {
+	families map[string]*dto.MetricFamily
+	time     time.Time
+}
+
+type NodeExporterConfig struct {
+	// Go template of the metrics URL, with access to the Server fields and the Host
+	UrlTemplate string `yaml:"url_template"`
+	// Host or IP of a server by server name, the host defaults to the server name
+	Hosts map[string]string `yaml:"hosts"`
+	// Seconds between the two samples of the CPU rate, defaults to 5
+	SampleIntervalSeconds int             `yaml:"sample_interval_seconds"`
+	Token                 s.StringFromEnv `yaml:"token"`
+	Checks                ReadingChecks   `yaml:"checks"`
+}
+
+const (
+	defaultNodeExporterUrlTemplate     = "http://{{ .Host }}:9100/metrics"
+	defaultNodeExporterIntervalSeconds = 5
+)
+
+type nodeExporterUrlTemplateData struct {
+	s.Server
+	Host string
+}
+
+func (c NodeExporterConfig) parseUrlTemplate() (*template.Template, error) {
+	urlTemplate := c.UrlTemplate
+	if urlTemplate == "" {
+		urlTemplate = defaultNodeExporterUrlTemplate
+	}
+	parsed, err := template.New("node_exporter_url").Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("node_exporter.url_template is invalid: %s", err)
+	}
+	// Catch references to unknown fields before the first scaling cycle
+	if err := parsed.Execute(&bytes.Buffer{}, nodeExporterUrlTemplateData{}); err != nil {
+		return nil, fmt.Errorf("node_exporter.url_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (c NodeExporterConfig) sampleInterval() time.Duration {
+	if c.SampleIntervalSeconds == 0 {
+		return defaultNodeExporterIntervalSeconds * time.Second
+	}
+	return time.Duration(c.SampleIntervalSeconds) * time.Second
+}
+
+func (n *NodeExporter) Init() error {
+	var err error
+	if n.urlTemplate, err = n.Config.parseUrlTemplate(); err != nil {
+		return err
+	}
+	n.httpClient = &http.Client{Timeout: timeout}
+	n.sleep = time.Sleep
+	n.scrapes = map[string]nodeExporterScrape{}
+	if n.errorsTotalCounter, err = initMetricsExporter("node_exporter"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	return nil
+}
+
+func (n NodeExporter) metricsUrl(server s.Server) (string, error) {
+	host, ok := n.Config.Hosts[server.ServerName]
+	if !ok {
+		host = server.ServerName
+	}
+	var buffer bytes.Buffer
+	if err := n.urlTemplate.Execute(&buffer, nodeExporterUrlTemplateData{Server: server, Host: host}); err != nil {
+		n.errorsTotalCounter.Inc()
+		return "", fmt.Errorf("error while rendering url template for %s: %s", server.ServerName, err)
+	}
+	return buffer.String(), nil
+}
+
+// Fetches and parses the metrics of the server
+func (n NodeExporter) scrape(object s.ScaledObject) (map[string]*dto.MetricFamily, error) {
+	server, ok := object.(*s.Server)
+	if !ok {
+		n.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+	}
+	metricsUrl, err := n.metricsUrl(*server)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsUrl, nil)
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+		return nil, err
+	}
+	// Ask for the text format, which is the only format node_exporter always serves
+	request.Header.Set("Accept", "text/plain;version=0.0.4")
+	if n.Config.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+string(n.Config.Token))
+	}
+	response, err := n.httpClient.Do(request)
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("error while scraping %s: %s", server.ServerName, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		n.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("error while scraping %s: status %d", server.ServerName, response.StatusCode)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(response.Body)
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+		return nil, fmt.Errorf("error while parsing metrics of %s: %s", server.ServerName, err)
+	}
+	return families, nil
+}
+
+func metricLabel(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// Seconds per cpu and mode of node_cpu_seconds_total
+func nodeCpuSeconds(families map[string]*dto.MetricFamily) map[string]map[string]float64 {
+	seconds := map[string]map[string]float64{}
+	for _, metric := range families["node_cpu_seconds_total"].GetMetric() {
+		cpu := metricLabel(metric, "cpu")
+		if seconds[cpu] == nil {
+			seconds[cpu] = map[string]float64{}
+		}
+		seconds[cpu][metricLabel(metric, "mode")] = metric.GetCounter().GetValue()
+	}
+	return seconds
+}
+
+// Same as avg without (mode,cpu) (1 - rate(node_cpu_seconds_total{mode="idle"}[...]))
+// The elapsed time of a cpu is the increase of all its modes, which is not skewed by the scrape duration
+func nodeCpuUsage(first, second map[string]map[string]float64) (float64, error) {
+	sum, count := 0.0, 0
+	for cpu, modes := range second {
+		idle, elapsed := modes["idle"]-first[cpu]["idle"], 0.0
+		for mode, value := range modes {
+			elapsed += value - first[cpu][mode]
+		}
+		// Counter reset or no time elapsed between the samples
+		if _, ok := first[cpu]; !ok || elapsed <= 0 || idle < 0 {
+			continue
+		}
+		sum += 1 - idle/elapsed
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("node_cpu_seconds_total did not increase between the samples")
+	}
+	return sum / float64(count), nil
+}
+
+// Same as 1 - (node_memory_MemFree_bytes + node_memory_Cached_bytes + node_memory_Buffers_bytes) / node_memory_MemTotal_bytes
+func nodeMemoryUsage(families map[string]*dto.MetricFamily) (float64, error) {
+	values := map[string]float64{}
+	for _, name := range []string{"node_memory_MemFree_bytes", "node_memory_Cached_bytes", "node_memory_Buffers_bytes", "node_memory_MemTotal_bytes"} {
+		metrics := families[name].GetMetric()
+		if len(metrics) == 0 {
+			return 0, fmt.Errorf("%s is missing", name)
+		}
+		values[name] = metrics[0].GetGauge().GetValue()
+	}
+	if values["node_memory_MemTotal_bytes"] == 0 {
+		return 0, fmt.Errorf("node_memory_MemTotal_bytes is 0")
+	}
+	return 1 - (values["node_memory_MemFree_bytes"]+values["node_memory_Cached_bytes"]+values["node_memory_Buffers_bytes"])/values["node_memory_MemTotal_bytes"], nil
+}
+
+// Scrapes the server twice, the sample interval apart, and computes the CPU rate in between
+func (n NodeExporter) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	first, err := n.scrape(object)
+	if err != nil {
+		return 0, err
+	}
+	n.sleep(n.Config.sampleInterval())
+	second, err := n.scrape(object)
+	if err != nil {
+		return 0, err
+	}
+	n.pruneScrapes()
+	n.scrapes[object.GetName()] = nodeExporterScrape{families: second, time: time.Now()}
+	usage, err := nodeCpuUsage(nodeCpuSeconds(first), nodeCpuSeconds(second))
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+		return 0, invalidReading("%s", err)
+	}
+	return n.combine(usage)
+}
+
+// Drops the scrapes no memory usage reused, e.g. of servers that are gone
+func (n NodeExporter) pruneScrapes() {
+	for name, scrape := range n.scrapes {
+		if time.Since(scrape.time) > timeout {
+			delete(n.scrapes, name)
+		}
+	}
+}
+
+// Reuses the second scrape of the CPU usage when it is recent, otherwise scrapes the server
+func (n NodeExporter) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	name := object.GetName()
+	scrape, ok := n.scrapes[name]
+	delete(n.scrapes, name)
+	families := scrape.families
+	if !ok || time.Since(scrape.time) > timeout {
+		var err error
+		if families, err = n.scrape(object); err != nil {
+			return 0, err
+		}
+	}
+	usage, err := nodeMemoryUsage(families)
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+		return 0, invalidReading("%s", err)
+	}
+	return n.combine(usage)
+}
+
+func (n NodeExporter) combine(usage float64) (float32, error) {
+	value, err := n.Config.Checks.combine([]float64{usage})
+	if err != nil {
+		n.errorsTotalCounter.Inc()
+	}
+	return value, err
+}
+
+func (n NodeExporter) Validate() error {
+	parsed, err := n.Config.parseUrlTemplate()
+	if err != nil {
+		return err
+	}
+	for name, host := range n.Config.Hosts {
+		var buffer bytes.Buffer
+		if err := parsed.Execute(&buffer, nodeExporterUrlTemplateData{Server: s.Server{ServerName: name}, Host: host}); err != nil {
+			return fmt.Errorf("node_exporter.url_template is invalid for %s: %s", name, err)
+		}
+		urlParsed, err := url.Parse(buffer.String())
+		if err != nil || (urlParsed.Scheme != "http" && urlParsed.Scheme != "https") || urlParsed.Host == "" {
+			return fmt.Errorf("node_exporter url %s of %s is invalid", buffer.String(), name)
+		}
+	}
+	if n.Config.SampleIntervalSeconds < 0 {
+		return fmt.Errorf("node_exporter.sample_interval_seconds must be greater than or equal to 0 but got %d", n.Config.SampleIntervalSeconds)
+	}
+	if err := n.Config.Checks.Validate(); err != nil {
+		return fmt.Errorf("node_exporter.%s", err)
+	}
+	return nil
+}
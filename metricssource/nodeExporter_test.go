@@ -0,0 +1,105 @@
+package metricssource
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateNodeExporter(t *testing.T) {
+	s.ValidatePass(t, NodeExporter{})
+	s.ValidatePass(t, NodeExporter{Config: NodeExporterConfig{UrlTemplate: "https://{{ .Host }}/node/metrics", Hosts: map[string]string{"bbb-1": "10.0.0.11"}}})
+	s.ValidateFail(t, NodeExporter{Config: NodeExporterConfig{UrlTemplate: "http://{{ .Unknown }}:9100/metrics"}})
+	s.ValidateFail(t, NodeExporter{Config: NodeExporterConfig{UrlTemplate: "{{ .Host }}:9100/metrics", Hosts: map[string]string{"bbb-1": "10.0.0.11"}}})
+	s.ValidateFail(t, NodeExporter{Config: NodeExporterConfig{SampleIntervalSeconds: -1}})
+	s.ValidateFail(t, NodeExporter{Config: NodeExporterConfig{Checks: ReadingChecks{MultipleSeries: "min"}}})
+}
+
+// Fake node_exporter with two cpus, where every scrape advances the counters by 4 seconds per cpu
+func newFakeNodeExporter(idlePerScrape [2]float64, scrapes *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bbb-1/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var metrics strings.Builder
+		metrics.WriteString("# HELP node_cpu_seconds_total Seconds the CPUs spent in each mode.\n# TYPE node_cpu_seconds_total counter\n")
+		for cpu, idle := range idlePerScrape {
+			fmt.Fprintf(&metrics, "node_cpu_seconds_total{cpu=\"%d\",mode=\"idle\"} %f\n", cpu, 1000+float64(*scrapes)*idle)
+			fmt.Fprintf(&metrics, "node_cpu_seconds_total{cpu=\"%d\",mode=\"user\"} %f\n", cpu, 500+float64(*scrapes)*(4-idle))
+		}
+		metrics.WriteString("# TYPE node_memory_MemTotal_bytes gauge\nnode_memory_MemTotal_bytes 8e+09\n")
+		metrics.WriteString("# TYPE node_memory_MemFree_bytes gauge\nnode_memory_MemFree_bytes 2e+09\n")
+		metrics.WriteString("# TYPE node_memory_Cached_bytes gauge\nnode_memory_Cached_bytes 1e+09\n")
+		metrics.WriteString("# TYPE node_memory_Buffers_bytes gauge\nnode_memory_Buffers_bytes 1e+09\n")
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(metrics.String()))
+		*scrapes++
+	}))
+}
+
+func TestNodeExporter(t *testing.T) {
+	scrapes := 0
+	server := newFakeNodeExporter([2]float64{3, 1}, &scrapes)
+	defer server.Close()
+
+	nodeExporter := &NodeExporter{Config: NodeExporterConfig{
+		UrlTemplate: server.URL + "/{{ .Host }}/metrics",
+		Hosts:       map[string]string{"bbb-one": "bbb-1"},
+	}}
+	if err := nodeExporter.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	var slept time.Duration
+	nodeExporter.sleep = func(d time.Duration) { slept += d }
+
+	bbb := &s.Server{ServerName: "bbb-one"}
+	// cpu0 is 25% busy and cpu1 75%, already in the first cycle
+	expectUsage(t, nodeExporter.GetCpuUsage, bbb, 0.5)
+	if slept != 5*time.Second || scrapes != 2 {
+		t.Errorf("Expected two scrapes 5s apart but got %d scrapes %s apart", scrapes, slept)
+	}
+	// The memory usage reuses the second scrape
+	expectUsage(t, nodeExporter.GetMemoryUsage, bbb, 0.5)
+	if scrapes != 2 {
+		t.Errorf("Expected the memory usage to reuse the second scrape but got %d scrapes", scrapes)
+	}
+	// Without a CPU reading of the same cycle the memory usage scrapes again
+	expectUsage(t, nodeExporter.GetMemoryUsage, bbb, 0.5)
+	if scrapes != 3 {
+		t.Errorf("Expected a new scrape for the memory usage but got %d scrapes", scrapes)
+	}
+
+	// The scrapes of servers without memory reading are dropped once stale
+	nodeExporter.scrapes["bbb-gone"] = nodeExporterScrape{time: time.Now().Add(-2 * timeout)}
+	expectUsage(t, nodeExporter.GetCpuUsage, bbb, 0.5)
+	if _, ok := nodeExporter.scrapes["bbb-gone"]; ok {
+		t.Errorf("Expected the stale scrape of bbb-gone to be pruned")
+	}
+
+	if _, err := nodeExporter.GetCpuUsage(&s.Server{ServerName: "bbb-2"}); err == nil {
+		t.Errorf("Expected error for a server without node_exporter")
+	}
+	if _, err := nodeExporter.GetCpuUsage(&s.Cluster{ClusterId: "abcd"}); err == nil {
+		t.Errorf("Expected error for a cluster")
+	}
+}
+
+func TestNodeCpuUsage(t *testing.T) {
+	first := map[string]map[string]float64{"0": {"idle": 100, "user": 50}}
+	if _, err := nodeCpuUsage(first, first); err == nil {
+		t.Errorf("Expected error without increase")
+	}
+	// Counters restart after the reboot of a resize
+	if _, err := nodeCpuUsage(first, map[string]map[string]float64{"0": {"idle": 1, "user": 1}}); err == nil {
+		t.Errorf("Expected error after a counter reset")
+	}
+	usage, err := nodeCpuUsage(first, map[string]map[string]float64{"0": {"idle": 101, "user": 53}, "1": {"idle": 5, "user": 5}})
+	if err != nil || usage != 0.75 {
+		t.Errorf("Expected usage 0.75 ignoring the new cpu but got %f, %v", usage, err)
+	}
+}
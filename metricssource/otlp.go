@@ -0,0 +1,217 @@
+package metricssource
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	s "scaler/shared"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Receives the metrics pushed by OpenTelemetry exporters over OTLP into an in-memory window
+// The readings are computed from the host metrics of the object, so no Prometheus server is needed
+type Otlp struct {
+	Config OtlpConfig `yaml:"otlp_config"`
+	store  *otlpStore
+	// Address of the started listeners, useful when listening on port 0
+	grpcAddress        net.Addr
+	httpAddress        net.Addr
+	errorsTotalCounter prometheus.Counter
+}
+
+type OtlpConfig struct {
+	// OTLP/gRPC listener, e.g. :4317
+	GrpcListenAddress string `yaml:"grpc_listen_address"`
+	// OTLP/HTTP listener accepting protobuf and JSON on /v1/metrics, e.g. :4318
+	HttpListenAddress string `yaml:"http_listen_address"`
+	// Resource attribute holding the object name, defaults to host.name
+	ResourceAttribute string `yaml:"resource_attribute"`
+	// Points older than the window are dropped, the CPU usage is computed over the window, defaults to 300
+	WindowSeconds int           `yaml:"window_seconds"`
+	Checks        ReadingChecks `yaml:"checks"`
+}
+
+const (
+	defaultOtlpResourceAttribute = "host.name"
+	defaultOtlpWindowSeconds     = 300
+	// Largest accepted OTLP/HTTP request body
+	otlpMaxBodyBytes = 16 << 20
+)
+
+func (c OtlpConfig) resourceAttribute() string {
+	if c.ResourceAttribute == "" {
+		return defaultOtlpResourceAttribute
+	}
+	return c.ResourceAttribute
+}
+
+func (c OtlpConfig) window() time.Duration {
+	if c.WindowSeconds == 0 {
+		return defaultOtlpWindowSeconds * time.Second
+	}
+	return time.Duration(c.WindowSeconds) * time.Second
+}
+
+type otlpGrpcServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	store *otlpStore
+}
+
+func (server otlpGrpcServer) Export(ctx context.Context, request *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	server.store.add(request.GetResourceMetrics(), time.Now())
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func (o *Otlp) Init() error {
+	o.store = newOtlpStore(o.Config.resourceAttribute(), o.Config.window())
+	var err error
+	if o.errorsTotalCounter, err = initMetricsExporter("otlp"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	if o.Config.GrpcListenAddress != "" {
+		listener, err := net.Listen("tcp", o.Config.GrpcListenAddress)
+		if err != nil {
+			return fmt.Errorf("error while listening for otlp grpc: %s", err)
+		}
+		o.grpcAddress = listener.Addr()
+		server := grpc.NewServer()
+		colmetricspb.RegisterMetricsServiceServer(server, otlpGrpcServer{store: o.store})
+		go o.serve("grpc", func() error { return server.Serve(listener) })
+	}
+	if o.Config.HttpListenAddress != "" {
+		listener, err := net.Listen("tcp", o.Config.HttpListenAddress)
+		if err != nil {
+			return fmt.Errorf("error while listening for otlp http: %s", err)
+		}
+		o.httpAddress = listener.Addr()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/metrics", o.handleHttp)
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: timeout}
+		go o.serve("http", func() error { return server.Serve(listener) })
+	}
+	return nil
+}
+
+func (o *Otlp) serve(protocol string, serve func() error) {
+	if err := serve(); err != nil {
+		o.errorsTotalCounter.Inc()
+		slog.Error(fmt.Sprintf("OTLP %s receiver stopped: %s", protocol, err))
+	}
+}
+
+// Handles an OTLP/HTTP export request, see https://opentelemetry.io/docs/specs/otlp/#otlphttp
+func (o *Otlp) handleHttp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/x-protobuf" && contentType != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type: %s", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, otlpMaxBodyBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid gzip body: %s", err), http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		body = io.LimitReader(gzipReader, otlpMaxBodyBytes)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error while reading body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	request := &colmetricspb.ExportMetricsServiceRequest{}
+	var response []byte
+	if contentType == "application/json" {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(raw, request)
+		response, _ = protojson.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+	} else {
+		err = proto.Unmarshal(raw, request)
+		response, _ = proto.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+	}
+	if err != nil {
+		o.errorsTotalCounter.Inc()
+		http.Error(w, fmt.Sprintf("invalid export request: %s", err), http.StatusBadRequest)
+		return
+	}
+	o.store.add(request.GetResourceMetrics(), time.Now())
+	w.Header().Set("Content-Type", contentType)
+	w.Write(response)
+}
+
+// Counts the failed readings in the errors of the source
+func (o Otlp) read(object s.ScaledObject, gauge, sum string, fromGauge, fromSum func([]otlpSeries) (float64, time.Time, error)) (float32, error) {
+	value, err := o.readUsage(object, gauge, sum, fromGauge, fromSum)
+	if err != nil {
+		o.errorsTotalCounter.Inc()
+	}
+	return value, err
+}
+
+// Computes a reading from the utilization gauge, or from the sum if the gauge was not received
+func (o Otlp) readUsage(object s.ScaledObject, gauge, sum string, fromGauge, fromSum func([]otlpSeries) (float64, time.Time, error)) (float32, error) {
+	now := time.Now()
+	compute := fromGauge
+	series := o.store.get(object.GetName(), gauge, now)
+	if len(series) == 0 {
+		compute = fromSum
+		series = o.store.get(object.GetName(), sum, now)
+	}
+	if len(series) == 0 {
+		return 0, invalidReading("no %s or %s received for %s %s in the last %s", gauge, sum, o.Config.resourceAttribute(), object.GetName(), o.Config.window())
+	}
+	value, timestamp, err := compute(series)
+	if err != nil {
+		return 0, invalidReading("%s", err)
+	}
+	if err := o.Config.Checks.checkAge(timestamp, now); err != nil {
+		return 0, err
+	}
+	return o.Config.Checks.combine([]float64{value})
+}
+
+func (o Otlp) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	return o.read(object, otlpCpuUtilization, otlpCpuTime, otlpCpuFromUtilization, otlpCpuFromTime)
+}
+
+func (o Otlp) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	return o.read(object, otlpMemoryUtilization, otlpMemoryUsage, otlpMemoryFromUtilization, otlpMemoryFromUsage)
+}
+
+func (o Otlp) Validate() error {
+	if o.Config.GrpcListenAddress == "" && o.Config.HttpListenAddress == "" {
+		return fmt.Errorf("otlp.grpc_listen_address and otlp.http_listen_address are empty")
+	}
+	for _, address := range []string{o.Config.GrpcListenAddress, o.Config.HttpListenAddress} {
+		if address == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("otlp listen address %s is invalid: %s", address, err)
+		}
+	}
+	if o.Config.WindowSeconds < 0 {
+		return fmt.Errorf("otlp.window_seconds must be greater than or equal to 0 but got %d", o.Config.WindowSeconds)
+	}
+	if err := o.Config.Checks.Validate(); err != nil {
+		return fmt.Errorf("otlp.%s", err)
+	}
+	return nil
+}
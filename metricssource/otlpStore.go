@@ -0,0 +1,279 @@
+package metricssource
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Metrics of the hostmetrics receiver of the OpenTelemetry Collector
+// The utilization gauges are optional in the receiver, without them the usage is computed from the time and usage sums
+const (
+	otlpCpuTime           = "system.cpu.time"
+	otlpCpuUtilization    = "system.cpu.utilization"
+	otlpMemoryUsage       = "system.memory.usage"
+	otlpMemoryUtilization = "system.memory.utilization"
+)
+
+var otlpMetrics = map[string]bool{
+	otlpCpuTime:           true,
+	otlpCpuUtilization:    true,
+	otlpMemoryUsage:       true,
+	otlpMemoryUtilization: true,
+}
+
+type otlpPoint struct {
+	time  time.Time
+	value float64
+}
+
+// Points of one metric with the same data point attributes, e.g. one cpu and state
+type otlpSeries struct {
+	attributes map[string]string
+	points     []otlpPoint
+}
+
+func (series *otlpSeries) last() otlpPoint {
+	return series.points[len(series.points)-1]
+}
+
+// Window of the received points, keyed by object name, metric and series
+type otlpStore struct {
+	mutex  sync.Mutex
+	window time.Duration
+	// Resource attribute holding the object name
+	attribute string
+	series    map[string]map[string]map[string]*otlpSeries
+}
+
+func newOtlpStore(attribute string, window time.Duration) *otlpStore {
+	return &otlpStore{
+		window:    window,
+		attribute: attribute,
+		series:    make(map[string]map[string]map[string]*otlpSeries),
+	}
+}
+
+func otlpAttributes(keyValues []*commonpb.KeyValue) map[string]string {
+	attributes := make(map[string]string, len(keyValues))
+	for _, keyValue := range keyValues {
+		switch value := keyValue.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			attributes[keyValue.GetKey()] = value.StringValue
+		case *commonpb.AnyValue_IntValue:
+			attributes[keyValue.GetKey()] = strconv.FormatInt(value.IntValue, 10)
+		case *commonpb.AnyValue_BoolValue:
+			attributes[keyValue.GetKey()] = strconv.FormatBool(value.BoolValue)
+		case *commonpb.AnyValue_DoubleValue:
+			attributes[keyValue.GetKey()] = strconv.FormatFloat(value.DoubleValue, 'g', -1, 64)
+		}
+	}
+	return attributes
+}
+
+func otlpSeriesKey(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key, value := range attributes {
+		keys = append(keys, key+"="+value)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Adds the points of the tracked metrics and drops the points which left the window
+// Returns the number of stored points
+func (store *otlpStore) add(resourceMetrics []*metricspb.ResourceMetrics, now time.Time) int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	added := 0
+	for _, resource := range resourceMetrics {
+		object, ok := otlpAttributes(resource.GetResource().GetAttributes())[store.attribute]
+		if !ok {
+			continue
+		}
+		for _, scope := range resource.GetScopeMetrics() {
+			for _, metric := range scope.GetMetrics() {
+				if !otlpMetrics[metric.GetName()] {
+					continue
+				}
+				var dataPoints []*metricspb.NumberDataPoint
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					dataPoints = data.Gauge.GetDataPoints()
+				case *metricspb.Metric_Sum:
+					// Rates are computed from the difference of cumulative values
+					if data.Sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+						continue
+					}
+					dataPoints = data.Sum.GetDataPoints()
+				}
+				for _, dataPoint := range dataPoints {
+					store.addPoint(object, metric.GetName(), dataPoint)
+					added++
+				}
+			}
+		}
+	}
+	store.prune(now)
+	return added
+}
+
+func (store *otlpStore) addPoint(object, metric string, dataPoint *metricspb.NumberDataPoint) {
+	var value float64
+	switch number := dataPoint.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = number.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(number.AsInt)
+	default:
+		return
+	}
+	if store.series[object] == nil {
+		store.series[object] = make(map[string]map[string]*otlpSeries)
+	}
+	if store.series[object][metric] == nil {
+		store.series[object][metric] = make(map[string]*otlpSeries)
+	}
+	attributes := otlpAttributes(dataPoint.GetAttributes())
+	key := otlpSeriesKey(attributes)
+	series, ok := store.series[object][metric][key]
+	if !ok {
+		series = &otlpSeries{attributes: attributes}
+		store.series[object][metric][key] = series
+	}
+	point := otlpPoint{time: time.Unix(0, int64(dataPoint.GetTimeUnixNano())), value: value}
+	// Exporters retry failed requests, keep the points ordered and unique
+	index := sort.Search(len(series.points), func(i int) bool { return !series.points[i].time.Before(point.time) })
+	if index < len(series.points) && series.points[index].time.Equal(point.time) {
+		series.points[index] = point
+		return
+	}
+	series.points = append(series.points, otlpPoint{})
+	copy(series.points[index+1:], series.points[index:])
+	series.points[index] = point
+}
+
+func (store *otlpStore) prune(now time.Time) {
+	start := now.Add(-store.window)
+	for object, metrics := range store.series {
+		for metric, seriesByKey := range metrics {
+			for key, series := range seriesByKey {
+				index := sort.Search(len(series.points), func(i int) bool { return !series.points[i].time.Before(start) })
+				series.points = series.points[index:]
+				if len(series.points) == 0 {
+					delete(seriesByKey, key)
+				}
+			}
+			if len(seriesByKey) == 0 {
+				delete(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			delete(store.series, object)
+		}
+	}
+}
+
+// Returns a copy of the series of a metric of the object
+func (store *otlpStore) get(object, metric string, now time.Time) []otlpSeries {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.prune(now)
+	result := []otlpSeries{}
+	for _, series := range store.series[object][metric] {
+		result = append(result, otlpSeries{attributes: series.attributes, points: append([]otlpPoint{}, series.points...)})
+	}
+	return result
+}
+
+// CPU usage as 1 minus the average idle utilization of the latest points
+func otlpCpuFromUtilization(series []otlpSeries) (float64, time.Time, error) {
+	idle, count := 0.0, 0
+	var oldest time.Time
+	for _, s := range series {
+		if s.attributes["state"] != "idle" {
+			continue
+		}
+		last := s.last()
+		idle += last.value
+		count++
+		if oldest.IsZero() || last.time.Before(oldest) {
+			oldest = last.time
+		}
+	}
+	if count == 0 {
+		return 0, oldest, fmt.Errorf("no idle state in %s", otlpCpuUtilization)
+	}
+	return 1 - idle/float64(count), oldest, nil
+}
+
+// CPU usage as the share of non idle time over the window, like the rate of node_cpu_seconds_total
+func otlpCpuFromTime(series []otlpSeries) (float64, time.Time, error) {
+	idle, total := 0.0, 0.0
+	var oldest time.Time
+	for _, s := range series {
+		if len(s.points) < 2 {
+			continue
+		}
+		last := s.last()
+		delta := last.value - s.points[0].value
+		// Counter reset, e.g. after a reboot by a resize
+		if delta < 0 {
+			continue
+		}
+		total += delta
+		if s.attributes["state"] == "idle" {
+			idle += delta
+		}
+		if oldest.IsZero() || last.time.Before(oldest) {
+			oldest = last.time
+		}
+	}
+	if total == 0 {
+		return 0, oldest, fmt.Errorf("%s needs two points in the window", otlpCpuTime)
+	}
+	return 1 - idle/total, oldest, nil
+}
+
+// Memory usage from the latest point of the used state
+func otlpMemoryFromUtilization(series []otlpSeries) (float64, time.Time, error) {
+	for _, s := range series {
+		if s.attributes["state"] == "used" {
+			return s.last().value, s.last().time, nil
+		}
+	}
+	return 0, time.Time{}, fmt.Errorf("no used state in %s", otlpMemoryUtilization)
+}
+
+// Memory usage as the used bytes over the total of the states
+// The slab states are part of the used memory on Linux and do not count towards the total
+func otlpMemoryFromUsage(series []otlpSeries) (float64, time.Time, error) {
+	used, total := 0.0, 0.0
+	found := false
+	var oldest time.Time
+	for _, s := range series {
+		state := s.attributes["state"]
+		if strings.HasPrefix(state, "slab_") {
+			continue
+		}
+		last := s.last()
+		total += last.value
+		if state == "used" {
+			used += last.value
+			found = true
+		}
+		if oldest.IsZero() || last.time.Before(oldest) {
+			oldest = last.time
+		}
+	}
+	if !found || total == 0 {
+		return 0, oldest, fmt.Errorf("no used state in %s", otlpMemoryUsage)
+	}
+	return used / total, oldest, nil
+}
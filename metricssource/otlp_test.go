@@ -0,0 +1,184 @@
+package metricssource
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	s "scaler/shared"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidateOtlp(t *testing.T) {
+	s.ValidatePass(t, Otlp{Config: OtlpConfig{GrpcListenAddress: ":4317"}})
+	s.ValidatePass(t, Otlp{Config: OtlpConfig{HttpListenAddress: "127.0.0.1:4318", WindowSeconds: 60}})
+	s.ValidateFail(t, Otlp{})
+	s.ValidateFail(t, Otlp{Config: OtlpConfig{HttpListenAddress: "4318"}})
+	s.ValidateFail(t, Otlp{Config: OtlpConfig{GrpcListenAddress: ":4317", WindowSeconds: -1}})
+	s.ValidateFail(t, Otlp{Config: OtlpConfig{GrpcListenAddress: ":4317", Checks: ReadingChecks{MultipleSeries: "min"}}})
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpNumber(timestamp time.Time, value float64, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:   attributes,
+		TimeUnixNano: uint64(timestamp.UnixNano()),
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func otlpRequest(host string, metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{otlpString("host.name", host)}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func otlpSum(name string, dataPoints ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		DataPoints:             dataPoints,
+		AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		IsMonotonic:            true,
+	}}}
+}
+
+func expectUsage(t *testing.T, get func(s.ScaledObject) (float32, error), object s.ScaledObject, expected float32) {
+	t.Helper()
+	usage, err := get(object)
+	if err != nil {
+		t.Fatalf("Failed to get usage of %s: %v", object.GetName(), err)
+	}
+	if fmt.Sprintf("%.3f", usage) != fmt.Sprintf("%.3f", expected) {
+		t.Errorf("Expected usage %f of %s but got %f", expected, object.GetName(), usage)
+	}
+}
+
+// Pushes metrics over OTLP/gRPC and both encodings of OTLP/HTTP and reads them back
+func TestOtlp(t *testing.T) {
+	otlp := &Otlp{Config: OtlpConfig{GrpcListenAddress: "127.0.0.1:0", HttpListenAddress: "127.0.0.1:0"}}
+	if err := otlp.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	now := time.Now()
+
+	// bbb-1 sends the cumulative sums over gRPC, two cpus spending 30s out of 60s idle
+	connection, err := grpc.NewClient(otlp.grpcAddress.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connection.Close()
+	cpuTime := otlpSum(otlpCpuTime)
+	for _, cpu := range []string{"cpu0", "cpu1"} {
+		cpuTime.GetSum().DataPoints = append(cpuTime.GetSum().DataPoints,
+			otlpNumber(now.Add(-time.Minute), 1000, otlpString("cpu", cpu), otlpString("state", "idle")),
+			otlpNumber(now, 1010, otlpString("cpu", cpu), otlpString("state", "idle")),
+			otlpNumber(now.Add(-time.Minute), 500, otlpString("cpu", cpu), otlpString("state", "user")),
+			otlpNumber(now, 520, otlpString("cpu", cpu), otlpString("state", "user")),
+		)
+	}
+	memoryUsage := otlpSum(otlpMemoryUsage,
+		otlpNumber(now, 3, otlpString("state", "used")),
+		otlpNumber(now, 4, otlpString("state", "free")),
+		otlpNumber(now, 1, otlpString("state", "cached")),
+		otlpNumber(now, 1, otlpString("state", "slab_reclaimable")),
+	)
+	client := colmetricspb.NewMetricsServiceClient(connection)
+	if _, err := client.Export(context.Background(), otlpRequest("bbb-1", cpuTime, memoryUsage)); err != nil {
+		t.Fatalf("Failed to export over grpc: %v", err)
+	}
+	bbb1 := &s.Server{ServerName: "bbb-1"}
+	expectUsage(t, otlp.GetCpuUsage, bbb1, 2.0/3.0)
+	expectUsage(t, otlp.GetMemoryUsage, bbb1, 3.0/8.0)
+
+	// bbb-2 sends the utilization gauges as gzipped protobuf
+	cpuUtilization := &metricspb.Metric{Name: otlpCpuUtilization, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+		otlpNumber(now, 0.2, otlpString("cpu", "cpu0"), otlpString("state", "idle")),
+		otlpNumber(now, 0.4, otlpString("cpu", "cpu1"), otlpString("state", "idle")),
+		otlpNumber(now, 0.6, otlpString("cpu", "cpu1"), otlpString("state", "user")),
+	}}}}
+	raw, err := proto.Marshal(otlpRequest("bbb-2", cpuUtilization))
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(raw)
+	writer.Close()
+	request, _ := http.NewRequest(http.MethodPost, "http://"+otlp.httpAddress.String()+"/v1/metrics", &compressed)
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("Content-Encoding", "gzip")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Failed to export over http: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", response.StatusCode)
+	}
+	bbb2 := &s.Server{ServerName: "bbb-2"}
+	expectUsage(t, otlp.GetCpuUsage, bbb2, 0.7)
+
+	// bbb-2 sends the memory gauge as JSON, with 64 bit integers as strings
+	json := fmt.Sprintf(`{"resourceMetrics":[{"resource":{"attributes":[{"key":"host.name","value":{"stringValue":"bbb-2"}}]},
+		"scopeMetrics":[{"metrics":[{"name":"system.memory.utilization","unit":"1","gauge":{"dataPoints":[
+		{"attributes":[{"key":"state","value":{"stringValue":"used"}}],"timeUnixNano":"%d","asDouble":0.55}]}}]}]}]}`, now.UnixNano())
+	response, err = http.Post("http://"+otlp.httpAddress.String()+"/v1/metrics", "application/json", bytes.NewBufferString(json))
+	if err != nil {
+		t.Fatalf("Failed to export over http: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", response.StatusCode)
+	}
+	expectUsage(t, otlp.GetMemoryUsage, bbb2, 0.55)
+
+	response, err = http.Post("http://"+otlp.httpAddress.String()+"/v1/metrics", "text/plain", bytes.NewBufferString(json))
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 but got %d", response.StatusCode)
+	}
+
+	var invalid *s.InvalidReadingError
+	if _, err := otlp.GetCpuUsage(&s.Server{ServerName: "bbb-3"}); !errors.As(err, &invalid) {
+		t.Errorf("Expected invalid reading for a host without metrics but got %v", err)
+	}
+}
+
+func TestOtlpStoreWindow(t *testing.T) {
+	store := newOtlpStore("host.name", time.Minute)
+	now := time.Now()
+	request := otlpRequest("bbb-1", otlpSum(otlpCpuTime,
+		otlpNumber(now.Add(-2*time.Minute), 100, otlpString("state", "idle")),
+		otlpNumber(now.Add(-30*time.Second), 110, otlpString("state", "idle")),
+		otlpNumber(now, 120, otlpString("state", "idle")),
+		// Retried export of the same point
+		otlpNumber(now, 120, otlpString("state", "idle")),
+	))
+	store.add(request.GetResourceMetrics(), now)
+	series := store.get("bbb-1", otlpCpuTime, now)
+	if len(series) != 1 || len(series[0].points) != 2 {
+		t.Fatalf("Expected one series with 2 points in the window but got %v", series)
+	}
+	if series := store.get("bbb-1", otlpCpuTime, now.Add(2*time.Minute)); len(series) != 0 {
+		t.Errorf("Expected the series to leave the window but got %v", series)
+	}
+}
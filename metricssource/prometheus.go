@@ -1,31 +1,72 @@
 package metricssource
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	s "scaler/shared"
+	"text/template"
 	"time"
 
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"golang.org/x/exp/slog"
 )
 
 type PrometheusConfig struct {
-	Url   string
-	Token s.StringFromEnv `yaml:"token"`
+	Url          string
+	Token        s.StringFromEnv   `yaml:"token"`
+	Queries      PrometheusQueries `yaml:"queries"`
+	Aggregations Aggregations      `yaml:"aggregations"`
+	Checks       ReadingChecks     `yaml:"checks"`
+}
+
+// Go templates of the PromQL queries, with access to all the fields of the Server or Cluster
+// An empty query uses the default query for node_exporter or the IONOS DBaaS Postgres metrics
+type PrometheusQueries struct {
+	ServerCpu     string `yaml:"server_cpu"`
+	ServerMemory  string `yaml:"server_memory"`
+	ClusterCpu    string `yaml:"cluster_cpu"`
+	ClusterMemory string `yaml:"cluster_memory"`
+	// Time of the newest raw sample behind the readings, checked against checks.max_sample_age_seconds
+	// PromQL only returns the time of the samples for selectors, e.g. timestamp(node_load1), expressions are stamped with the evaluation time
+	// An empty query uses the default when the usage queries are the defaults, it must be set along with customized usage queries
+	ServerSampleTime  string `yaml:"server_sample_time"`
+	ClusterSampleTime string `yaml:"cluster_sample_time"`
+}
+
+var defaultPrometheusQueries = PrometheusQueries{
+	ServerCpu:         `avg without (mode,cpu) (1 - rate(node_cpu_seconds_total{mode="idle",instance=~"{{ .ServerName }}"}[30s]))`,
+	ServerMemory:      `1 - (node_memory_MemFree_bytes + node_memory_Cached_bytes + node_memory_Buffers_bytes) / node_memory_MemTotal_bytes{instance=~"{{ .ServerName }}"}`,
+	ClusterCpu:        `ionos_dbaas_postgres_cpu_rate5m{postgres_cluster="{{ .ClusterId }}", role="master"}`,
+	ClusterMemory:     `1 - ionos_dbaas_postgres_memory_available_bytes / ionos_dbaas_postgres_memory_total_bytes{postgres_cluster="{{ .ClusterId }}", role="master"}`,
+	ServerSampleTime:  `max(timestamp(node_cpu_seconds_total{mode="idle",instance=~"{{ .ServerName }}"}))`,
+	ClusterSampleTime: `max(timestamp(ionos_dbaas_postgres_cpu_rate5m{postgres_cluster="{{ .ClusterId }}", role="master"}))`,
+}
+
+// Parsed query templates
+type prometheusTemplates struct {
+	serverCpu         *template.Template
+	serverMemory      *template.Template
+	clusterCpu        *template.Template
+	clusterMemory     *template.Template
+	serverSampleTime  *template.Template
+	clusterSampleTime *template.Template
 }
 
 // TODO: Move the timeout to config ?
 var timeout = 5 * time.Second
 
 type Prometheus struct {
-	PrometheusConfig PrometheusConfig `yaml:"prometheus_config"`
-	API              v1.API           `yaml:"-"`
+	PrometheusConfig   PrometheusConfig `yaml:"prometheus_config"`
+	API                v1.API           `yaml:"-"`
+	templates          *prometheusTemplates
+	errorsTotalCounter prometheus.Counter
 }
 
 func (p Prometheus) Validate() error {
@@ -42,15 +83,104 @@ func (p Prometheus) Validate() error {
 	if urlParsed.Host == "" {
 		return fmt.Errorf("url host is empty")
 	}
+	queries := p.PrometheusConfig.Queries.withDefaults(defaultPrometheusQueries)
+	if _, err := queries.parse(); err != nil {
+		return fmt.Errorf("prometheus.%s", err)
+	}
+	if p.PrometheusConfig.Checks.MaxSampleAgeSeconds > 0 {
+		if err := queries.validateSampleTime(); err != nil {
+			return fmt.Errorf("prometheus.%s", err)
+		}
+	}
+	if err := p.PrometheusConfig.Aggregations.Validate(); err != nil {
+		return err
+	}
+	if err := p.PrometheusConfig.Checks.Validate(); err != nil {
+		return fmt.Errorf("prometheus.%s", err)
+	}
+	return nil
+}
+
+// Fills the empty queries with the given defaults
+// The default sample time queries only match the default usage queries
+func (q PrometheusQueries) withDefaults(defaults PrometheusQueries) PrometheusQueries {
+	if q.ServerSampleTime == "" && q.ServerCpu == "" && q.ServerMemory == "" {
+		q.ServerSampleTime = defaults.ServerSampleTime
+	}
+	if q.ClusterSampleTime == "" && q.ClusterCpu == "" && q.ClusterMemory == "" {
+		q.ClusterSampleTime = defaults.ClusterSampleTime
+	}
+	if q.ServerCpu == "" {
+		q.ServerCpu = defaults.ServerCpu
+	}
+	if q.ServerMemory == "" {
+		q.ServerMemory = defaults.ServerMemory
+	}
+	if q.ClusterCpu == "" {
+		q.ClusterCpu = defaults.ClusterCpu
+	}
+	if q.ClusterMemory == "" {
+		q.ClusterMemory = defaults.ClusterMemory
+	}
+	return q
+}
+
+// The age of the samples behind customized usage queries can only be checked with a matching sample time query
+func (q PrometheusQueries) validateSampleTime() error {
+	if q.ServerSampleTime == "" {
+		return fmt.Errorf("queries.server_sample_time must be set along with customized server queries when checks.max_sample_age_seconds is set")
+	}
+	if q.ClusterSampleTime == "" {
+		return fmt.Errorf("queries.cluster_sample_time must be set along with customized cluster queries when checks.max_sample_age_seconds is set")
+	}
 	return nil
 }
 
+func parseQueryTemplate(name, query string, sample interface{}) (*template.Template, error) {
+	parsed, err := template.New(name).Option("missingkey=error").Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("queries.%s is invalid: %s", name, err)
+	}
+	// Catch references to unknown fields before the first scaling cycle
+	if err := parsed.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, fmt.Errorf("queries.%s is invalid: %s", name, err)
+	}
+	return parsed, nil
+}
+
+func (q PrometheusQueries) parse() (*prometheusTemplates, error) {
+	var err error
+	templates := &prometheusTemplates{}
+	if templates.serverCpu, err = parseQueryTemplate("server_cpu", q.ServerCpu, s.Server{}); err != nil {
+		return nil, err
+	}
+	if templates.serverMemory, err = parseQueryTemplate("server_memory", q.ServerMemory, s.Server{}); err != nil {
+		return nil, err
+	}
+	if templates.clusterCpu, err = parseQueryTemplate("cluster_cpu", q.ClusterCpu, s.Cluster{}); err != nil {
+		return nil, err
+	}
+	if templates.clusterMemory, err = parseQueryTemplate("cluster_memory", q.ClusterMemory, s.Cluster{}); err != nil {
+		return nil, err
+	}
+	if templates.serverSampleTime, err = parseQueryTemplate("server_sample_time", q.ServerSampleTime, s.Server{}); err != nil {
+		return nil, err
+	}
+	if templates.clusterSampleTime, err = parseQueryTemplate("cluster_sample_time", q.ClusterSampleTime, s.Cluster{}); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
 func (p *Prometheus) Init() error {
-	var err error = nil
 	var rt http.RoundTripper = api.DefaultRoundTripper
 	if p.PrometheusConfig.Token != "" {
 		rt = config.NewAuthorizationCredentialsRoundTripper("Bearer", config.NewInlineSecret(string(p.PrometheusConfig.Token)), api.DefaultRoundTripper)
 	}
+	return p.initWithRoundTripper(rt, "prometheus")
+}
+
+func (p *Prometheus) initWithRoundTripper(rt http.RoundTripper, componentType string) error {
 	client, err := api.NewClient(api.Config{
 		Address:      p.PrometheusConfig.Url,
 		RoundTripper: rt,
@@ -59,70 +189,123 @@ func (p *Prometheus) Init() error {
 		return err
 	}
 	p.API = v1.NewAPI(client)
-	if err := initMetricsExporter("prometheus"); err != nil {
+	if p.templates, err = p.PrometheusConfig.Queries.withDefaults(defaultPrometheusQueries).parse(); err != nil {
+		return err
+	}
+	if p.errorsTotalCounter, err = initMetricsExporter(componentType); err != nil {
 		return fmt.Errorf("error while registering metrics: %s", err)
 	}
 	return nil
 }
 
-// Runs a query against Prometheus and returns the result as a float32
-func (p *Prometheus) Query(query string) (float32, error) {
+// Runs an instant query against Prometheus and returns the resulting vector
+func (p *Prometheus) queryVector(query string, now time.Time) (model.Vector, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
 	defer cancel()
-	result, warnings, err := p.API.Query(ctx, query, time.Now(), v1.WithTimeout(timeout))
+	result, warnings, err := p.API.Query(ctx, query, now, v1.WithTimeout(timeout))
 	if err != nil {
-		errorsTotalCounter.Inc()
-		return 0, err
+		return nil, err
 	}
 	if len(warnings) > 0 {
 		slog.Warn(fmt.Sprintf("Warnings: %v\n", warnings))
 	}
-	if result.Type() == model.ValVector {
-		vector := result.(model.Vector)
-		if len(vector) == 0 {
-			errorsTotalCounter.Inc()
-			return 0, fmt.Errorf("no data found")
-		}
-		if len(vector) != 1 {
-			// Duplicate metrics can occur if Prometheus has multiple jobs with the same targets
-			// This is not a scaler error but we should log it
-			slog.Warn(fmt.Sprintf("Unexpected vector length: %v\n", len(vector)))
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type: %v", result.Type())
+	}
+	if len(vector) > 1 {
+		slog.Warn(fmt.Sprintf("Unexpected vector length: %v\n", len(vector)))
+	}
+	return vector, nil
+}
+
+// Runs a query against Prometheus and returns the result as a float32
+func (p *Prometheus) Query(query string) (float32, error) {
+	vector, err := p.queryVector(query, time.Now())
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	value, err := p.PrometheusConfig.Checks.checkVector(vector)
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+	}
+	return value, err
+}
+
+// Checks the age of the newest sample behind the readings of an object
+// The instant query results carry the evaluation time, so the sample time is queried separately
+func (p *Prometheus) checkSampleAge(object s.ScaledObject) error {
+	if p.PrometheusConfig.Checks.MaxSampleAgeSeconds == 0 {
+		return nil
+	}
+	sampleTimeQuery, err := renderQuery(object, p.templates.serverSampleTime, p.templates.clusterSampleTime)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	vector, err := p.queryVector(sampleTimeQuery, now)
+	if err != nil {
+		return err
+	}
+	if len(vector) == 0 {
+		return invalidReading("no sample time found")
+	}
+	newest := vector[0].Value
+	for _, sample := range vector[1:] {
+		if sample.Value > newest {
+			newest = sample.Value
 		}
-		return float32(vector[0].Value), nil
-	} else {
-		errorsTotalCounter.Inc()
-		return 0, fmt.Errorf("unexpected type: %v", result.Type())
 	}
+	return p.PrometheusConfig.Checks.checkAge(time.UnixMilli(int64(float64(newest)*1000)), now)
 }
 
-// Wrapper around Query() to get the CPU usage for a scaled object
-func (p Prometheus) GetCpuUsage(object s.ScaledObject) (float32, error) {
-	var query string
+// Renders the query template of the object type
+func renderQuery(object s.ScaledObject, serverQuery, clusterQuery *template.Template) (string, error) {
+	var queryTemplate *template.Template
+	var data interface{}
 	switch objectType := object.(type) {
 	case *s.Server:
-		server := objectType
-		query = fmt.Sprintf("avg without (mode,cpu) (1 - rate(node_cpu_seconds_total{mode=\"idle\",instance=~\"%s\"}[30s]))", server.ServerName)
+		queryTemplate, data = serverQuery, *objectType
 	case *s.Cluster:
-		cluster := objectType
-		query = fmt.Sprintf("ionos_dbaas_postgres_cpu_rate5m{postgres_cluster=\"%s\", role=\"master\"}", cluster.ClusterId)
+		queryTemplate, data = clusterQuery, *objectType
 	default:
-		return 0, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+		return "", fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+	}
+	var buffer bytes.Buffer
+	if err := queryTemplate.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("error while rendering query %s for %s: %s", queryTemplate.Name(), object.GetName(), err)
+	}
+	if buffer.Len() == 0 {
+		return "", fmt.Errorf("query %s is empty for %s", queryTemplate.Name(), object.GetName())
+	}
+	return buffer.String(), nil
+}
+
+// Wrapper around Query() to get the CPU usage for a scaled object
+func (p Prometheus) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	query, err := renderQuery(object, p.templates.serverCpu, p.templates.clusterCpu)
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	if err := p.checkSampleAge(object); err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
 	}
-	return p.Query(query)
+	return p.QueryAggregated(query, p.PrometheusConfig.Aggregations.Cpu)
 }
 
 // Wrapper around Query() to get the memory usage for a scaled object
 func (p Prometheus) GetMemoryUsage(object s.ScaledObject) (float32, error) {
-	var query string
-	switch objectType := object.(type) {
-	case *s.Server:
-		server := objectType
-		query = fmt.Sprintf("1 - (node_memory_MemFree_bytes + node_memory_Cached_bytes + node_memory_Buffers_bytes) / node_memory_MemTotal_bytes{instance=~\"%s\"}", server.ServerName)
-	case *s.Cluster:
-		cluster := objectType
-		query = fmt.Sprintf("1 - ionos_dbaas_postgres_memory_available_bytes / ionos_dbaas_postgres_memory_total_bytes{postgres_cluster=\"%s\", role=\"master\"}", cluster.ClusterId)
-	default:
-		return 0, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+	query, err := renderQuery(object, p.templates.serverMemory, p.templates.clusterMemory)
+	if err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
+	}
+	if err := p.checkSampleAge(object); err != nil {
+		p.errorsTotalCounter.Inc()
+		return 0, err
 	}
-	return p.Query(query)
+	return p.QueryAggregated(query, p.PrometheusConfig.Aggregations.Memory)
 }
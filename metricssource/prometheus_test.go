@@ -45,3 +45,64 @@ func TestInitPrometheusOK(t *testing.T) {
 		t.Errorf("Error: %s", err)
 	}
 }
+
+func TestValidatePrometheusQueries(t *testing.T) {
+	prometheus := &Prometheus{
+		PrometheusConfig: PrometheusConfig{
+			Url: "https://prometheus.example.com",
+			Queries: PrometheusQueries{
+				ServerCpu: `node_load1{instance="{{ .ServerName }}:9100"}`,
+			},
+		},
+	}
+	s.ValidatePass(t, prometheus)
+	// Syntax error
+	prometheus.PrometheusConfig.Queries.ServerCpu = `node_load1{instance="{{ .ServerName }"}`
+	s.ValidateFail(t, prometheus)
+	// Unknown field
+	prometheus.PrometheusConfig.Queries.ServerCpu = ""
+	prometheus.PrometheusConfig.Queries.ClusterMemory = `pg_memory{cluster="{{ .ServerName }}"}`
+	s.ValidateFail(t, prometheus)
+}
+
+func TestRenderPrometheusQueries(t *testing.T) {
+	prometheus := &Prometheus{
+		PrometheusConfig: PrometheusConfig{
+			Url: "https://prometheus.example.com",
+			Queries: PrometheusQueries{
+				ServerMemory: `node_memory_usage{instance="{{ .ServerName }}:9100", datacenter="{{ .DatacenterId }}"}`,
+			},
+		},
+	}
+	templates, err := prometheus.PrometheusConfig.Queries.withDefaults(defaultPrometheusQueries).parse()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	prometheus.templates = templates
+	server := &s.Server{ServerName: "bbb.example.com", DatacenterId: "1234"}
+	cluster := &s.Cluster{ClusterId: "abcd"}
+
+	tests := []struct {
+		object   s.ScaledObject
+		cpu      bool
+		expected string
+	}{
+		{server, true, `avg without (mode,cpu) (1 - rate(node_cpu_seconds_total{mode="idle",instance=~"bbb.example.com"}[30s]))`},
+		{server, false, `node_memory_usage{instance="bbb.example.com:9100", datacenter="1234"}`},
+		{cluster, true, `ionos_dbaas_postgres_cpu_rate5m{postgres_cluster="abcd", role="master"}`},
+		{cluster, false, `1 - ionos_dbaas_postgres_memory_available_bytes / ionos_dbaas_postgres_memory_total_bytes{postgres_cluster="abcd", role="master"}`},
+	}
+	for _, test := range tests {
+		serverQuery, clusterQuery := prometheus.templates.serverMemory, prometheus.templates.clusterMemory
+		if test.cpu {
+			serverQuery, clusterQuery = prometheus.templates.serverCpu, prometheus.templates.clusterCpu
+		}
+		query, err := renderQuery(test.object, serverQuery, clusterQuery)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if query != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, query)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package metricssource
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	s "scaler/shared"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Replays recorded time series from files for tests and backtesting
+// The readings follow a simulated clock starting at the first sample, or at the configured start
+type Replay struct {
+	Config ReplayConfig `yaml:"replay_config"`
+	// Clock of the replay, created in Init and replaceable to drive the replay from a test or simulation
+	Clock              Clock `yaml:"-"`
+	series             map[replayKey][]replaySample
+	errorsTotalCounter prometheus.Counter
+}
+
+type ReplayConfig struct {
+	Files []ReplayFile `yaml:"files"`
+	Start time.Time    `yaml:"start"`
+	// Simulated seconds per real second, defaults to 1
+	Speed float64 `yaml:"speed"`
+}
+
+// CSV files have the columns timestamp,object,resource,value with a header line
+// JSON files are query_range responses of the Prometheus HTTP API, one resource per file
+type ReplayFile struct {
+	Path string `yaml:"path"`
+	// Resource of the series in a JSON file, cpu or memory
+	Resource string `yaml:"resource"`
+	// Label holding the object name in a JSON file, defaults to instance
+	ObjectLabel string `yaml:"object_label"`
+}
+
+type replayKey struct {
+	object   string
+	resource string
+}
+
+type replaySample struct {
+	timestamp time.Time
+	value     float32
+}
+
+const (
+	replayCpu    = "cpu"
+	replayMemory = "memory"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+// Clock running from a start time at a multiple of the real time
+type SimulatedClock struct {
+	mutex     sync.Mutex
+	start     time.Time
+	realStart time.Time
+	speed     float64
+	offset    time.Duration
+}
+
+func NewSimulatedClock(start time.Time, speed float64) *SimulatedClock {
+	return &SimulatedClock{start: start, realStart: time.Now(), speed: speed}
+}
+
+func (c ReplayConfig) speed() float64 {
+	if c.Speed == 0 {
+		return 1
+	}
+	return c.Speed
+}
+
+func (c *SimulatedClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elapsed := time.Duration(float64(time.Since(c.realStart)) * c.speed)
+	return c.start.Add(elapsed + c.offset)
+}
+
+func (c *SimulatedClock) Advance(duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.offset += duration
+}
+
+func (r *Replay) Init() error {
+	r.series = make(map[replayKey][]replaySample)
+	for _, file := range r.Config.Files {
+		if err := r.load(file); err != nil {
+			return fmt.Errorf("error while loading replay file %s: %s", file.Path, err)
+		}
+	}
+	if len(r.series) == 0 {
+		return fmt.Errorf("replay files contain no samples")
+	}
+	start := r.Config.Start
+	for key, samples := range r.series {
+		sort.Slice(samples, func(i, j int) bool { return samples[i].timestamp.Before(samples[j].timestamp) })
+		r.series[key] = samples
+		if r.Config.Start.IsZero() && (start.IsZero() || samples[0].timestamp.Before(start)) {
+			start = samples[0].timestamp
+		}
+	}
+	r.Clock = NewSimulatedClock(start, r.Config.speed())
+	var err error
+	if r.errorsTotalCounter, err = initMetricsExporter("replay"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	return nil
+}
+
+func (r *Replay) load(file ReplayFile) error {
+	reader, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if strings.EqualFold(filepath.Ext(file.Path), ".json") {
+		return r.loadJson(reader, file)
+	}
+	return r.loadCsv(reader)
+}
+
+func (r *Replay) add(object, resource string, timestamp time.Time, value float32) {
+	key := replayKey{object: object, resource: resource}
+	r.series[key] = append(r.series[key], replaySample{timestamp: timestamp, value: value})
+}
+
+func parseReplayTimestamp(raw string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func (r *Replay) loadCsv(reader io.Reader) error {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) != 4 {
+			return fmt.Errorf("line %d has %d columns instead of 4", i+1, len(record))
+		}
+		timestamp, err := parseReplayTimestamp(record[0])
+		if err != nil {
+			return fmt.Errorf("line %d has an invalid timestamp: %s", i+1, err)
+		}
+		if record[2] != replayCpu && record[2] != replayMemory {
+			return fmt.Errorf("line %d has an unknown resource: %s", i+1, record[2])
+		}
+		value, err := strconv.ParseFloat(record[3], 32)
+		if err != nil {
+			return fmt.Errorf("line %d has an invalid value: %s", i+1, err)
+		}
+		r.add(record[1], record[2], timestamp, float32(value))
+	}
+	return nil
+}
+
+// Subset of a query_range response of the Prometheus HTTP API
+type replayJson struct {
+	Data struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (r *Replay) loadJson(reader io.Reader, file ReplayFile) error {
+	var parsed replayJson
+	if err := json.NewDecoder(reader).Decode(&parsed); err != nil {
+		return err
+	}
+	objectLabel := file.objectLabel()
+	for _, series := range parsed.Data.Result {
+		object, ok := series.Metric[objectLabel]
+		if !ok {
+			return fmt.Errorf("series %v has no label %s", series.Metric, objectLabel)
+		}
+		for _, pair := range series.Values {
+			seconds, ok := pair[0].(float64)
+			if !ok {
+				return fmt.Errorf("series %s has an invalid timestamp: %v", object, pair[0])
+			}
+			raw, ok := pair[1].(string)
+			if !ok {
+				return fmt.Errorf("series %s has an invalid value: %v", object, pair[1])
+			}
+			value, err := strconv.ParseFloat(raw, 32)
+			if err != nil {
+				return fmt.Errorf("series %s has an invalid value: %s", object, err)
+			}
+			r.add(object, file.Resource, time.Unix(0, int64(seconds*float64(time.Second))).UTC(), float32(value))
+		}
+	}
+	return nil
+}
+
+func (file ReplayFile) objectLabel() string {
+	if file.ObjectLabel == "" {
+		return "instance"
+	}
+	return file.ObjectLabel
+}
+
+// Returns the last sample at or before the simulated time
+func (r Replay) read(object s.ScaledObject, resource string) (float32, error) {
+	samples, ok := r.series[replayKey{object: object.GetName(), resource: resource}]
+	if !ok {
+		r.errorsTotalCounter.Inc()
+		return 0, fmt.Errorf("no %s series recorded for %s", resource, object.GetName())
+	}
+	now := r.Clock.Now()
+	index := sort.Search(len(samples), func(i int) bool { return samples[i].timestamp.After(now) })
+	if index == 0 {
+		r.errorsTotalCounter.Inc()
+		return 0, fmt.Errorf("no %s sample recorded for %s before %s", resource, object.GetName(), now.Format(time.RFC3339))
+	}
+	value := samples[index-1].value
+	if err := checkUsage(float64(value)); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (r Replay) GetCpuUsage(object s.ScaledObject) (float32, error) {
+	return r.read(object, replayCpu)
+}
+
+func (r Replay) GetMemoryUsage(object s.ScaledObject) (float32, error) {
+	return r.read(object, replayMemory)
+}
+
+func (r Replay) Validate() error {
+	if len(r.Config.Files) == 0 {
+		return fmt.Errorf("replay.files is empty")
+	}
+	for _, file := range r.Config.Files {
+		if file.Path == "" {
+			return fmt.Errorf("replay.files.path is empty")
+		}
+		if strings.EqualFold(filepath.Ext(file.Path), ".json") && file.Resource != replayCpu && file.Resource != replayMemory {
+			return fmt.Errorf("replay.files.resource of %s must be %s or %s but got %s", file.Path, replayCpu, replayMemory, file.Resource)
+		}
+	}
+	if r.Config.Speed < 0 {
+		return fmt.Errorf("replay.speed must be greater than or equal to 0 but got %f", r.Config.Speed)
+	}
+	return nil
+}
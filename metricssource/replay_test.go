@@ -0,0 +1,75 @@
+package metricssource
+
+import (
+	s "scaler/shared"
+	"testing"
+	"time"
+)
+
+func TestValidateReplay(t *testing.T) {
+	s.ValidatePass(t, Replay{Config: ReplayConfig{Files: []ReplayFile{{Path: "load.csv"}}}})
+	s.ValidateFail(t, Replay{})
+	s.ValidateFail(t, Replay{Config: ReplayConfig{Files: []ReplayFile{{Path: "memory.json"}}}})
+	s.ValidateFail(t, Replay{Config: ReplayConfig{Files: []ReplayFile{{Path: "load.csv"}}, Speed: -1}})
+}
+
+// Clock that only moves with Advance
+func newFrozenClock(start time.Time) *SimulatedClock {
+	return NewSimulatedClock(start, 0)
+}
+
+// Drives two servers through the recorded samples with a manual clock
+func TestReplay(t *testing.T) {
+	replay := &Replay{
+		Config: ReplayConfig{
+			Files: []ReplayFile{
+				{Path: "test_files/replay_load.csv"},
+				{Path: "test_files/replay_memory.json", Resource: "memory"},
+			},
+		},
+	}
+	if err := replay.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	// Configured replays run in real time by default
+	if speed := replay.Clock.(*SimulatedClock).speed; speed != 1 {
+		t.Fatalf("Expected the clock to run at speed 1 but got %f", speed)
+	}
+	clock := newFrozenClock(time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC))
+	replay.Clock = clock
+	bbb1 := &s.Server{ServerName: "bbb-1"}
+	bbb2 := &s.Server{ServerName: "bbb-2"}
+
+	tests := []struct {
+		advance  time.Duration
+		get      func(s.ScaledObject) (float32, error)
+		object   s.ScaledObject
+		expected float32
+	}{
+		{0, replay.GetCpuUsage, bbb1, 0.12},
+		{0, replay.GetMemoryUsage, bbb2, 0.30},
+		{7 * time.Minute, replay.GetCpuUsage, bbb1, 0.65},
+		{0, replay.GetMemoryUsage, bbb2, 0.35},
+		{3 * time.Minute, replay.GetCpuUsage, bbb1, 0.91},
+		{0, replay.GetMemoryUsage, bbb1, 0.40},
+		{time.Hour, replay.GetMemoryUsage, bbb2, 0.72},
+	}
+	for i, test := range tests {
+		clock.Advance(test.advance)
+		usage, err := test.get(test.object)
+		if err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+		if usage != test.expected {
+			t.Errorf("Step %d: expected %f but got %f", i, test.expected, usage)
+		}
+	}
+
+	if _, err := replay.GetMemoryUsage(&s.Server{ServerName: "bbb-3"}); err == nil {
+		t.Fatalf("Expected error for an object without series")
+	}
+	replay.Clock = newFrozenClock(time.Date(2024, 1, 15, 7, 0, 0, 0, time.UTC))
+	if _, err := replay.GetCpuUsage(bbb1); err == nil {
+		t.Fatalf("Expected error before the first sample")
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"regexp"
 	s "scaler/shared"
+	"strings"
 	"time"
 
 	icDbaas "github.com/ionos-cloud/sdk-go-dbaas-postgres"
 	ic "github.com/ionos-cloud/sdk-go/v6"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 )
 
@@ -54,7 +57,7 @@ func (i Ionos) getServers(depth int) ([]*s.Server, error) {
 	var err error
 
 	if i.Config.ServerSource.Static != nil {
-		err = getServersStatic(&servers, i)
+		err = getServersStatic(&servers, i, depth)
 	} else if i.Config.ServerSource.Dynamic != nil {
 		err = getServersDynamic(&servers, i, depth)
 	}
@@ -65,12 +68,12 @@ func (i Ionos) getServers(depth int) ([]*s.Server, error) {
 	return servers, nil
 }
 
-func getServersStatic(servers *[]*s.Server, i Ionos) error {
+func getServersStatic(servers *[]*s.Server, i Ionos, depth int) error {
 	for _, serverSource := range *i.Config.ServerSource.Static {
 		dcServer, _, err := i.Api.ServersApi.DatacentersServersFindById(
 			context.TODO(),
 			serverSource.DatacenterId,
-			serverSource.ServerId).XContractNumber(int32(i.Config.ContractId)).Execute()
+			serverSource.ServerId).Depth(int32(depth)).XContractNumber(int32(i.Config.ContractId)).Execute()
 		if err != nil {
 			return fmt.Errorf("error while getting server %s in datacenter %s: %s", serverSource.ServerId, serverSource.DatacenterId, err)
 		}
@@ -82,7 +85,30 @@ func getServersStatic(servers *[]*s.Server, i Ionos) error {
 }
 
 func getServersDynamic(servers *[]*s.Server, i Ionos, depth int) error {
-	for _, datacenterId := range i.Config.ServerSource.Dynamic.DatacenterIds {
+	source := i.Config.ServerSource.Dynamic
+	include, exclude, err := compileNameRegexes(source.ServerNameRegex, source.ServerNameExcludeRegex)
+	if err != nil {
+		return err
+	}
+
+	// Only the datacenters holding labeled servers are listed
+	if len(source.Labels) > 0 {
+		labeledServers, err := i.getLabeledResources("server", source.Labels)
+		if err != nil {
+			return err
+		}
+		return getLabeledServers(servers, i, labeledServers, source.DatacenterIds, include, exclude, depth)
+	}
+
+	datacenterIds := source.DatacenterIds
+	if len(datacenterIds) == 0 {
+		datacenterIds, err = i.getDatacenterIds()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, datacenterId := range datacenterIds {
 		slog.Info(fmt.Sprint("Getting servers from datacenter: ", datacenterId))
 		dcServers, _, err := i.Api.ServersApi.DatacentersServersGet(context.TODO(), datacenterId).Depth(int32(depth)).XContractNumber(int32(i.Config.ContractId)).Execute()
 		if err != nil {
@@ -91,7 +117,7 @@ func getServersDynamic(servers *[]*s.Server, i Ionos, depth int) error {
 		slog.Info(fmt.Sprintf("Found %d servers in datacenter %s\n", len(*dcServers.Items), datacenterId))
 		matchCount := 0
 		for _, dcServer := range *dcServers.Items {
-			if match, _ := regexp.MatchString(i.Config.ServerSource.Dynamic.ServerNameRegex, *dcServer.Properties.Name); match {
+			if matchName(*dcServer.Properties.Name, include, exclude) {
 				matchCount++
 				server := responseToServer(dcServer, datacenterId)
 				*servers = append(*servers, &server)
@@ -102,6 +128,147 @@ func getServersDynamic(servers *[]*s.Server, i Ionos, depth int) error {
 	return nil
 }
 
+// Lists the servers of each datacenter holding labeled servers once and keeps the labeled ones,
+// restricted to the allowed datacenters if any are given
+func getLabeledServers(servers *[]*s.Server, i Ionos, labeledServers map[string]string, allowedDatacenterIds []string, include, exclude *regexp.Regexp, depth int) error {
+	var datacenterIds []string
+	for _, serverId := range labeledResourceIds(labeledServers, allowedDatacenterIds) {
+		if !slices.Contains(datacenterIds, labeledServers[serverId]) {
+			datacenterIds = append(datacenterIds, labeledServers[serverId])
+		}
+	}
+	matchCount := 0
+	for _, datacenterId := range datacenterIds {
+		dcServers, _, err := i.Api.ServersApi.DatacentersServersGet(context.TODO(), datacenterId).Depth(int32(depth)).XContractNumber(int32(i.Config.ContractId)).Execute()
+		if err != nil {
+			return fmt.Errorf("error while getting servers in datacenter %s: %s", datacenterId, err)
+		}
+		if dcServers.Items == nil {
+			continue
+		}
+		for _, dcServer := range *dcServers.Items {
+			if dcServer.Id == nil || labeledServers[*dcServer.Id] != datacenterId {
+				continue
+			}
+			if dcServer.Properties == nil || dcServer.Properties.Name == nil || !matchName(*dcServer.Properties.Name, include, exclude) {
+				continue
+			}
+			matchCount++
+			server := responseToServer(dcServer, datacenterId)
+			*servers = append(*servers, &server)
+		}
+	}
+	slog.Info(fmt.Sprintf("Matched %d labeled servers in %d datacenters\n", matchCount, len(datacenterIds)))
+	return nil
+}
+
+// Returns the IDs of all datacenters of the contract
+func (i Ionos) getDatacenterIds() ([]string, error) {
+	datacenters, _, err := i.Api.DataCentersApi.DatacentersGet(context.TODO()).Depth(0).XContractNumber(int32(i.Config.ContractId)).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting datacenters: %s", err)
+	}
+	var datacenterIds []string
+	for _, datacenter := range *datacenters.Items {
+		datacenterIds = append(datacenterIds, *datacenter.Id)
+	}
+	slog.Info(fmt.Sprintf("Found %d datacenters\n", len(datacenterIds)))
+	return datacenterIds, nil
+}
+
+// Returns the resources of the given type carrying all the given labels, mapped to their datacenter ID
+// The labels API filters by substring, so the returned labels are matched exactly again
+func (i Ionos) getLabeledResources(resourceType string, labels map[string]string) (map[string]string, error) {
+	var resources map[string]string
+	for key, value := range labels {
+		response, _, err := i.Api.LabelsApi.LabelsGet(context.TODO()).
+			Depth(1).
+			Filter("resourceType", resourceType).
+			Filter("key", key).
+			Filter("value", value).
+			XContractNumber(int32(i.Config.ContractId)).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error while getting %s labels %s=%s: %s", resourceType, key, value, err)
+		}
+		matched := make(map[string]string)
+		for _, label := range *response.Items {
+			properties := label.Properties
+			if properties == nil || properties.ResourceId == nil || properties.ResourceHref == nil ||
+				properties.ResourceType == nil || properties.Key == nil || properties.Value == nil {
+				continue
+			}
+			if *properties.ResourceType != resourceType || *properties.Key != key || *properties.Value != value {
+				continue
+			}
+			// Only keep resources that carry all the previous labels
+			if resources != nil {
+				if _, ok := resources[*properties.ResourceId]; !ok {
+					continue
+				}
+			}
+			matched[*properties.ResourceId] = datacenterIdFromHref(*properties.ResourceHref)
+		}
+		resources = matched
+	}
+	slog.Info(fmt.Sprintf("Found %d %s resources matching labels %v\n", len(resources), resourceType, labels))
+	return resources, nil
+}
+
+// Returns the sorted IDs of the labeled resources, restricted to the allowed datacenters if any are given
+func labeledResourceIds(labeledResources map[string]string, allowedDatacenterIds []string) []string {
+	var resourceIds []string
+	for resourceId, datacenterId := range labeledResources {
+		if datacenterId == "" {
+			continue
+		}
+		if len(allowedDatacenterIds) == 0 || slices.Contains(allowedDatacenterIds, datacenterId) {
+			resourceIds = append(resourceIds, resourceId)
+		}
+	}
+	slices.Sort(resourceIds)
+	return resourceIds
+}
+
+// Extracts the datacenter ID from a resource href such as .../datacenters/<id>/servers/<id>
+func datacenterIdFromHref(href string) string {
+	parts := strings.Split(strings.Trim(href, "/"), "/")
+	for index, part := range parts {
+		if part == "datacenters" && index+1 < len(parts) {
+			return parts[index+1]
+		}
+	}
+	return ""
+}
+
+// Compiles the include and exclude regexes, an empty regex is ignored
+func compileNameRegexes(includeRegex, excludeRegex string) (*regexp.Regexp, *regexp.Regexp, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if includeRegex != "" {
+		if include, err = regexp.Compile(includeRegex); err != nil {
+			return nil, nil, fmt.Errorf("invalid include regex %s: %s", includeRegex, err)
+		}
+	}
+	if excludeRegex != "" {
+		if exclude, err = regexp.Compile(excludeRegex); err != nil {
+			return nil, nil, fmt.Errorf("invalid exclude regex %s: %s", excludeRegex, err)
+		}
+	}
+	return include, exclude, nil
+}
+
+// Checks that a name matches the include regex and does not match the exclude regex
+func matchName(name string, include, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
+	}
+	if exclude != nil && exclude.MatchString(name) {
+		return false
+	}
+	return true
+}
+
 func responseToServer(response ic.Server, datacenterId string) s.Server {
 	return s.Server{
 		DatacenterId:    datacenterId,
@@ -118,11 +285,32 @@ func responseToServer(response ic.Server, datacenterId string) s.Server {
 				CurrentUsage: 0,
 			},
 		},
+		Ips:         serverIps(response),
 		LastUpdated: time.Now(),
 		Ready:       *response.Properties.VmState == "RUNNING" && *response.Metadata.State == "AVAILABLE",
 	}
 }
 
+// Returns the IPs of the NICs of the server, only included in responses with a depth of at least 3
+func serverIps(response ic.Server) []string {
+	ips := []string{}
+	if response.Entities == nil || response.Entities.Nics == nil || response.Entities.Nics.Items == nil {
+		return ips
+	}
+	for _, nic := range *response.Entities.Nics.Items {
+		if nic.Properties == nil {
+			continue
+		}
+		if nic.Properties.Ips != nil {
+			ips = append(ips, *nic.Properties.Ips...)
+		}
+		if nic.Properties.Ipv6Ips != nil {
+			ips = append(ips, *nic.Properties.Ipv6Ips...)
+		}
+	}
+	return ips
+}
+
 func (i Ionos) updateServer(server s.Server, scalingProposal s.ResourceScalingProposal) error {
 	// When scaling in different directions, scaling up overrides scaling down
 	if scalingProposal.Cpu.Direction == s.ScaleUp && scalingProposal.Mem.Direction == s.ScaleDown {
@@ -192,24 +380,74 @@ func getClustersStatic(clusters *[]*s.Cluster, i Ionos) error {
 }
 
 func getClustersDynamic(clusters *[]*s.Cluster, i Ionos) error {
+	source := i.Config.ClusterSource.Dynamic
+	include, exclude, err := compileNameRegexes(source.ClusterNameRegex, source.ClusterNameExcludeRegex)
+	if err != nil {
+		return err
+	}
+
+	var labeledDatacenterIds map[string]string
+	if len(source.DatacenterLabels) > 0 {
+		labeledDatacenterIds, err = i.getLabeledResources("datacenter", source.DatacenterLabels)
+		if err != nil {
+			return err
+		}
+	}
+
 	clustersResponse, _, err := i.DbaasApi.ClustersApi.ClustersGet(context.TODO()).Execute()
 	if err != nil {
 		return fmt.Errorf("error while getting clusters: %s", err)
 	}
 	for _, response := range *clustersResponse.Items {
-		if match, _ := regexp.MatchString(i.Config.ClusterSource.Dynamic.ClusterNameRegex, *response.Properties.DisplayName); match {
-			slog.Info(fmt.Sprintf("Matched cluster %s (%s)\n", *response.Properties.DisplayName, *response.Id))
-			cluster := responseToCluster(response)
-			*clusters = append(*clusters, &cluster)
+		if !matchName(*response.Properties.DisplayName, include, exclude) {
+			continue
+		}
+		connectedDatacenterIds := clusterDatacenterIds(response)
+		if len(source.DatacenterIds) > 0 && !containsAny(source.DatacenterIds, connectedDatacenterIds) {
+			continue
 		}
+		if labeledDatacenterIds != nil && !containsAny(maps.Keys(labeledDatacenterIds), connectedDatacenterIds) {
+			continue
+		}
+		slog.Info(fmt.Sprintf("Matched cluster %s (%s)\n", *response.Properties.DisplayName, *response.Id))
+		cluster := responseToCluster(response)
+		*clusters = append(*clusters, &cluster)
 	}
 	return nil
 }
 
+// Returns the IDs of the datacenters a cluster is connected to
+func clusterDatacenterIds(response icDbaas.ClusterResponse) []string {
+	var datacenterIds []string
+	if response.Properties.Connections == nil {
+		return datacenterIds
+	}
+	for _, connection := range *response.Properties.Connections {
+		if connection.DatacenterId != nil {
+			datacenterIds = append(datacenterIds, *connection.DatacenterId)
+		}
+	}
+	return datacenterIds
+}
+
+func containsAny(haystack, needles []string) bool {
+	for _, needle := range needles {
+		if slices.Contains(haystack, needle) {
+			return true
+		}
+	}
+	return false
+}
+
 func responseToCluster(response icDbaas.ClusterResponse) s.Cluster {
+	dnsName := ""
+	if response.Properties.DnsName != nil {
+		dnsName = *response.Properties.DnsName
+	}
 	return s.Cluster{
 		ClusterId:   *response.Id,
 		ClusterName: *response.Properties.DisplayName,
+		DnsName:     dnsName,
 		ResourceState: s.ResourceState{
 			Cpu: &s.CpuResourceState{
 				CurrentCores: *response.Properties.Cores,
@@ -342,7 +580,8 @@ func validateAndLoadContract(i *Ionos) error {
 func (i Ionos) GetScaledObjects() ([]s.ScaledObject, error) {
 	var objects []s.ScaledObject
 	if i.Config.ServerSource != nil {
-		servers, err := i.getServers(1)
+		// Depth 3 includes the IPs of the NICs
+		servers, err := i.getServers(3)
 		if err != nil {
 			return nil, fmt.Errorf("error while getting servers: %s", err)
 		}
@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"fmt"
 	s "scaler/shared"
 	"testing"
 
@@ -61,3 +62,63 @@ func TestValidateServer(t *testing.T) {
 		t.Errorf("validateServer() should fail")
 	}
 }
+
+func TestDatacenterIdFromHref(t *testing.T) {
+	hrefs := map[string]string{
+		"https://api.ionos.com/cloudapi/v6/datacenters/dc-1/servers/server-1": "dc-1",
+		"/datacenters/dc-2": "dc-2",
+		"/ipblocks/ip-1":    "",
+	}
+	for href, expected := range hrefs {
+		if got := datacenterIdFromHref(href); got != expected {
+			t.Errorf("datacenterIdFromHref(%s) = %s, expected %s", href, got, expected)
+		}
+	}
+}
+
+func TestLabeledResourceIds(t *testing.T) {
+	labeled := map[string]string{"server-3": "dc-2", "server-1": "dc-1", "server-2": "dc-2", "server-4": ""}
+	got := labeledResourceIds(labeled, nil)
+	if len(got) != 3 || got[0] != "server-1" || got[1] != "server-2" || got[2] != "server-3" {
+		t.Errorf("labeledResourceIds() = %v, expected [server-1 server-2 server-3]", got)
+	}
+	got = labeledResourceIds(labeled, []string{"dc-2", "dc-3"})
+	if len(got) != 2 || got[0] != "server-2" || got[1] != "server-3" {
+		t.Errorf("labeledResourceIds() = %v, expected [server-2 server-3]", got)
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	include, exclude, err := compileNameRegexes("^bbb-", "-test$")
+	if err != nil {
+		t.Fatalf("compileNameRegexes() failed: %v", err)
+	}
+	if !matchName("bbb-1", include, exclude) {
+		t.Errorf("bbb-1 should match")
+	}
+	if matchName("bbb-test", include, exclude) {
+		t.Errorf("bbb-test should be excluded")
+	}
+	if matchName("postgres-1", include, exclude) {
+		t.Errorf("postgres-1 should not match")
+	}
+	// Empty regexes match everything
+	include, exclude, _ = compileNameRegexes("", "")
+	if !matchName("anything", include, exclude) {
+		t.Errorf("anything should match")
+	}
+}
+
+func TestServerIps(t *testing.T) {
+	if ips := serverIps(ic.Server{}); len(ips) != 0 {
+		t.Errorf("Expected no IPs without entities but got %v", ips)
+	}
+	server := ic.Server{Entities: &ic.ServerEntities{Nics: &ic.Nics{Items: &[]ic.Nic{
+		{Properties: &ic.NicProperties{Ips: &[]string{"10.0.0.1", "10.0.0.2"}}},
+		{},
+		{Properties: &ic.NicProperties{Ips: &[]string{"192.168.0.1"}, Ipv6Ips: &[]string{"fd00::1"}}},
+	}}}}
+	if ips := serverIps(server); fmt.Sprint(ips) != "[10.0.0.1 10.0.0.2 192.168.0.1 fd00::1]" {
+		t.Errorf("Expected the IPs of all NICs but got %v", ips)
+	}
+}
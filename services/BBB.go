@@ -1,24 +1,31 @@
 package services
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/xml"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
 	s "scaler/shared"
+	"time"
 )
 
 type BBBService struct {
-	Config BBBServiceConfig `yaml:"bbb_config"`
+	Config    BBBServiceConfig `yaml:"bbb_config"`
+	client    *BBBClient
+	scalelite *resizeGate
+	schedule  *meetingSchedule
+	idle      *bbbIdleTracker
 }
 
 type BBBServiceConfig struct {
-	CycleTimeSeconds int             `yaml:"cycle_time_seconds"`
-	Resources        s.Resources     `yaml:"resources"`
-	ApiToken         s.StringFromEnv `yaml:"api_token"`
+	CycleTimeSeconds int                  `yaml:"cycle_time_seconds"`
+	Resources        s.Resources          `yaml:"resources"`
+	ApiToken         s.StringFromEnv      `yaml:"api_token"`
+	Api              BBBApiConfig         `yaml:"api"`
+	Scalelite        *ScaleliteConfig     `yaml:"scalelite"`
+	LoadWeights      *BBBLoadWeights      `yaml:"load_weights"`
+	LoadThresholds   *BBBLoadThresholds   `yaml:"load_thresholds"`
+	Prewarming       *BBBPrewarmingConfig `yaml:"prewarming"`
+	GradualScaleDown *BBBScaleDownConfig  `yaml:"gradual_scale_down"`
 }
 
 // BBBGetMeetingsResponseXML is the XML response from the BBB API when calling getMeetings
@@ -29,16 +36,38 @@ type BBBGetMeetingsResponseXML struct {
 	MessageKey string   `xml:"messageKey"`
 	Message    string   `xml:"message"`
 	Meetings   struct {
-		Meeting []struct {
-			ParticipantCount int `xml:"participantCount"`
-		} `xml:"meeting"`
+		Meeting []BBBMeetingXML `xml:"meeting"`
 	} `xml:"meetings"`
 }
 
-func (bbb BBBService) Init() error {
+type BBBMeetingXML struct {
+	ParticipantCount      int  `xml:"participantCount"`
+	ListenerCount         int  `xml:"listenerCount"`
+	VoiceParticipantCount int  `xml:"voiceParticipantCount"`
+	VideoCount            int  `xml:"videoCount"`
+	ModeratorCount        int  `xml:"moderatorCount"`
+	Recording             bool `xml:"recording"`
+	IsBreakout            bool `xml:"isBreakout"`
+}
+
+func (bbb *BBBService) Init() error {
 	if err := initMetricsExporter("bbb"); err != nil {
 		return fmt.Errorf("error while registering metrics: %s", err)
 	}
+	client, err := NewBBBClient(bbb.Config.Api, string(bbb.Config.ApiToken))
+	if err != nil {
+		return fmt.Errorf("error while creating BBB API client: %s", err)
+	}
+	bbb.client = client
+	if bbb.Config.Scalelite != nil {
+		bbb.scalelite = newResizeGate(newScaleliteClient(*bbb.Config.Scalelite, client.Hostname), bbb.Config.Scalelite.DrainScaleUp)
+	}
+	if bbb.Config.Prewarming != nil {
+		bbb.schedule = newMeetingSchedule(*bbb.Config.Prewarming, time.Duration(bbb.Config.CycleTimeSeconds)*time.Second)
+	}
+	if bbb.Config.GradualScaleDown != nil {
+		bbb.idle = newBBBIdleTracker()
+	}
 	return nil
 }
 
@@ -46,28 +75,6 @@ func (bbb *BBBService) GetConfig() BBBServiceConfig {
 	return bbb.Config
 }
 
-// Signs a BBB API request according to https://docs.bigbluebutton.org/development/api/#usage
-func signedBBBAPIRequest(serverUrl, endpoint, parameters, apiToken string) string {
-	queryString := endpoint + parameters + apiToken
-	checksumRaw := sha1.Sum([]byte(queryString))
-	checksumHex := hex.EncodeToString(checksumRaw[:])
-	return fmt.Sprintf("https://%s/bigbluebutton/api/%s?%s&checksum=%s", serverUrl, endpoint, parameters, checksumHex)
-}
-
-func doBBBAPICall(serverUrl, endpoint, parameters, apiToken string) ([]byte, error) {
-	url := signedBBBAPIRequest(serverUrl, endpoint, parameters, apiToken)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	return body, nil
-}
-
 // Count the total number of participants in all meetings
 func countParticipants(meetingsResponse *BBBGetMeetingsResponseXML) int {
 	count := 0
@@ -88,21 +95,36 @@ func parseBBBGetMeetingsResponseXML(xmlRaw []byte) (*BBBGetMeetingsResponseXML,
 	return xmlParsed, nil
 }
 
-func getMeetings(serverUrl, apiToken string) (*BBBGetMeetingsResponseXML, error) {
-	body, err := doBBBAPICall(serverUrl, "getMeetings", "", apiToken)
+func (bbb BBBService) GetParticipantsCount(server s.Server) (int, error) {
+	meetingsResponse, err := bbb.client.GetMeetings(server)
 	if err != nil {
-		return nil, err
+		errorsTotalCounter.Inc()
+		return 0, err
 	}
-	return parseBBBGetMeetingsResponseXML(body)
+	return countParticipants(meetingsResponse), nil
 }
 
-func (bbb BBBService) GetParticipantsCount(serverUrl string) (int, error) {
-	meetingsResponse, err := getMeetings(serverUrl, string(bbb.Config.ApiToken))
+func (bbb BBBService) GetLoad(server s.Server) (BBBLoad, error) {
+	meetingsResponse, err := bbb.client.GetMeetings(server)
 	if err != nil {
 		errorsTotalCounter.Inc()
-		return 0, err
+		return BBBLoad{}, err
 	}
-	return countParticipants(meetingsResponse), nil
+	return computeBBBLoad(meetingsResponse), nil
+}
+
+func (bbb BBBService) getLoadWeights() BBBLoadWeights {
+	if bbb.Config.LoadWeights == nil {
+		return defaultBBBLoadWeights
+	}
+	return *bbb.Config.LoadWeights
+}
+
+func (bbb BBBService) getLoadThresholds() BBBLoadThresholds {
+	if bbb.Config.LoadThresholds == nil {
+		return BBBLoadThresholds{}
+	}
+	return *bbb.Config.LoadThresholds
 }
 
 func (bbb BBBService) GetResources() s.Resources {
@@ -122,20 +144,51 @@ func (bbb BBBService) ComputeScalingProposal(object s.ScaledObject) (s.ResourceS
 		return s.ResourceScalingProposal{}, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
 	}
 
+	if bbb.scalelite != nil {
+		if err := bbb.scalelite.finishResize(*server); err != nil {
+			errorsTotalCounter.Inc()
+			return s.ResourceScalingProposal{}, fmt.Errorf("error while enabling server in scalelite: %s", err)
+		}
+	}
+
 	if !server.Ready {
 		return s.ResourceScalingProposal{}, fmt.Errorf("server %s is not ready", server.ServerName)
 	}
 
-	participantsCount, err := bbb.GetParticipantsCount(server.ServerName)
+	load, err := bbb.GetLoad(*server)
 	if err != nil {
-		return s.ResourceScalingProposal{}, fmt.Errorf("error while getting participants count: %s", err)
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while getting load: %s", err)
+	}
+	loadScore := load.Score(bbb.getLoadWeights())
+	loadScoreGauge.WithLabelValues(server.ServerName).Set(loadScore)
+	participantsCount := load.Participants
+
+	proposal := bbb.computeScalingProposalInternal(*server, participantsCount, loadScore)
+
+	if bbb.idle != nil {
+		idle := bbb.idle.observe(*server, participantsCount, time.Now())
+		proposal = bbb.applyGradualScaleDown(*server, proposal, load.Meetings, idle)
+	}
+
+	if bbb.schedule != nil {
+		leadTime := time.Duration(bbb.Config.Prewarming.LeadTimeSeconds) * time.Second
+		scheduled := expectedParticipants(bbb.schedule.getMeetings(), server.ServerName, time.Now(), leadTime)
+		proposal = bbb.applyPrewarming(*server, proposal, participantsCount, scheduled)
 	}
 
-	return bbb.computeScalingProposalInternal(*server, participantsCount), nil
+	// Resizing reboots the server, so it is drained in Scalelite first
+	if bbb.scalelite != nil {
+		proposal, err = bbb.scalelite.gateResize(*server, participantsCount, proposal)
+		if err != nil {
+			errorsTotalCounter.Inc()
+			return s.ResourceScalingProposal{}, fmt.Errorf("error while draining server in scalelite: %s", err)
+		}
+	}
+	return proposal, nil
 }
 
 // Applies the BBB scaling rules to decide how to scale
-func (bbb BBBService) computeScalingProposalInternal(server s.Server, participantsCount int) s.ResourceScalingProposal {
+func (bbb BBBService) computeScalingProposalInternal(server s.Server, participantsCount int, loadScore float64) s.ResourceScalingProposal {
 	targetResource := s.ResourceScalingProposal{
 		Cpu: s.ScaleOp{
 			Direction: s.ScaleNone,
@@ -151,9 +204,14 @@ func (bbb BBBService) computeScalingProposalInternal(server s.Server, participan
 
 	// Scaling rules:
 	// 1. Scale up if current resource is below configured minimum
-	// 2. Scale up if current resource usage exceeds maximum usage and there are participants
+	// 2. Scale up if current resource usage exceeds maximum usage and the load is above the scale-up threshold
 	// Add enough resources to either reach usage below the maximum usage or the maximum amount of resources
-	// 3. Scale down to the configured minimum if there are no participants
+	// 3. Scale down to the configured minimum if the load is at or below the scale-down threshold
+	// With gradual scale down, Rule 3 is replaced by steps based on the minimum usage, see applyGradualScaleDown
+	// The load is the weighted score of the meetings, by default the participants count
+	// Without Scalelite to wait for the participants to leave, a server with participants is never scaled down by Rule 3
+
+	thresholds := bbb.getLoadThresholds()
 
 	// Rule 1 CPU
 	if server.ResourceState.Cpu.CurrentCores < int32(bbb.Config.Resources.Cpu.MinCores) {
@@ -163,7 +221,7 @@ func (bbb BBBService) computeScalingProposalInternal(server s.Server, participan
 	}
 
 	// Rule 2 CPU
-	if cpuMaxUsageDelta := server.ResourceState.Cpu.CurrentUsage - bbb.Config.Resources.Cpu.MaxUsage; cpuMaxUsageDelta > 0 && server.ResourceState.Cpu.CurrentCores < int32(bbb.Config.Resources.Cpu.MaxCores) && participantsCount > 0 {
+	if cpuMaxUsageDelta := server.ResourceState.Cpu.CurrentUsage - bbb.Config.Resources.Cpu.MaxUsage; cpuMaxUsageDelta > 0 && server.ResourceState.Cpu.CurrentCores < int32(bbb.Config.Resources.Cpu.MaxCores) && loadScore > thresholds.ScaleUp {
 		targetResource.Cpu.Direction = s.ScaleUp
 		targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 2: usage above maximum"
 		cpuInc := cpuMaxUsageDelta * float32(server.ResourceState.Cpu.CurrentCores) / server.ResourceState.Cpu.CurrentUsage
@@ -179,7 +237,7 @@ func (bbb BBBService) computeScalingProposalInternal(server s.Server, participan
 	}
 
 	// Rule 2 memory
-	if memMaxUsageDelta := server.ResourceState.Memory.CurrentUsage - bbb.Config.Resources.Memory.MaxUsage; memMaxUsageDelta > 0 && server.ResourceState.Memory.CurrentBytes < int32(bbb.Config.Resources.Memory.MaxBytes) && participantsCount > 0 {
+	if memMaxUsageDelta := server.ResourceState.Memory.CurrentUsage - bbb.Config.Resources.Memory.MaxUsage; memMaxUsageDelta > 0 && server.ResourceState.Memory.CurrentBytes < int32(bbb.Config.Resources.Memory.MaxBytes) && loadScore > thresholds.ScaleUp {
 		targetResource.Mem.Direction = s.ScaleUp
 		targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 2: usage above maximum"
 		memInc := memMaxUsageDelta * float32(server.ResourceState.Memory.CurrentBytes) / server.ResourceState.Memory.CurrentUsage
@@ -188,15 +246,15 @@ func (bbb BBBService) computeScalingProposalInternal(server s.Server, participan
 	}
 
 	// Rule 3 CPU and memory
-	if participantsCount == 0 {
+	if loadScore <= thresholds.ScaleDown && (participantsCount == 0 || bbb.Config.Scalelite != nil) && bbb.Config.GradualScaleDown == nil {
 		if server.ResourceState.Memory.CurrentBytes > int32(bbb.Config.Resources.Memory.MinBytes) {
 			targetResource.Mem.Direction = s.ScaleDown
-			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 3: no participants"
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 3: load at or below threshold"
 			targetResource.Mem.Amount = int32(bbb.Config.Resources.Memory.MinBytes) - server.ResourceState.Memory.CurrentBytes
 		}
 		if server.ResourceState.Cpu.CurrentCores > int32(bbb.Config.Resources.Cpu.MinCores) {
 			targetResource.Cpu.Direction = s.ScaleDown
-			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 3: no participants"
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 3: load at or below threshold"
 			targetResource.Cpu.Amount = int32(bbb.Config.Resources.Cpu.MinCores) - server.ResourceState.Cpu.CurrentCores
 		}
 	}
@@ -215,8 +273,43 @@ func (config BBBServiceConfig) Validate() error {
 	if err := config.Resources.Validate(); err != nil {
 		return err
 	}
+	// Both resources are needed as the rules apply to CPU and memory
+	if config.Resources.Cpu == nil || config.Resources.Memory == nil {
+		return fmt.Errorf("bbb.resources.cpu and bbb.resources.memory must be set")
+	}
 	if config.ApiToken == "" {
 		return fmt.Errorf("bbb.api_token is empty")
 	}
+	if err := config.Api.Validate(); err != nil {
+		return err
+	}
+	if config.Scalelite != nil {
+		if err := config.Scalelite.Validate(); err != nil {
+			return err
+		}
+	}
+	if config.LoadWeights != nil {
+		if err := config.LoadWeights.Validate(); err != nil {
+			return err
+		}
+	}
+	if config.LoadThresholds != nil {
+		if err := config.LoadThresholds.Validate(); err != nil {
+			return err
+		}
+	}
+	if config.Prewarming != nil {
+		if err := config.Prewarming.Validate(); err != nil {
+			return err
+		}
+	}
+	if config.GradualScaleDown != nil {
+		if err := config.GradualScaleDown.Validate(); err != nil {
+			return err
+		}
+		if config.Resources.Cpu.MinUsage == 0 && config.Resources.Memory.MinUsage == 0 {
+			return fmt.Errorf("bbb.gradual_scale_down needs min_usage of cpu or memory to be set")
+		}
+	}
 	return nil
 }
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	s "scaler/shared"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type BBBApiConfig struct {
+	// Go template of the API base URL, with access to .Host and the Server fields
+	UrlTemplate       string            `yaml:"url_template"`
+	TimeoutSeconds    int               `yaml:"timeout_seconds"`
+	CaFile            string            `yaml:"ca_file"`
+	ChecksumAlgorithm string            `yaml:"checksum_algorithm"`
+	Hostnames         map[string]string `yaml:"hostnames"`
+}
+
+const (
+	defaultBBBUrlTemplate    = "https://{{ .Host }}/bigbluebutton/api/"
+	defaultBBBTimeoutSeconds = 10
+)
+
+// Checksum algorithms supported by the BBB API
+var bbbChecksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Values available to the URL template
+type bbbUrlTemplateData struct {
+	s.Server
+	Host string
+}
+
+// Client for the BBB API of a set of servers sharing the same secret
+type BBBClient struct {
+	HttpClient  *http.Client
+	urlTemplate *template.Template
+	checksum    func() hash.Hash
+	secret      string
+	hostnames   map[string]string
+}
+
+func NewBBBClient(config BBBApiConfig, secret string) (*BBBClient, error) {
+	urlTemplate, err := config.parseUrlTemplate()
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.TimeoutSeconds
+	if timeout == 0 {
+		timeout = defaultBBBTimeoutSeconds
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CaFile != "" {
+		caPem, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading CA file: %s", err)
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", config.CaFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: caPool}
+	}
+	return &BBBClient{
+		HttpClient: &http.Client{
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: transport,
+		},
+		urlTemplate: urlTemplate,
+		checksum:    bbbChecksumAlgorithms[config.checksumAlgorithm()],
+		secret:      secret,
+		hostnames:   config.Hostnames,
+	}, nil
+}
+
+func (config BBBApiConfig) parseUrlTemplate() (*template.Template, error) {
+	urlTemplate := config.UrlTemplate
+	if urlTemplate == "" {
+		urlTemplate = defaultBBBUrlTemplate
+	}
+	parsed, err := template.New("bbb_url").Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("bbb.api.url_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (config BBBApiConfig) checksumAlgorithm() string {
+	if config.ChecksumAlgorithm == "" {
+		return "sha1"
+	}
+	return config.ChecksumAlgorithm
+}
+
+// Returns the BBB hostname of a server, which defaults to the server name
+func (c *BBBClient) Hostname(server s.Server) string {
+	if hostname, ok := c.hostnames[server.ServerName]; ok {
+		return hostname
+	}
+	return server.ServerName
+}
+
+func (c *BBBClient) baseUrl(server s.Server) (string, error) {
+	var buffer bytes.Buffer
+	if err := c.urlTemplate.Execute(&buffer, bbbUrlTemplateData{Server: server, Host: c.Hostname(server)}); err != nil {
+		return "", fmt.Errorf("error while rendering url template for %s: %s", server.ServerName, err)
+	}
+	baseUrl := buffer.String()
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+	return baseUrl, nil
+}
+
+// Signs a BBB API request according to https://docs.bigbluebutton.org/development/api/#usage
+func (c *BBBClient) SignedUrl(server s.Server, endpoint, parameters string) (string, error) {
+	baseUrl, err := c.baseUrl(server)
+	if err != nil {
+		return "", err
+	}
+	checksum := c.checksum()
+	checksum.Write([]byte(endpoint + parameters + c.secret))
+	checksumHex := hex.EncodeToString(checksum.Sum(nil))
+	if parameters == "" {
+		return fmt.Sprintf("%s%s?checksum=%s", baseUrl, endpoint, checksumHex), nil
+	}
+	return fmt.Sprintf("%s%s?%s&checksum=%s", baseUrl, endpoint, parameters, checksumHex), nil
+}
+
+func (c *BBBClient) Call(server s.Server, endpoint, parameters string) ([]byte, error) {
+	url, err := c.SignedUrl(server, endpoint, parameters)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HttpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("BBB API %s returned %d", endpoint, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *BBBClient) GetMeetings(server s.Server) (*BBBGetMeetingsResponseXML, error) {
+	body, err := c.Call(server, "getMeetings", "")
+	if err != nil {
+		return nil, err
+	}
+	return parseBBBGetMeetingsResponseXML(body)
+}
+
+func (config BBBApiConfig) Validate() error {
+	if _, err := config.parseUrlTemplate(); err != nil {
+		return err
+	}
+	if config.TimeoutSeconds < 0 {
+		return fmt.Errorf("bbb.api.timeout_seconds must be greater than or equal to 0 but got %d", config.TimeoutSeconds)
+	}
+	if _, ok := bbbChecksumAlgorithms[config.checksumAlgorithm()]; !ok {
+		return fmt.Errorf("bbb.api.checksum_algorithm %s is not supported", config.ChecksumAlgorithm)
+	}
+	for serverName, hostname := range config.Hostnames {
+		if hostname == "" {
+			return fmt.Errorf("bbb.api.hostnames.%s is empty", serverName)
+		}
+	}
+	return nil
+}
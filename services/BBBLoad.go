@@ -0,0 +1,100 @@
+package services
+
+import "fmt"
+
+// Weights applied to the getMeetings counters to compute the load score of a BBB server
+// Video streams and voice users weigh much more on a server than listeners
+type BBBLoadWeights struct {
+	Participant      float64 `yaml:"participant"`
+	Listener         float64 `yaml:"listener"`
+	VoiceParticipant float64 `yaml:"voice_participant"`
+	Video            float64 `yaml:"video"`
+	Moderator        float64 `yaml:"moderator"`
+	Recording        float64 `yaml:"recording"`
+	BreakoutRoom     float64 `yaml:"breakout_room"`
+}
+
+// Without configured weights the load score is the participants count
+var defaultBBBLoadWeights = BBBLoadWeights{Participant: 1}
+
+// Load score thresholds of the scaling rules
+type BBBLoadThresholds struct {
+	// Rule 2 only scales up above this score, by default any load counts
+	ScaleUp float64 `yaml:"scale_up"`
+	// Rule 3 only scales down at or below this score, by default only a server without load
+	ScaleDown float64 `yaml:"scale_down"`
+}
+
+// Load counters summed over all meetings of a BBB server
+type BBBLoad struct {
+	Meetings          int
+	Participants      int
+	Listeners         int
+	VoiceParticipants int
+	Videos            int
+	Moderators        int
+	Recordings        int
+	BreakoutRooms     int
+}
+
+func computeBBBLoad(meetingsResponse *BBBGetMeetingsResponseXML) BBBLoad {
+	load := BBBLoad{}
+	for _, meeting := range meetingsResponse.Meetings.Meeting {
+		load.Meetings++
+		load.Participants += meeting.ParticipantCount
+		load.Listeners += meeting.ListenerCount
+		load.VoiceParticipants += meeting.VoiceParticipantCount
+		load.Videos += meeting.VideoCount
+		load.Moderators += meeting.ModeratorCount
+		if meeting.Recording {
+			load.Recordings++
+		}
+		if meeting.IsBreakout {
+			load.BreakoutRooms++
+		}
+	}
+	return load
+}
+
+func (load BBBLoad) Score(weights BBBLoadWeights) float64 {
+	return weights.Participant*float64(load.Participants) +
+		weights.Listener*float64(load.Listeners) +
+		weights.VoiceParticipant*float64(load.VoiceParticipants) +
+		weights.Video*float64(load.Videos) +
+		weights.Moderator*float64(load.Moderators) +
+		weights.Recording*float64(load.Recordings) +
+		weights.BreakoutRoom*float64(load.BreakoutRooms)
+}
+
+func (w BBBLoadWeights) Validate() error {
+	weights := map[string]float64{
+		"participant":       w.Participant,
+		"listener":          w.Listener,
+		"voice_participant": w.VoiceParticipant,
+		"video":             w.Video,
+		"moderator":         w.Moderator,
+		"recording":         w.Recording,
+		"breakout_room":     w.BreakoutRoom,
+	}
+	total := 0.0
+	for name, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("bbb.load_weights.%s must be greater than or equal to 0 but got %f", name, weight)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("bbb.load_weights are all 0, at least one must be set")
+	}
+	return nil
+}
+
+func (t BBBLoadThresholds) Validate() error {
+	if t.ScaleUp < 0 || t.ScaleDown < 0 {
+		return fmt.Errorf("bbb.load_thresholds must be greater than or equal to 0 but got %f and %f", t.ScaleUp, t.ScaleDown)
+	}
+	if t.ScaleDown > t.ScaleUp {
+		return fmt.Errorf("bbb.load_thresholds.scale_down (%f) must not be greater than scale_up (%f)", t.ScaleDown, t.ScaleUp)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	s "scaler/shared"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Pre-warming scales BBB servers up ahead of scheduled meetings so that the reboot happens before people join
+// The schedule is read either from an HTTP JSON endpoint or from a local file
+type BBBPrewarmingConfig struct {
+	Url                 string          `yaml:"url"`
+	File                string          `yaml:"file"`
+	Token               s.StringFromEnv `yaml:"token"`
+	LeadTimeSeconds     int             `yaml:"lead_time_seconds"`
+	ParticipantsPerCore float64         `yaml:"participants_per_core"`
+}
+
+// A meeting booked ahead of time, targeted at a BBB server by its name
+// Once started, its participants are part of the server load, so only the start is needed
+type ScheduledMeeting struct {
+	Server               string    `json:"server"`
+	Start                time.Time `json:"start"`
+	ExpectedParticipants int       `json:"expected_participants"`
+}
+
+type meetingSchedule struct {
+	config      BBBPrewarmingConfig
+	httpClient  *http.Client
+	maxAge      time.Duration
+	meetings    []ScheduledMeeting
+	lastAttempt time.Time
+}
+
+func newMeetingSchedule(config BBBPrewarmingConfig, maxAge time.Duration) *meetingSchedule {
+	return &meetingSchedule{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		maxAge:     maxAge,
+	}
+}
+
+func (schedule *meetingSchedule) read() ([]byte, error) {
+	if schedule.config.File != "" {
+		return os.ReadFile(schedule.config.File)
+	}
+	request, err := http.NewRequest(http.MethodGet, schedule.config.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.config.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+string(schedule.config.Token))
+	}
+	resp, err := schedule.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schedule endpoint returned %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Returns the scheduled meetings, they are fetched again once they are older than the cycle time
+// On error the previous schedule is kept until the next attempt, one cycle time later, as pre-warming is best effort
+func (schedule *meetingSchedule) getMeetings() []ScheduledMeeting {
+	if time.Since(schedule.lastAttempt) < schedule.maxAge {
+		return schedule.meetings
+	}
+	schedule.lastAttempt = time.Now()
+	raw, err := schedule.read()
+	if err == nil {
+		var meetings []ScheduledMeeting
+		if err = json.Unmarshal(raw, &meetings); err == nil {
+			schedule.meetings = meetings
+			slog.Info(fmt.Sprintf("Loaded %d scheduled meetings\n", len(meetings)))
+		}
+	}
+	if err != nil {
+		errorsTotalCounter.Inc()
+		slog.Warn(fmt.Sprint("Error while loading scheduled meetings, keeping previous schedule: ", err))
+	}
+	return schedule.meetings
+}
+
+// Sums the expected participants of the meetings on a server that start within the lead time
+func expectedParticipants(meetings []ScheduledMeeting, serverName string, now time.Time, leadTime time.Duration) int {
+	count := 0
+	for _, meeting := range meetings {
+		if meeting.Server != serverName {
+			continue
+		}
+		if now.Before(meeting.Start.Add(-leadTime)) || !now.Before(meeting.Start) {
+			continue
+		}
+		count += meeting.ExpectedParticipants
+	}
+	return count
+}
+
+// Rule 4: make sure an empty server has enough cores for the scheduled meetings
+// This overrides a scale down below the required cores and scales up if needed
+// A server with participants is left to the usage based rules, as resizing it would interrupt the running meetings
+func (bbb BBBService) applyPrewarming(server s.Server, proposal s.ResourceScalingProposal, currentParticipants int, expectedParticipants int) s.ResourceScalingProposal {
+	if expectedParticipants == 0 || currentParticipants > 0 || bbb.Config.Resources.Cpu == nil {
+		return proposal
+	}
+	config := bbb.Config.Prewarming
+	requiredCores := int32(math.Ceil(float64(expectedParticipants) / config.ParticipantsPerCore))
+	requiredCores = int32(math.Min(float64(requiredCores), float64(bbb.Config.Resources.Cpu.MaxCores)))
+
+	currentCores := server.ResourceState.Cpu.CurrentCores
+	if currentCores+proposal.Cpu.Amount >= requiredCores {
+		return proposal
+	}
+	proposal.Cpu.Amount = requiredCores - currentCores
+	proposal.Cpu.Reason = proposal.Cpu.Reason + fmt.Sprintf(",Rule 4: %d participants scheduled", expectedParticipants)
+	switch {
+	case proposal.Cpu.Amount > 0:
+		proposal.Cpu.Direction = s.ScaleUp
+	case proposal.Cpu.Amount < 0:
+		proposal.Cpu.Direction = s.ScaleDown
+	default:
+		proposal.Cpu.Direction = s.ScaleNone
+	}
+	return proposal
+}
+
+func (config BBBPrewarmingConfig) Validate() error {
+	if (config.Url == "") == (config.File == "") {
+		return fmt.Errorf("bbb.prewarming.url and bbb.prewarming.file are both set or both empty, exactly one must be set")
+	}
+	if config.Url != "" {
+		urlParsed, err := url.Parse(config.Url)
+		if err != nil {
+			return fmt.Errorf("bbb.prewarming.url is invalid: %v", err)
+		}
+		if urlParsed.Scheme != "http" && urlParsed.Scheme != "https" {
+			return fmt.Errorf("bbb.prewarming.url scheme is invalid: %s", urlParsed.Scheme)
+		}
+	}
+	if config.LeadTimeSeconds <= 0 {
+		return fmt.Errorf("bbb.prewarming.lead_time_seconds must be greater than 0 but got %d", config.LeadTimeSeconds)
+	}
+	if config.ParticipantsPerCore <= 0 {
+		return fmt.Errorf("bbb.prewarming.participants_per_core must be greater than 0 but got %f", config.ParticipantsPerCore)
+	}
+	return nil
+}
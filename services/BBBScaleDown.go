@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	s "scaler/shared"
+	"time"
+)
+
+// Gradual scale down replaces Rule 3, which drops a server to the minimum as soon as its load reaches the scale-down threshold
+// Resources are removed step by step once the server has been idle long enough
+type BBBScaleDownConfig struct {
+	// Seconds the participants count must not have grown before stepping down
+	IdleTimeSeconds int `yaml:"idle_time_seconds"`
+	// Largest decrease per step, 0 means the step is only limited by the minimum usage
+	MaxStepCores int `yaml:"max_step_cores"`
+	MaxStepBytes int `yaml:"max_step_bytes"`
+}
+
+// Participant trend of a server since its last resize
+type bbbIdleState struct {
+	since        time.Time
+	participants int
+	cores        int32
+	memory       int32
+}
+
+type bbbIdleTracker struct {
+	states map[string]*bbbIdleState
+}
+
+func newBBBIdleTracker() *bbbIdleTracker {
+	return &bbbIdleTracker{states: make(map[string]*bbbIdleState)}
+}
+
+// Returns for how long the participants count has not grown on the server
+// The idle time starts again when participants join or when the server was resized, so each step waits for the idle time
+func (tracker *bbbIdleTracker) observe(server s.Server, participants int, now time.Time) time.Duration {
+	cores := server.ResourceState.Cpu.CurrentCores
+	memory := server.ResourceState.Memory.CurrentBytes
+	state, ok := tracker.states[server.ServerId]
+	if !ok || participants > state.participants || cores != state.cores || memory != state.memory {
+		state = &bbbIdleState{since: now, cores: cores, memory: memory}
+		tracker.states[server.ServerId] = state
+	}
+	state.participants = participants
+	return now.Sub(state.since)
+}
+
+// Rule 3 gradual: step down resources with usage below the minimum usage
+// Only while no meetings are running, as the resize reboots the server, and after the idle time
+func (bbb BBBService) applyGradualScaleDown(server s.Server, proposal s.ResourceScalingProposal, meetings int, idle time.Duration) s.ResourceScalingProposal {
+	config := bbb.Config.GradualScaleDown
+	idleTime := time.Duration(config.IdleTimeSeconds) * time.Second
+	if meetings > 0 || idle < idleTime {
+		return proposal
+	}
+	reason := fmt.Sprintf(",Rule 3: idle for %ds", int(idle.Seconds()))
+
+	cpu := bbb.Config.Resources.Cpu
+	currentCores := server.ResourceState.Cpu.CurrentCores
+	currentCpuUsage := server.ResourceState.Cpu.CurrentUsage
+	if cpuMinUsageDelta := cpu.MinUsage - currentCpuUsage; proposal.Cpu.Direction == s.ScaleNone && cpuMinUsageDelta > 0 && currentCores > int32(cpu.MinCores) {
+		cpuDec := int32(math.Ceil(float64(cpuMinUsageDelta * float32(currentCores) / cpu.MinUsage)))
+		if config.MaxStepCores > 0 {
+			cpuDec = int32(math.Min(float64(cpuDec), float64(config.MaxStepCores)))
+		}
+		proposal.Cpu.Direction = s.ScaleDown
+		proposal.Cpu.Reason = proposal.Cpu.Reason + reason
+		proposal.Cpu.Amount = int32(math.Max(float64(currentCores-cpuDec), float64(cpu.MinCores))) - currentCores
+	}
+
+	memory := bbb.Config.Resources.Memory
+	currentMemory := server.ResourceState.Memory.CurrentBytes
+	currentMemoryUsage := server.ResourceState.Memory.CurrentUsage
+	if memMinUsageDelta := memory.MinUsage - currentMemoryUsage; proposal.Mem.Direction == s.ScaleNone && memMinUsageDelta > 0 && currentMemory > int32(memory.MinBytes) {
+		memDec := int32(math.Ceil(float64(memMinUsageDelta * float32(currentMemory) / memory.MinUsage)))
+		if config.MaxStepBytes > 0 {
+			memDec = int32(math.Min(float64(memDec), float64(config.MaxStepBytes)))
+		}
+		proposal.Mem.Direction = s.ScaleDown
+		proposal.Mem.Reason = proposal.Mem.Reason + reason
+		proposal.Mem.Amount = int32(math.Max(float64(currentMemory-memDec), float64(memory.MinBytes))) - currentMemory
+	}
+	return proposal
+}
+
+func (config BBBScaleDownConfig) Validate() error {
+	if config.IdleTimeSeconds <= 0 {
+		return fmt.Errorf("bbb.gradual_scale_down.idle_time_seconds must be greater than 0 but got %d", config.IdleTimeSeconds)
+	}
+	if config.MaxStepCores < 0 {
+		return fmt.Errorf("bbb.gradual_scale_down.max_step_cores must be greater than or equal to 0 but got %d", config.MaxStepCores)
+	}
+	if config.MaxStepBytes < 0 {
+		return fmt.Errorf("bbb.gradual_scale_down.max_step_bytes must be greater than or equal to 0 but got %d", config.MaxStepBytes)
+	}
+	return nil
+}
@@ -118,20 +118,100 @@ func TestCountParticipants(t *testing.T) {
 	}
 }
 
+func TestComputeBBBLoad(t *testing.T) {
+	responseBytes, err := os.ReadFile("test_files/bbb_get_participants_ok.xml")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	response, err := parseBBBGetMeetingsResponseXML(responseBytes)
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	load := computeBBBLoad(response)
+	if load.Meetings != 2 || load.Participants != 2 || load.Moderators != 1 || load.Recordings != 1 || load.Videos != 1 || load.VoiceParticipants != 1 {
+		t.Fatalf("Unexpected load: %+v", load)
+	}
+	if score := load.Score(defaultBBBLoadWeights); score != 2 {
+		t.Fatalf("Expected default score to be 2 but got %f", score)
+	}
+	weights := BBBLoadWeights{Participant: 1, Video: 3, VoiceParticipant: 2, Recording: 5}
+	if score := load.Score(weights); score != 12 {
+		t.Fatalf("Expected weighted score to be 12 but got %f", score)
+	}
+}
+
+func TestValidateBBBLoadWeights(t *testing.T) {
+	s.ValidatePass(t, defaultBBBLoadWeights)
+	s.ValidateFail(t, BBBLoadWeights{})
+	s.ValidateFail(t, BBBLoadWeights{Participant: 1, Video: -1})
+}
+
+func TestValidateBBBLoadThresholds(t *testing.T) {
+	s.ValidatePass(t, BBBLoadThresholds{})
+	s.ValidatePass(t, BBBLoadThresholds{ScaleUp: 10, ScaleDown: 2})
+	s.ValidateFail(t, BBBLoadThresholds{ScaleUp: -1})
+	s.ValidateFail(t, BBBLoadThresholds{ScaleUp: 2, ScaleDown: 10})
+}
+
+// Check that the weights of the load decide whether the rules apply
+func TestBBBApplyRulesLoadWeights(t *testing.T) {
+	busy := s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.9}
+	idle := s.CpuResourceState{CurrentCores: 4, CurrentUsage: 0.1}
+	// 10 listeners, 4 of them with voice and 2 with video
+	load := BBBLoad{Meetings: 1, Participants: 10, Listeners: 10, VoiceParticipants: 4, Videos: 2}
+	thresholds := &BBBLoadThresholds{ScaleUp: 8, ScaleDown: 4}
+
+	tests := []struct {
+		name      string
+		weights   BBBLoadWeights
+		state     s.CpuResourceState
+		scalelite *ScaleliteConfig
+		expected  s.ScaleDirection
+	}{
+		{"listeners below scale-up threshold", BBBLoadWeights{Listener: 0.5}, busy, nil, s.ScaleNone},
+		{"videos above scale-up threshold", BBBLoadWeights{Listener: 0.5, Video: 3}, busy, nil, s.ScaleUp},
+		{"participants above scale-up threshold", defaultBBBLoadWeights, busy, nil, s.ScaleUp},
+		{"low load drained by scalelite", BBBLoadWeights{Listener: 0.2}, idle, &ScaleliteConfig{}, s.ScaleDown},
+		{"low load without scalelite", BBBLoadWeights{Listener: 0.2}, idle, nil, s.ScaleNone},
+		{"voice above scale-down threshold", BBBLoadWeights{Listener: 0.2, VoiceParticipant: 1}, idle, &ScaleliteConfig{}, s.ScaleNone},
+	}
+	for _, test := range tests {
+		config := *validBBBConfig
+		config.LoadThresholds = thresholds
+		config.Scalelite = test.scalelite
+		bbbService := BBBService{Config: config}
+		server := sampleBBBServer
+		state := test.state
+		server.ResourceState.Cpu = &state
+
+		proposal := bbbService.computeScalingProposalInternal(server, load.Participants, load.Score(test.weights))
+		if proposal.Cpu.Direction != test.expected {
+			t.Errorf("%s: expected CPU scale direction %s but got %s (%s)", test.name, test.expected, proposal.Cpu.Direction, proposal.Cpu.Reason)
+		}
+	}
+}
+
 // Example from https://docs.bigbluebutton.org/development/api/#usage
 func TestSignedBBBAPIRequest(t *testing.T) {
-	serverUrl := "bbb.example.com"
+	server := sampleBBBServer
 	endpoint := "create"
 	parameters := "name=Test+Meeting&meetingID=abc123&attendeePW=111222&moderatorPW=333444"
 	apiToken := "639259d4-9dd8-4b25-bf01-95f9567eaf4b"
 	expected := "https://bbb.example.com/bigbluebutton/api/create?name=Test+Meeting&meetingID=abc123&attendeePW=111222&moderatorPW=333444&checksum=1fcbb0c4fc1f039f73aa6d697d2db9ba7f803f17"
-	got := signedBBBAPIRequest(serverUrl, endpoint, parameters, apiToken)
+	client, err := NewBBBClient(BBBApiConfig{}, apiToken)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	got, err := client.SignedUrl(server, endpoint, parameters)
+	if err != nil {
+		t.Fatalf("Failed to sign request: %v", err)
+	}
 	if got != expected {
 		t.Fatalf("Expected %s but got %s", expected, got)
 	}
 }
 
-func testBBBApplyRulesCPU(t *testing.T, bbbParticipants int, resourceState s.CpuResourceState, resources s.CpuResources, expected s.ScaleDirection) s.ResourceScalingProposal {
+func testBBBApplyRulesCPU(t *testing.T, participantsCount int, bbbLoadScore float64, resourceState s.CpuResourceState, resources s.CpuResources, expected s.ScaleDirection) s.ResourceScalingProposal {
 	bbbConfig := validBBBConfig
 	bbbConfig.Resources.Cpu = &resources
 	bbbService := BBBService{
@@ -141,7 +221,7 @@ func testBBBApplyRulesCPU(t *testing.T, bbbParticipants int, resourceState s.Cpu
 	server := sampleBBBServer
 	server.ResourceState.Cpu = &resourceState
 
-	proposal := bbbService.computeScalingProposalInternal(server, bbbParticipants)
+	proposal := bbbService.computeScalingProposalInternal(server, participantsCount, bbbLoadScore)
 	if proposal.Cpu.Direction != expected {
 		t.Fatalf("Expected CPU scale direction to be %s but got %s", expected, proposal.Cpu.Direction)
 	}
@@ -159,7 +239,7 @@ func TestBBBApplyRulesRule1(t *testing.T) {
 		CurrentCores: 1,
 		CurrentUsage: 0,
 	}
-	testBBBApplyRulesCPU(t, 0, resourceState, resources, s.ScaleUp)
+	testBBBApplyRulesCPU(t, 0, 0, resourceState, resources, s.ScaleUp)
 }
 
 // Check that a server with participants, below maximum cores and above maximum usage is scaled up
@@ -173,7 +253,7 @@ func TestBBBApplyRulesRule2ScaleUp(t *testing.T) {
 		CurrentCores: 2,
 		CurrentUsage: 0.6,
 	}
-	testBBBApplyRulesCPU(t, 2, resourceState, resources, s.ScaleUp)
+	testBBBApplyRulesCPU(t, 2, 2, resourceState, resources, s.ScaleUp)
 }
 
 // Check that a server with participants, maximum cores and above maximum usage is not scaled up
@@ -187,7 +267,7 @@ func TestBBBApplyRulesRule2CantScaleUp(t *testing.T) {
 		CurrentCores: 4,
 		CurrentUsage: 0.6,
 	}
-	testBBBApplyRulesCPU(t, 2, resourceState, resources, s.ScaleNone)
+	testBBBApplyRulesCPU(t, 2, 2, resourceState, resources, s.ScaleNone)
 }
 
 // Check the case where a server should be scaled up by more than 1 core
@@ -201,7 +281,7 @@ func TestBBBApplyRulesRule2VerifyHeuristic(t *testing.T) {
 		CurrentCores: 4,
 		CurrentUsage: 1,
 	}
-	proposal := testBBBApplyRulesCPU(t, 2, resourceState, resources, s.ScaleUp)
+	proposal := testBBBApplyRulesCPU(t, 2, 2, resourceState, resources, s.ScaleUp)
 	if proposal.Cpu.Amount != 2 {
 		t.Fatalf("Expected CPU cores to be 2 but got %d", proposal.Cpu.Amount)
 	}
@@ -218,7 +298,7 @@ func TestBBBApplyRulesRule3NoChanges(t *testing.T) {
 		CurrentCores: 2,
 		CurrentUsage: 0,
 	}
-	testBBBApplyRulesCPU(t, 0, resourceState, resources, s.ScaleNone)
+	testBBBApplyRulesCPU(t, 0, 0, resourceState, resources, s.ScaleNone)
 }
 
 // Check that a server with 0 participants and above maximum usage is scaled up
@@ -232,7 +312,7 @@ func TestBBBApplyRulesRule3HighUsage(t *testing.T) {
 		CurrentCores: 2,
 		CurrentUsage: 0.9,
 	}
-	testBBBApplyRulesCPU(t, 0, resourceState, resources, s.ScaleNone)
+	testBBBApplyRulesCPU(t, 0, 0, resourceState, resources, s.ScaleNone)
 }
 
 // Check that a server with 0 participants and above minimum resources is scaled down
@@ -246,7 +326,7 @@ func TestBBBApplyRulesRule3ScaleDown(t *testing.T) {
 		CurrentCores: 3,
 		CurrentUsage: 0,
 	}
-	testBBBApplyRulesCPU(t, 0, resourceState, resources, s.ScaleDown)
+	testBBBApplyRulesCPU(t, 0, 0, resourceState, resources, s.ScaleDown)
 }
 
 // Check that a server with 0 participants, above minimum resources and above maximum usage is scaled down
@@ -260,7 +340,7 @@ func TestBBBApplyRulesRule3HighUsageScaleDown(t *testing.T) {
 		CurrentCores: 3,
 		CurrentUsage: 0.9,
 	}
-	testBBBApplyRulesCPU(t, 0, resourceState, resources, s.ScaleDown)
+	testBBBApplyRulesCPU(t, 0, 0, resourceState, resources, s.ScaleDown)
 }
 
 // Check that a server with participants and below maximum usage is not modified
@@ -274,7 +354,7 @@ func TestBBBApplyRulesRuleDefault(t *testing.T) {
 		CurrentCores: 3,
 		CurrentUsage: 0.4,
 	}
-	testBBBApplyRulesCPU(t, 2, resourceState, resources, s.ScaleNone)
+	testBBBApplyRulesCPU(t, 2, 2, resourceState, resources, s.ScaleNone)
 }
 
 // Check that a server with participants, below maximum usage and above maximum cores is not modified
@@ -288,5 +368,19 @@ func TestBBBApplyRulesRuleDefaultAboveMaximum(t *testing.T) {
 		CurrentCores: 5,
 		CurrentUsage: 0.4,
 	}
-	testBBBApplyRulesCPU(t, 2, resourceState, resources, s.ScaleNone)
+	testBBBApplyRulesCPU(t, 2, 2, resourceState, resources, s.ScaleNone)
+}
+
+// Check that a server whose participants all have weight 0 is neither scaled up nor scaled down
+func TestBBBApplyRulesRule3ZeroWeightParticipants(t *testing.T) {
+	resources := s.CpuResources{
+		MinCores: 2,
+		MaxCores: 4,
+		MaxUsage: 0.5,
+	}
+	resourceState := s.CpuResourceState{
+		CurrentCores: 3,
+		CurrentUsage: 0.9,
+	}
+	testBBBApplyRulesCPU(t, 5, 0, resourceState, resources, s.ScaleNone)
 }
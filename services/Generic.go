@@ -0,0 +1,177 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	s "scaler/shared"
+)
+
+// Service for workloads without a dedicated implementation, the application state is read from an HTTP probe
+type GenericService struct {
+	Config GenericServiceConfig `yaml:"generic_config"`
+	probe  *genericProbe
+}
+
+type GenericServiceConfig struct {
+	CycleTimeSeconds int                `yaml:"cycle_time_seconds"`
+	Resources        s.Resources        `yaml:"resources"`
+	Probe            GenericProbeConfig `yaml:"probe"`
+}
+
+func (generic *GenericService) Init() error {
+	if err := initMetricsExporter("generic"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	probe, err := newGenericProbe(generic.Config.Probe)
+	if err != nil {
+		return err
+	}
+	generic.probe = probe
+	return nil
+}
+
+func (generic *GenericService) GetConfig() GenericServiceConfig {
+	return generic.Config
+}
+
+func (generic GenericService) GetResources() s.Resources {
+	return generic.Config.Resources
+}
+
+func (generic GenericService) GetCycleTimeSeconds() int {
+	return generic.Config.CycleTimeSeconds
+}
+
+func (generic GenericService) ComputeScalingProposal(object s.ScaledObject) (s.ResourceScalingProposal, error) {
+	if !object.IsReady() {
+		return s.ResourceScalingProposal{}, fmt.Errorf("%s %s is not ready", object.GetType(), object.GetName())
+	}
+	result, err := generic.probe.Probe(object)
+	if err != nil {
+		errorsTotalCounter.Inc()
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while probing %s: %w", object.GetName(), err)
+	}
+	loadScoreGauge.WithLabelValues(object.GetName()).Set(result.Load)
+	return generic.computeScalingProposalInternal(object.GetResourceState(), result), nil
+}
+
+func (generic GenericService) computeScalingProposalInternal(resourceState s.ResourceState, result GenericProbeResult) s.ResourceScalingProposal {
+	targetResource := &s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+		Mem: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+	}
+	// Scaling rules:
+	// 1. Scale up if current resource is below configured minimum
+	// 2. Scale up if current resource usage exceeds maximum usage
+	// Add enough resources to either reach usage below the maximum usage or the maximum amount of resources
+	// 3. Scale down if current resource is above configured maximum
+	// 4. Scale down if current resource usage is below minimum usage
+	// Remove enough resources to either reach usage above the minimum usage or the minimum amount of resources
+	// Rules 3 and 4 only apply if the probe reports the object as not busy
+	// CPU usage is the highest of the CPU usage and the load reported by the probe
+	busy := result.Busy > 0
+
+	if cpu := generic.Config.Resources.Cpu; cpu != nil {
+		currentCores := resourceState.Cpu.CurrentCores
+		currentCpuUsage := float32(math.Max(float64(resourceState.Cpu.CurrentUsage), result.Load))
+
+		// Rule 1 CPU
+		if currentCores < int32(cpu.MinCores) {
+			targetResource.Cpu.Direction = s.ScaleUp
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 1: resource below minimum"
+			targetResource.Cpu.Amount = int32(cpu.MinCores) - currentCores
+		}
+
+		// Rule 2 CPU
+		if cpuMaxUsageDelta := currentCpuUsage - cpu.MaxUsage; cpuMaxUsageDelta > 0 && currentCores < int32(cpu.MaxCores) {
+			targetResource.Cpu.Direction = s.ScaleUp
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 2: usage above maximum"
+			cpuInc := cpuMaxUsageDelta * float32(currentCores) / currentCpuUsage
+			targetHeuristic := currentCores + int32(math.Ceil(float64(cpuInc)))
+			targetResource.Cpu.Amount = int32(math.Min(float64(targetHeuristic), float64(cpu.MaxCores))) - currentCores
+		}
+
+		// Rule 3 CPU
+		if currentCores > int32(cpu.MaxCores) && !busy {
+			targetResource.Cpu.Direction = s.ScaleDown
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 3: resource above maximum"
+			targetResource.Cpu.Amount = int32(cpu.MaxCores) - currentCores
+		}
+
+		// Rule 4 CPU
+		if cpuMinUsageDelta := cpu.MinUsage - currentCpuUsage; cpuMinUsageDelta > 0 && currentCores > int32(cpu.MinCores) && !busy {
+			targetResource.Cpu.Direction = s.ScaleDown
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 4: usage below minimum"
+			cpuDec := cpuMinUsageDelta * float32(currentCores) / cpu.MinUsage
+			targetHeuristic := currentCores - int32(math.Ceil(float64(cpuDec)))
+			targetResource.Cpu.Amount = int32(math.Max(float64(targetHeuristic), float64(cpu.MinCores))) - currentCores
+		}
+	}
+
+	if memory := generic.Config.Resources.Memory; memory != nil {
+		currentMemory := resourceState.Memory.CurrentBytes
+		currentMemoryUsage := resourceState.Memory.CurrentUsage
+
+		// Rule 1 memory
+		if currentMemory < int32(memory.MinBytes) {
+			targetResource.Mem.Direction = s.ScaleUp
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 1: resource below minimum"
+			targetResource.Mem.Amount = int32(memory.MinBytes) - currentMemory
+		}
+
+		// Rule 2 memory
+		if memMaxUsageDelta := currentMemoryUsage - memory.MaxUsage; memMaxUsageDelta > 0 && currentMemory < int32(memory.MaxBytes) {
+			targetResource.Mem.Direction = s.ScaleUp
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 2: usage above maximum"
+			memInc := memMaxUsageDelta * float32(currentMemory) / currentMemoryUsage
+			targetHeuristic := currentMemory + int32(math.Ceil(float64(memInc)))
+			targetResource.Mem.Amount = int32(math.Min(float64(targetHeuristic), float64(memory.MaxBytes))) - currentMemory
+		}
+
+		// Rule 3 memory
+		if currentMemory > int32(memory.MaxBytes) && !busy {
+			targetResource.Mem.Direction = s.ScaleDown
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 3: resource above maximum"
+			targetResource.Mem.Amount = int32(memory.MaxBytes) - currentMemory
+		}
+
+		// Rule 4 memory
+		if memMinUsageDelta := memory.MinUsage - currentMemoryUsage; memMinUsageDelta > 0 && currentMemory > int32(memory.MinBytes) && !busy {
+			targetResource.Mem.Direction = s.ScaleDown
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 4: usage below minimum"
+			memDec := memMinUsageDelta * float32(currentMemory) / memory.MinUsage
+			targetHeuristic := currentMemory - int32(math.Ceil(float64(memDec)))
+			targetResource.Mem.Amount = int32(math.Max(float64(targetHeuristic), float64(memory.MinBytes))) - currentMemory
+		}
+	}
+
+	return *targetResource
+}
+
+func (service GenericService) Validate() error {
+	if err := service.Config.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (config GenericServiceConfig) Validate() error {
+	if config.CycleTimeSeconds <= 0 {
+		return fmt.Errorf("cycle time seconds must be greater than 0")
+	}
+	if err := config.Resources.Validate(); err != nil {
+		return err
+	}
+	if err := config.Probe.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	s "scaler/shared"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// HTTP endpoint queried for each scaled object, the values are extracted from the response body
+type GenericProbeConfig struct {
+	// Go template of the URL, with access to .Name, .Id and .Type of the scaled object
+	UrlTemplate    string                     `yaml:"url_template"`
+	TimeoutSeconds int                        `yaml:"timeout_seconds"`
+	Headers        map[string]s.StringFromEnv `yaml:"headers"`
+	Busy           *GenericExtractorConfig    `yaml:"busy"`
+	Load           *GenericExtractorConfig    `yaml:"load"`
+}
+
+// Exactly one of JSONPath or regex must be set
+// A regex returns its first capture group, or the whole match if it has none
+type GenericExtractorConfig struct {
+	JsonPath string `yaml:"json_path"`
+	Regex    string `yaml:"regex"`
+}
+
+const defaultGenericTimeoutSeconds = 10
+
+type GenericProbeResult struct {
+	// Number of active sessions, jobs or connections, a busy object is not scaled down
+	Busy float64
+	// Usage in [0, 1] reported by the application
+	Load float64
+}
+
+// Values available to the URL template
+type genericUrlTemplateData struct {
+	Name string
+	Id   string
+	Type s.ScaledObjectType
+}
+
+type genericProbe struct {
+	config      GenericProbeConfig
+	httpClient  *http.Client
+	urlTemplate *template.Template
+	busy        *genericExtractor
+	load        *genericExtractor
+}
+
+type genericExtractor struct {
+	jsonPath []jsonPathStep
+	regex    *regexp.Regexp
+}
+
+// A JSONPath step is either an object key or an array index
+type jsonPathStep struct {
+	key   string
+	index int
+}
+
+func newGenericProbe(config GenericProbeConfig) (*genericProbe, error) {
+	urlTemplate, err := config.parseUrlTemplate()
+	if err != nil {
+		return nil, err
+	}
+	probe := &genericProbe{config: config, urlTemplate: urlTemplate}
+	if probe.busy, err = config.Busy.compile(); err != nil {
+		return nil, fmt.Errorf("generic.probe.busy is invalid: %s", err)
+	}
+	if probe.load, err = config.Load.compile(); err != nil {
+		return nil, fmt.Errorf("generic.probe.load is invalid: %s", err)
+	}
+	timeout := config.TimeoutSeconds
+	if timeout == 0 {
+		timeout = defaultGenericTimeoutSeconds
+	}
+	probe.httpClient = &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	return probe, nil
+}
+
+func (config GenericProbeConfig) parseUrlTemplate() (*template.Template, error) {
+	parsed, err := template.New("generic_url").Option("missingkey=error").Parse(config.UrlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("generic.probe.url_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (config *GenericExtractorConfig) compile() (*genericExtractor, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if (config.JsonPath == "") == (config.Regex == "") {
+		return nil, fmt.Errorf("json_path and regex are both set or both empty, exactly one must be set")
+	}
+	if config.JsonPath != "" {
+		steps, err := parseJsonPath(config.JsonPath)
+		if err != nil {
+			return nil, err
+		}
+		return &genericExtractor{jsonPath: steps}, nil
+	}
+	regex, err := regexp.Compile(config.Regex)
+	if err != nil {
+		return nil, err
+	}
+	return &genericExtractor{regex: regex}, nil
+}
+
+// Parses the subset of JSONPath made of keys and array indexes, e.g. $.stats.sessions[0]['active jobs']
+func parseJsonPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path %s must start with $", path)
+	}
+	steps := []jsonPathStep{}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("json path %s has an unterminated key", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[2:end]})
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("json path %s has an unterminated index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("json path %s has an invalid index %s", path, rest[1:end])
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("json path %s has an empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: key})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("json path %s is invalid at %s", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+func (step jsonPathStep) String() string {
+	if step.key != "" {
+		return step.key
+	}
+	return fmt.Sprintf("[%d]", step.index)
+}
+
+func (probe *genericProbe) url(object s.ScaledObject) (string, error) {
+	data := genericUrlTemplateData{Name: object.GetName(), Type: object.GetType()}
+	switch objectType := object.(type) {
+	case *s.Server:
+		data.Id = objectType.ServerId
+	case *s.Cluster:
+		data.Id = objectType.ClusterId
+	}
+	var buffer bytes.Buffer
+	if err := probe.urlTemplate.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("error while rendering url template for %s: %s", object.GetName(), err)
+	}
+	return buffer.String(), nil
+}
+
+func (probe *genericProbe) Probe(object s.ScaledObject) (GenericProbeResult, error) {
+	url, err := probe.url(object)
+	if err != nil {
+		return GenericProbeResult{}, err
+	}
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return GenericProbeResult{}, err
+	}
+	for name, value := range probe.config.Headers {
+		request.Header.Set(name, string(value))
+	}
+	resp, err := probe.httpClient.Do(request)
+	if err != nil {
+		return GenericProbeResult{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GenericProbeResult{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return GenericProbeResult{}, fmt.Errorf("probe returned %d", resp.StatusCode)
+	}
+
+	result := GenericProbeResult{}
+	if probe.busy != nil {
+		if result.Busy, err = probe.busy.extract(body); err != nil {
+			return result, fmt.Errorf("error while extracting busy value: %s", err)
+		}
+	}
+	if probe.load != nil {
+		if result.Load, err = probe.load.extract(body); err != nil {
+			return result, fmt.Errorf("error while extracting load value: %s", err)
+		}
+		// An out of range load is more likely a wrong extractor or a broken application than a real usage
+		if math.IsNaN(result.Load) || result.Load < 0 || result.Load > 1 {
+			return result, &s.InvalidReadingError{Reason: fmt.Sprintf("load %f is outside [0, 1]", result.Load)}
+		}
+	}
+	return result, nil
+}
+
+func (extractor *genericExtractor) extract(body []byte) (float64, error) {
+	if extractor.regex != nil {
+		match := extractor.regex.FindSubmatch(body)
+		if match == nil {
+			return 0, fmt.Errorf("regex %s does not match", extractor.regex)
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		return strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return 0, err
+	}
+	for _, step := range extractor.jsonPath {
+		switch node := document.(type) {
+		case map[string]interface{}:
+			value, ok := node[step.key]
+			if !ok {
+				return 0, fmt.Errorf("%s not found", step)
+			}
+			document = value
+		case []interface{}:
+			if step.key != "" || step.index >= len(node) {
+				return 0, fmt.Errorf("%s not found", step)
+			}
+			document = node[step.index]
+		default:
+			return 0, fmt.Errorf("cannot select %s in value %v", step, node)
+		}
+	}
+	return jsonNumber(document)
+}
+
+// Converts the selected JSON value to a number, an array counts its elements
+func jsonNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case []interface{}:
+		return float64(len(v)), nil
+	default:
+		return 0, fmt.Errorf("value %v is not a number", value)
+	}
+}
+
+func (config GenericProbeConfig) Validate() error {
+	if config.UrlTemplate == "" {
+		return fmt.Errorf("generic.probe.url_template is empty")
+	}
+	if config.TimeoutSeconds < 0 {
+		return fmt.Errorf("generic.probe.timeout_seconds must be greater than or equal to 0 but got %d", config.TimeoutSeconds)
+	}
+	if config.Busy == nil && config.Load == nil {
+		return fmt.Errorf("generic.probe.busy and generic.probe.load are both empty, at least one must be set")
+	}
+	if _, err := newGenericProbe(config); err != nil {
+		return err
+	}
+	return nil
+}
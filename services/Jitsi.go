@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	s "scaler/shared"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type JitsiService struct {
+	Config      JitsiServiceConfig `yaml:"jitsi_config"`
+	httpClient  *http.Client
+	urlTemplate *template.Template
+	gate        *resizeGate
+	// Resizes held back until the bridge is shut down, keyed by the server ID
+	shutdowns map[string]s.ResourceScalingProposal
+}
+
+type JitsiServiceConfig struct {
+	CycleTimeSeconds int         `yaml:"cycle_time_seconds"`
+	Resources        s.Resources `yaml:"resources"`
+	// Go template of the colibri REST API base URL, with access to the Server fields
+	UrlTemplate string `yaml:"url_template"`
+	// Shut the bridge down gracefully once it is drained, the resize is sent to the provider once it exited
+	GracefulShutdown bool `yaml:"graceful_shutdown"`
+	// Also drain the bridge before a scale-up, by default scale-ups go through right away
+	DrainScaleUp bool `yaml:"drain_scale_up"`
+}
+
+const defaultJitsiUrlTemplate = "http://{{ .ServerName }}:8080/colibri/"
+
+// JitsiStatsJSON is the response of the videobridge colibri/stats endpoint
+// We only keep the fields we need from the response
+type JitsiStatsJSON struct {
+	Conferences  int     `json:"conferences"`
+	Participants int     `json:"participants"`
+	StressLevel  float32 `json:"stress_level"`
+	Drain        bool    `json:"drain"`
+}
+
+func (jitsi *JitsiService) Init() error {
+	if err := initMetricsExporter("jitsi"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	urlTemplate, err := jitsi.Config.parseUrlTemplate()
+	if err != nil {
+		return err
+	}
+	jitsi.urlTemplate = urlTemplate
+	jitsi.httpClient = &http.Client{Timeout: 10 * time.Second}
+	jitsi.shutdowns = make(map[string]s.ResourceScalingProposal)
+	jitsi.gate = newResizeGate(jitsi, jitsi.Config.DrainScaleUp)
+	return nil
+}
+
+func (jitsi *JitsiService) GetConfig() JitsiServiceConfig {
+	return jitsi.Config
+}
+
+func (jitsi JitsiService) GetResources() s.Resources {
+	return jitsi.Config.Resources
+}
+
+func (jitsi JitsiService) GetCycleTimeSeconds() int {
+	return jitsi.Config.CycleTimeSeconds
+}
+
+func (config JitsiServiceConfig) parseUrlTemplate() (*template.Template, error) {
+	urlTemplate := config.UrlTemplate
+	if urlTemplate == "" {
+		urlTemplate = defaultJitsiUrlTemplate
+	}
+	parsed, err := template.New("jitsi_url").Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("jitsi.url_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (jitsi JitsiService) colibriUrl(server s.Server, endpoint string) (string, error) {
+	var buffer bytes.Buffer
+	if err := jitsi.urlTemplate.Execute(&buffer, server); err != nil {
+		return "", fmt.Errorf("error while rendering url template for %s: %s", server.ServerName, err)
+	}
+	return strings.TrimSuffix(buffer.String(), "/") + "/" + endpoint, nil
+}
+
+func (jitsi JitsiService) GetStats(server s.Server) (*JitsiStatsJSON, error) {
+	url, err := jitsi.colibriUrl(server, "stats")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jitsi.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("colibri stats returned %d: %s", resp.StatusCode, body)
+	}
+	var stats JitsiStatsJSON
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (jitsi JitsiService) post(server s.Server, endpoint string, body string) error {
+	url, err := jitsi.colibriUrl(server, endpoint)
+	if err != nil {
+		return err
+	}
+	resp, err := jitsi.httpClient.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("colibri %s returned %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// A draining bridge does not get new conferences from Jicofo
+func (jitsi JitsiService) drain(server s.Server) error {
+	if err := jitsi.post(server, "drain/enable", ""); err != nil {
+		return fmt.Errorf("error while enabling drain mode: %s", err)
+	}
+	slog.Info(fmt.Sprintf("Enabled drain mode on bridge %s\n", server.ServerName))
+	return nil
+}
+
+func (jitsi JitsiService) undrain(server s.Server) error {
+	if err := jitsi.post(server, "drain/disable", ""); err != nil {
+		return fmt.Errorf("error while disabling drain mode: %s", err)
+	}
+	slog.Info(fmt.Sprintf("Disabled drain mode on bridge %s\n", server.ServerName))
+	return nil
+}
+
+func (jitsi JitsiService) drained(server s.Server) (bool, error) {
+	stats, err := jitsi.GetStats(server)
+	if err != nil {
+		return false, fmt.Errorf("error while getting bridge stats: %s", err)
+	}
+	return stats.Drain, nil
+}
+
+func (jitsi JitsiService) ComputeScalingProposal(object s.ScaledObject) (s.ResourceScalingProposal, error) {
+	var server *s.Server
+	switch objectType := object.(type) {
+	case *s.Server:
+		server = objectType
+	default:
+		return s.ResourceScalingProposal{}, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+	}
+
+	if err := jitsi.gate.finishResize(*server); err != nil {
+		errorsTotalCounter.Inc()
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while undraining bridge: %s", err)
+	}
+
+	if !server.Ready {
+		return s.ResourceScalingProposal{}, fmt.Errorf("server %s is not ready", server.ServerName)
+	}
+
+	stats, err := jitsi.GetStats(*server)
+	if err != nil {
+		// The bridge exits after its graceful shutdown, the resize held back for it goes through
+		if proposal, ok := jitsi.shutdowns[server.ServerId]; ok {
+			return jitsi.gate.gateResize(*server, 0, proposal)
+		}
+		errorsTotalCounter.Inc()
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while getting bridge stats: %s", err)
+	}
+	loadScoreGauge.WithLabelValues(server.ServerName).Set(float64(stats.StressLevel))
+	participantsGauge.WithLabelValues(server.ServerName).Set(float64(stats.Participants))
+
+	proposal := jitsi.computeScalingProposalInternal(*server, *stats)
+
+	// Resizing reboots the server, so the bridge is drained first
+	proposal, err = jitsi.gate.gateResize(*server, stats.Conferences, proposal)
+	if err != nil {
+		errorsTotalCounter.Inc()
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while draining bridge: %s", err)
+	}
+	return proposal, nil
+}
+
+// Shuts the drained bridge down gracefully and holds the resize back until the bridge exited or has no conferences left
+func (jitsi JitsiService) prepareResize(server s.Server, proposal s.ResourceScalingProposal) (bool, error) {
+	if !jitsi.Config.GracefulShutdown {
+		return true, nil
+	}
+	if _, ok := jitsi.shutdowns[server.ServerId]; ok {
+		return true, nil
+	}
+	if err := jitsi.post(server, "shutdown", `{"graceful-shutdown": "true"}`); err != nil {
+		return false, fmt.Errorf("error while shutting down bridge: %s", err)
+	}
+	slog.Info(fmt.Sprintf("Shut down bridge %s for resize\n", server.ServerName))
+	jitsi.shutdowns[server.ServerId] = proposal
+	return false, nil
+}
+
+// Forgets the shutdown once the resize was sent to the provider
+func (jitsi JitsiService) ScaledObjectUpdated(object s.ScaledObject, proposal s.ResourceScalingProposal) error {
+	if server, ok := object.(*s.Server); ok {
+		delete(jitsi.shutdowns, server.ServerId)
+	}
+	return nil
+}
+
+// Applies the Jitsi scaling rules to decide how to scale
+func (jitsi JitsiService) computeScalingProposalInternal(server s.Server, stats JitsiStatsJSON) s.ResourceScalingProposal {
+	targetResource := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+		Mem: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+	}
+
+	// Scaling rules:
+	// 1. Scale up if current resource is below configured minimum
+	// 2. Scale up if current resource usage exceeds maximum usage and there are conferences
+	// The CPU usage is the highest of the server CPU usage and the bridge stress level
+	// Add enough resources to either reach usage below the maximum usage or the maximum amount of resources
+	// 3. Scale down to the configured minimum if there are no conferences
+
+	cpu := jitsi.Config.Resources.Cpu
+	memory := jitsi.Config.Resources.Memory
+	currentCores := server.ResourceState.Cpu.CurrentCores
+	currentCpuUsage := float32(math.Max(float64(server.ResourceState.Cpu.CurrentUsage), float64(stats.StressLevel)))
+	currentMemory := server.ResourceState.Memory.CurrentBytes
+	currentMemoryUsage := server.ResourceState.Memory.CurrentUsage
+
+	// Rule 1 CPU
+	if currentCores < int32(cpu.MinCores) {
+		targetResource.Cpu.Direction = s.ScaleUp
+		targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 1: resource below minimum"
+		targetResource.Cpu.Amount = int32(cpu.MinCores) - currentCores
+	}
+
+	// Rule 2 CPU
+	if cpuMaxUsageDelta := currentCpuUsage - cpu.MaxUsage; cpuMaxUsageDelta > 0 && currentCores < int32(cpu.MaxCores) && stats.Conferences > 0 {
+		targetResource.Cpu.Direction = s.ScaleUp
+		targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 2: usage above maximum"
+		cpuInc := cpuMaxUsageDelta * float32(currentCores) / currentCpuUsage
+		targetHeuristic := currentCores + int32(math.Ceil(float64(cpuInc)))
+		targetResource.Cpu.Amount = int32(math.Min(float64(targetHeuristic), float64(cpu.MaxCores))) - currentCores
+	}
+
+	// Rule 1 memory
+	if currentMemory < int32(memory.MinBytes) {
+		targetResource.Mem.Direction = s.ScaleUp
+		targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 1: resource below minimum"
+		targetResource.Mem.Amount = int32(memory.MinBytes) - currentMemory
+	}
+
+	// Rule 2 memory
+	if memMaxUsageDelta := currentMemoryUsage - memory.MaxUsage; memMaxUsageDelta > 0 && currentMemory < int32(memory.MaxBytes) && stats.Conferences > 0 {
+		targetResource.Mem.Direction = s.ScaleUp
+		targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 2: usage above maximum"
+		memInc := memMaxUsageDelta * float32(currentMemory) / currentMemoryUsage
+		targetHeuristic := currentMemory + int32(math.Ceil(float64(memInc)))
+		targetResource.Mem.Amount = int32(math.Min(float64(targetHeuristic), float64(memory.MaxBytes))) - currentMemory
+	}
+
+	// Rule 3 CPU and memory
+	if stats.Conferences == 0 {
+		if currentMemory > int32(memory.MinBytes) {
+			targetResource.Mem.Direction = s.ScaleDown
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 3: no conferences"
+			targetResource.Mem.Amount = int32(memory.MinBytes) - currentMemory
+		}
+		if currentCores > int32(cpu.MinCores) {
+			targetResource.Cpu.Direction = s.ScaleDown
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 3: no conferences"
+			targetResource.Cpu.Amount = int32(cpu.MinCores) - currentCores
+		}
+	}
+
+	return targetResource
+}
+
+func (service JitsiService) Validate() error {
+	if err := service.Config.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (config JitsiServiceConfig) Validate() error {
+	if config.CycleTimeSeconds <= 0 {
+		return fmt.Errorf("cycle time seconds must be greater than 0")
+	}
+	if err := config.Resources.Validate(); err != nil {
+		return err
+	}
+	// Both resources are needed as the rules apply to CPU and memory
+	if config.Resources.Cpu == nil || config.Resources.Memory == nil {
+		return fmt.Errorf("jitsi.resources.cpu and jitsi.resources.memory must be set")
+	}
+	if _, err := config.parseUrlTemplate(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,19 +4,30 @@ import (
 	"fmt"
 	"math"
 	s "scaler/shared"
+	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 type PostgresService struct {
-	Config PostgresServiceConfig `yaml:"postgres_config"`
+	Config    PostgresServiceConfig `yaml:"postgres_config"`
+	databases *postgresDatabases
 }
 
 type PostgresServiceConfig struct {
-	CycleTimeSeconds int         `yaml:"cycle_time_seconds"`
-	Resources        s.Resources `yaml:"resources"`
+	CycleTimeSeconds int                     `yaml:"cycle_time_seconds"`
+	Resources        s.Resources             `yaml:"resources"`
+	Database         *PostgresDatabaseConfig `yaml:"database"`
 }
 
-func (postgres PostgresService) Init() error {
-	return initMetricsExporter("postgres")
+func (postgres *PostgresService) Init() error {
+	if err := initMetricsExporter("postgres"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	if postgres.Config.Database != nil {
+		postgres.databases = newPostgresDatabases(*postgres.Config.Database)
+	}
+	return nil
 }
 
 func (postgres *PostgresService) GetConfig() PostgresServiceConfig {
@@ -42,7 +53,23 @@ func (postgres PostgresService) ComputeScalingProposal(object s.ScaledObject) (s
 	if !cluster.Ready {
 		return s.ResourceScalingProposal{}, fmt.Errorf("cluster %s (%s) is not ready", cluster.ClusterName, cluster.ClusterId)
 	}
-	return postgres.computeScalingProposalInternal(*cluster), nil
+	proposal := postgres.computeScalingProposalInternal(*cluster)
+
+	if postgres.databases != nil {
+		// Pools of clusters missing from the last cycles are closed
+		postgres.databases.closeUnused(time.Now(), 3*time.Duration(postgres.Config.CycleTimeSeconds)*time.Second)
+
+		// The database rules are best effort, without signals the cluster is still scaled on its usage
+		signals, err := postgres.databases.GetSignals(*cluster)
+		if err != nil {
+			errorsTotalCounter.Inc()
+			slog.Warn(fmt.Sprintf("Error while getting database signals for cluster %s, skipping database rules: %s", cluster.ClusterName, err))
+			return proposal, nil
+		}
+		slog.Info(fmt.Sprintf("Database signals for cluster %s: %+v\n", cluster.ClusterName, signals))
+		proposal = postgres.applyDatabaseRules(*cluster, proposal, signals)
+	}
+	return proposal, nil
 }
 
 func (postgres PostgresService) computeScalingProposalInternal(cluster s.Cluster) s.ResourceScalingProposal {
@@ -161,5 +188,10 @@ func (config PostgresServiceConfig) Validate() error {
 	if err := config.Resources.Validate(); err != nil {
 		return err
 	}
+	if config.Database != nil {
+		if err := config.Database.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	s "scaler/shared"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Connection to the cluster to read signals from the database statistics
+// A threshold of 0 disables the corresponding rule
+type PostgresDatabaseConfig struct {
+	// Defaults to the DNS name of the cluster
+	Host                     string          `yaml:"host"`
+	Port                     int             `yaml:"port"`
+	User                     s.StringFromEnv `yaml:"user"`
+	Password                 s.StringFromEnv `yaml:"password"`
+	Database                 string          `yaml:"database"`
+	SslMode                  string          `yaml:"sslmode"`
+	MaxConnectionsUsage      float32         `yaml:"max_connections_usage"`
+	MinCacheHitRatio         float32         `yaml:"min_cache_hit_ratio"`
+	MaxReplicationLagSeconds float32         `yaml:"max_replication_lag_seconds"`
+}
+
+type PostgresSignals struct {
+	// Client connections relative to max_connections
+	ConnectionsUsage float32
+	// Share of blocks read from the buffer cache since the previous cycle
+	CacheHitRatio float32
+	// Highest replay lag of the replicas
+	ReplicationLagSeconds float32
+}
+
+// Block counters of pg_stat_database, kept between cycles to compute the cache hit ratio
+type postgresBlockStats struct {
+	hits  float64
+	reads float64
+}
+
+type postgresDatabases struct {
+	config     PostgresDatabaseConfig
+	databases  map[string]*sql.DB
+	blockStats map[string]postgresBlockStats
+	// Last time the signals of each cluster were read, to close the pools of deleted clusters
+	lastUsed map[string]time.Time
+}
+
+const postgresQueryTimeout = 5 * time.Second
+
+func newPostgresDatabases(config PostgresDatabaseConfig) *postgresDatabases {
+	return &postgresDatabases{
+		config:     config,
+		databases:  make(map[string]*sql.DB),
+		blockStats: make(map[string]postgresBlockStats),
+		lastUsed:   make(map[string]time.Time),
+	}
+}
+
+func (config PostgresDatabaseConfig) dataSourceName(cluster s.Cluster) string {
+	host := config.Host
+	if host == "" {
+		host = cluster.DnsName
+	}
+	port := config.Port
+	if port == 0 {
+		port = 5432
+	}
+	database := config.Database
+	if database == "" {
+		database = "postgres"
+	}
+	sslMode := config.SslMode
+	if sslMode == "" {
+		sslMode = "require"
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(string(config.User), string(config.Password)),
+		Host:     fmt.Sprintf("%s:%d", host, port),
+		Path:     database,
+		RawQuery: url.Values{"sslmode": {sslMode}, "connect_timeout": {"5"}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// Returns a connection pool to the cluster, it is kept open between cycles
+func (pg *postgresDatabases) get(cluster s.Cluster) (*sql.DB, error) {
+	pg.lastUsed[cluster.ClusterId] = time.Now()
+	if db, ok := pg.databases[cluster.ClusterId]; ok {
+		return db, nil
+	}
+	db, err := sql.Open("postgres", pg.config.dataSourceName(cluster))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	pg.databases[cluster.ClusterId] = db
+	return db, nil
+}
+
+// Closes the connection pools of the clusters that were not scaled for longer than maxAge, e.g. once they are deleted
+func (pg *postgresDatabases) closeUnused(now time.Time, maxAge time.Duration) {
+	for clusterId, lastUsed := range pg.lastUsed {
+		if now.Sub(lastUsed) <= maxAge {
+			continue
+		}
+		if db, ok := pg.databases[clusterId]; ok {
+			db.Close()
+			delete(pg.databases, clusterId)
+		}
+		delete(pg.blockStats, clusterId)
+		delete(pg.lastUsed, clusterId)
+	}
+}
+
+func (pg *postgresDatabases) GetSignals(cluster s.Cluster) (PostgresSignals, error) {
+	db, err := pg.get(cluster)
+	if err != nil {
+		return PostgresSignals{}, fmt.Errorf("error while connecting to cluster %s: %s", cluster.ClusterName, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+
+	signals := PostgresSignals{}
+	var connections, maxConnections string
+	err = db.QueryRowContext(ctx, `SELECT count(*), current_setting('max_connections') FROM pg_stat_activity WHERE backend_type = 'client backend'`).Scan(&connections, &maxConnections)
+	if err != nil {
+		return signals, fmt.Errorf("error while reading pg_stat_activity: %s", err)
+	}
+	if signals.ConnectionsUsage, err = ratio(connections, maxConnections); err != nil {
+		return signals, fmt.Errorf("error while computing connections usage: %s", err)
+	}
+
+	var stats postgresBlockStats
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(sum(blks_hit), 0), COALESCE(sum(blks_read), 0) FROM pg_stat_database`).Scan(&stats.hits, &stats.reads)
+	if err != nil {
+		return signals, fmt.Errorf("error while reading pg_stat_database: %s", err)
+	}
+	signals.CacheHitRatio = cacheHitRatio(pg.blockStats[cluster.ClusterId], stats)
+	pg.blockStats[cluster.ClusterId] = stats
+
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(max(EXTRACT(EPOCH FROM replay_lag)), 0) FROM pg_stat_replication`).Scan(&signals.ReplicationLagSeconds)
+	if err != nil {
+		return signals, fmt.Errorf("error while reading pg_stat_replication: %s", err)
+	}
+	return signals, nil
+}
+
+func ratio(numerator, denominator string) (float32, error) {
+	n, err := strconv.ParseFloat(numerator, 32)
+	if err != nil {
+		return 0, err
+	}
+	d, err := strconv.ParseFloat(denominator, 32)
+	if err != nil {
+		return 0, err
+	}
+	if d == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return float32(n / d), nil
+}
+
+// Computes the cache hit ratio since the previous reading
+// Without any block access in between, the cache is considered fully hit
+func cacheHitRatio(previous, current postgresBlockStats) float32 {
+	hits := current.hits - previous.hits
+	reads := current.reads - previous.reads
+	// Statistics were reset in between
+	if hits < 0 || reads < 0 {
+		hits, reads = current.hits, current.reads
+	}
+	if hits+reads == 0 {
+		return 1
+	}
+	return float32(hits / (hits + reads))
+}
+
+// Applies the database rules on top of the resource usage rules
+// 5. Scale up memory if the connections usage exceeds the maximum, as max_connections grows with memory
+// 6. Scale up memory if the cache hit ratio is below the minimum
+// 7. Scale up CPU if the replication lag exceeds the maximum
+func (postgres PostgresService) applyDatabaseRules(cluster s.Cluster, proposal s.ResourceScalingProposal, signals PostgresSignals) s.ResourceScalingProposal {
+	config := postgres.Config.Database
+	resources := postgres.Config.Resources
+	currentMemory := cluster.ResourceState.Memory.CurrentBytes
+	currentCores := cluster.ResourceState.Cpu.CurrentCores
+
+	// Rule 5 memory
+	if config.MaxConnectionsUsage > 0 && resources.Memory != nil && signals.ConnectionsUsage > config.MaxConnectionsUsage && currentMemory < int32(resources.Memory.MaxBytes) {
+		memInc := (signals.ConnectionsUsage - config.MaxConnectionsUsage) * float32(currentMemory) / signals.ConnectionsUsage
+		targetHeuristic := currentMemory + int32(math.Ceil(float64(memInc)))
+		scaleUpTo(&proposal.Mem, currentMemory, int32(math.Min(float64(targetHeuristic), float64(resources.Memory.MaxBytes))), ",Rule 5: connections above maximum")
+	}
+
+	// Rule 6 memory
+	if config.MinCacheHitRatio > 0 && resources.Memory != nil && signals.CacheHitRatio < config.MinCacheHitRatio && currentMemory < int32(resources.Memory.MaxBytes) {
+		memInc := (config.MinCacheHitRatio - signals.CacheHitRatio) * float32(currentMemory) / config.MinCacheHitRatio
+		targetHeuristic := currentMemory + int32(math.Ceil(float64(memInc)))
+		scaleUpTo(&proposal.Mem, currentMemory, int32(math.Min(float64(targetHeuristic), float64(resources.Memory.MaxBytes))), ",Rule 6: cache hit ratio below minimum")
+	}
+
+	// Rule 7 CPU
+	if config.MaxReplicationLagSeconds > 0 && resources.Cpu != nil && signals.ReplicationLagSeconds > config.MaxReplicationLagSeconds && currentCores < int32(resources.Cpu.MaxCores) {
+		scaleUpTo(&proposal.Cpu, currentCores, currentCores+1, ",Rule 7: replication lag above maximum")
+	}
+
+	return proposal
+}
+
+// Overrides a scale operation to reach at least the target, a larger scale up is kept
+func scaleUpTo(op *s.ScaleOp, current, target int32, reason string) {
+	if op.Direction == s.ScaleUp && current+op.Amount >= target {
+		return
+	}
+	op.Direction = s.ScaleUp
+	op.Reason = op.Reason + reason
+	op.Amount = target - current
+}
+
+func (config PostgresDatabaseConfig) Validate() error {
+	if config.User == "" {
+		return fmt.Errorf("postgres.database.user is empty")
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("postgres.database.port %d is invalid", config.Port)
+	}
+	if config.MaxConnectionsUsage < 0 || config.MaxConnectionsUsage > 1 {
+		return fmt.Errorf("postgres.database.max_connections_usage must be between 0 and 1 but got %f", config.MaxConnectionsUsage)
+	}
+	if config.MinCacheHitRatio < 0 || config.MinCacheHitRatio > 1 {
+		return fmt.Errorf("postgres.database.min_cache_hit_ratio must be between 0 and 1 but got %f", config.MinCacheHitRatio)
+	}
+	if config.MaxReplicationLagSeconds < 0 {
+		return fmt.Errorf("postgres.database.max_replication_lag_seconds must be greater than or equal to 0 but got %f", config.MaxReplicationLagSeconds)
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	s "scaler/shared"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type RedisService struct {
+	Config RedisServiceConfig `yaml:"redis_config"`
+	// Read from the app definition, in direct mode memory is scaled down by a fixed amount
+	ScalingMode s.ScalingMode `yaml:"scaling_mode"`
+	evictedKeys map[string]int64
+}
+
+type RedisServiceConfig struct {
+	CycleTimeSeconds int             `yaml:"cycle_time_seconds"`
+	Resources        s.Resources     `yaml:"resources"`
+	Port             int             `yaml:"port"`
+	Username         s.StringFromEnv `yaml:"username"`
+	Password         s.StringFromEnv `yaml:"password"`
+	Tls              bool            `yaml:"tls"`
+}
+
+// Fields of the INFO command used for scaling
+type RedisInfo struct {
+	UsedMemory       int64
+	MaxMemory        int64
+	ConnectedClients int
+	EvictedKeys      int64
+}
+
+const redisTimeout = 5 * time.Second
+
+func (redis *RedisService) Init() error {
+	if err := initMetricsExporter("redis"); err != nil {
+		return fmt.Errorf("error while registering metrics: %s", err)
+	}
+	redis.evictedKeys = make(map[string]int64)
+	return nil
+}
+
+func (redis *RedisService) GetConfig() RedisServiceConfig {
+	return redis.Config
+}
+
+func (redis RedisService) GetResources() s.Resources {
+	return redis.Config.Resources
+}
+
+func (redis RedisService) GetCycleTimeSeconds() int {
+	return redis.Config.CycleTimeSeconds
+}
+
+// Sends a command using the RESP protocol and returns the raw reply
+func redisCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(command.String())); err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis error: %s", line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return "", fmt.Errorf("invalid bulk string length: %s", line[1:])
+		}
+		buffer := make([]byte, length+2) // trailing \r\n
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return "", err
+		}
+		return string(buffer[:length]), nil
+	default:
+		return "", fmt.Errorf("unexpected reply: %s", line)
+	}
+}
+
+func (redis RedisService) GetInfo(address string) (RedisInfo, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if redis.Config.Tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return RedisInfo{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	reader := bufio.NewReader(conn)
+
+	if redis.Config.Password != "" {
+		args := []string{"AUTH", string(redis.Config.Password)}
+		if redis.Config.Username != "" {
+			args = []string{"AUTH", string(redis.Config.Username), string(redis.Config.Password)}
+		}
+		if _, err := redisCommand(conn, reader, args...); err != nil {
+			return RedisInfo{}, fmt.Errorf("error while authenticating: %s", err)
+		}
+	}
+	info, err := redisCommand(conn, reader, "INFO")
+	if err != nil {
+		return RedisInfo{}, fmt.Errorf("error while getting info: %s", err)
+	}
+	return parseRedisInfo(info)
+}
+
+func parseRedisInfo(info string) (RedisInfo, error) {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if found && !strings.HasPrefix(key, "#") {
+			fields[key] = value
+		}
+	}
+	parsed := RedisInfo{}
+	var err error
+	if parsed.UsedMemory, err = strconv.ParseInt(fields["used_memory"], 10, 64); err != nil {
+		return parsed, fmt.Errorf("used_memory is invalid: %s", err)
+	}
+	if parsed.MaxMemory, err = strconv.ParseInt(fields["maxmemory"], 10, 64); err != nil {
+		return parsed, fmt.Errorf("maxmemory is invalid: %s", err)
+	}
+	if parsed.ConnectedClients, err = strconv.Atoi(fields["connected_clients"]); err != nil {
+		return parsed, fmt.Errorf("connected_clients is invalid: %s", err)
+	}
+	if parsed.EvictedKeys, err = strconv.ParseInt(fields["evicted_keys"], 10, 64); err != nil {
+		return parsed, fmt.Errorf("evicted_keys is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (redis RedisService) address(server s.Server) string {
+	port := redis.Config.Port
+	if port == 0 {
+		port = 6379
+	}
+	return net.JoinHostPort(server.ServerName, strconv.Itoa(port))
+}
+
+func (redis RedisService) ComputeScalingProposal(object s.ScaledObject) (s.ResourceScalingProposal, error) {
+	var server *s.Server
+	switch objectType := object.(type) {
+	case *s.Server:
+		server = objectType
+	default:
+		return s.ResourceScalingProposal{}, fmt.Errorf("unsupported scaled object type: %s", object.GetType())
+	}
+	if !server.Ready {
+		return s.ResourceScalingProposal{}, fmt.Errorf("server %s is not ready", server.ServerName)
+	}
+
+	info, err := redis.GetInfo(redis.address(*server))
+	if err != nil {
+		errorsTotalCounter.Inc()
+		return s.ResourceScalingProposal{}, fmt.Errorf("error while getting redis info: %s", err)
+	}
+	slog.Info(fmt.Sprintf("Redis info for server %s: %+v\n", server.ServerName, info))
+	loadScoreGauge.WithLabelValues(server.ServerName).Set(float64(info.ConnectedClients))
+
+	previousEvictedKeys, known := redis.evictedKeys[server.ServerId]
+	redis.evictedKeys[server.ServerId] = info.EvictedKeys
+	evicting := known && info.EvictedKeys > previousEvictedKeys
+
+	return redis.computeScalingProposalInternal(*server, info, evicting), nil
+}
+
+// The app definition defaults to direct scaling when no mode is set
+func (redis RedisService) directScaling() bool {
+	return redis.ScalingMode == "" || redis.ScalingMode == s.DirectScaling
+}
+
+// Converts bytes to the memory unit of the resources (MB)
+func bytesToMegabytes(bytes int64) int32 {
+	return int32(math.Ceil(float64(bytes) / (1024 * 1024)))
+}
+
+func (redis RedisService) computeScalingProposalInternal(server s.Server, info RedisInfo, evicting bool) s.ResourceScalingProposal {
+	targetResource := &s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+		Mem: s.ScaleOp{
+			Direction: s.ScaleNone,
+			Reason:    "Default",
+			Amount:    0,
+		},
+	}
+	// Scaling rules:
+	// 1. Scale up if current resource is below configured minimum
+	// 2. Scale up if current resource usage exceeds maximum usage
+	// Add enough resources to either reach usage below the maximum usage or the maximum amount of resources
+	// 3. Scale down if current resource is above configured maximum
+	// 4. Scale down if current resource usage is below minimum usage
+	// Remove enough resources to either reach usage above the minimum usage or the minimum amount of resources
+	// 5. Scale up memory by a quarter if keys were evicted since the last cycle
+	// Memory is never scaled down below the memory used by Redis
+	// Memory usage is the highest of the server memory usage and used_memory relative to maxmemory
+
+	if cpu := redis.Config.Resources.Cpu; cpu != nil {
+		currentCores := server.ResourceState.Cpu.CurrentCores
+		currentCpuUsage := server.ResourceState.Cpu.CurrentUsage
+
+		// Rule 1 CPU
+		if currentCores < int32(cpu.MinCores) {
+			targetResource.Cpu.Direction = s.ScaleUp
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 1: resource below minimum"
+			targetResource.Cpu.Amount = int32(cpu.MinCores) - currentCores
+		}
+
+		// Rule 2 CPU
+		if cpuMaxUsageDelta := currentCpuUsage - cpu.MaxUsage; cpuMaxUsageDelta > 0 && currentCores < int32(cpu.MaxCores) {
+			targetResource.Cpu.Direction = s.ScaleUp
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 2: usage above maximum"
+			cpuInc := cpuMaxUsageDelta * float32(currentCores) / currentCpuUsage
+			targetHeuristic := currentCores + int32(math.Ceil(float64(cpuInc)))
+			targetResource.Cpu.Amount = int32(math.Min(float64(targetHeuristic), float64(cpu.MaxCores))) - currentCores
+		}
+
+		// Rule 3 CPU
+		if currentCores > int32(cpu.MaxCores) {
+			targetResource.Cpu.Direction = s.ScaleDown
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 3: resource above maximum"
+			targetResource.Cpu.Amount = int32(cpu.MaxCores) - currentCores
+		}
+
+		// Rule 4 CPU
+		if cpuMinUsageDelta := cpu.MinUsage - currentCpuUsage; cpuMinUsageDelta > 0 && currentCores > int32(cpu.MinCores) {
+			targetResource.Cpu.Direction = s.ScaleDown
+			targetResource.Cpu.Reason = targetResource.Cpu.Reason + ",Rule 4: usage below minimum"
+			cpuDec := cpuMinUsageDelta * float32(currentCores) / cpu.MinUsage
+			targetHeuristic := currentCores - int32(math.Ceil(float64(cpuDec)))
+			targetResource.Cpu.Amount = int32(math.Max(float64(targetHeuristic), float64(cpu.MinCores))) - currentCores
+		}
+	}
+
+	if memory := redis.Config.Resources.Memory; memory != nil {
+		currentMemory := server.ResourceState.Memory.CurrentBytes
+		currentMemoryUsage := server.ResourceState.Memory.CurrentUsage
+		if info.MaxMemory > 0 {
+			currentMemoryUsage = float32(math.Max(float64(currentMemoryUsage), float64(info.UsedMemory)/float64(info.MaxMemory)))
+		}
+		usedMemory := bytesToMegabytes(info.UsedMemory)
+
+		// Rule 1 memory
+		if currentMemory < int32(memory.MinBytes) {
+			targetResource.Mem.Direction = s.ScaleUp
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 1: resource below minimum"
+			targetResource.Mem.Amount = int32(memory.MinBytes) - currentMemory
+		}
+
+		// Rule 2 memory
+		if memMaxUsageDelta := currentMemoryUsage - memory.MaxUsage; memMaxUsageDelta > 0 && currentMemory < int32(memory.MaxBytes) {
+			targetResource.Mem.Direction = s.ScaleUp
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 2: usage above maximum"
+			memInc := memMaxUsageDelta * float32(currentMemory) / currentMemoryUsage
+			targetHeuristic := currentMemory + int32(math.Ceil(float64(memInc)))
+			targetResource.Mem.Amount = int32(math.Min(float64(targetHeuristic), float64(memory.MaxBytes))) - currentMemory
+		}
+
+		// Rule 3 memory
+		if currentMemory > int32(memory.MaxBytes) {
+			targetResource.Mem.Direction = s.ScaleDown
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 3: resource above maximum"
+			targetResource.Mem.Amount = int32(math.Max(float64(memory.MaxBytes), float64(usedMemory))) - currentMemory
+		}
+
+		// Rule 4 memory
+		if memMinUsageDelta := memory.MinUsage - currentMemoryUsage; memMinUsageDelta > 0 && currentMemory > int32(memory.MinBytes) {
+			targetResource.Mem.Direction = s.ScaleDown
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 4: usage below minimum"
+			memDec := memMinUsageDelta * float32(currentMemory) / memory.MinUsage
+			targetHeuristic := currentMemory - int32(math.Ceil(float64(memDec)))
+			targetResource.Mem.Amount = int32(math.Max(float64(targetHeuristic), float64(memory.MinBytes))) - currentMemory
+		}
+
+		// Rule 5 memory
+		if evicting && currentMemory < int32(memory.MaxBytes) {
+			targetHeuristic := currentMemory + int32(math.Ceil(float64(currentMemory)/4))
+			target := int32(math.Min(float64(targetHeuristic), float64(memory.MaxBytes)))
+			if targetResource.Mem.Direction != s.ScaleUp || currentMemory+targetResource.Mem.Amount < target {
+				targetResource.Mem.Direction = s.ScaleUp
+				targetResource.Mem.Reason = targetResource.Mem.Reason + ",Rule 5: keys evicted"
+				targetResource.Mem.Amount = target - currentMemory
+			}
+		}
+
+		// Never scale down below the memory used by Redis
+		if targetResource.Mem.Direction == s.ScaleDown && currentMemory+targetResource.Mem.Amount < usedMemory {
+			targetResource.Mem.Amount = usedMemory - currentMemory
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Limited by used memory"
+		}
+		// In direct mode the amount is replaced by a fixed step, so the scale down is dropped if that step goes too far
+		if targetResource.Mem.Direction == s.ScaleDown && targetResource.Mem.Amount < 0 && redis.directScaling() && currentMemory+s.DirectMemDecrease < usedMemory {
+			targetResource.Mem.Amount = 0
+			targetResource.Mem.Reason = targetResource.Mem.Reason + ",Fixed step below used memory"
+		}
+		if targetResource.Mem.Direction == s.ScaleDown && targetResource.Mem.Amount >= 0 {
+			targetResource.Mem.Direction = s.ScaleNone
+			targetResource.Mem.Amount = 0
+		}
+	}
+
+	return *targetResource
+}
+
+func (service RedisService) Validate() error {
+	if err := service.Config.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (config RedisServiceConfig) Validate() error {
+	if config.CycleTimeSeconds <= 0 {
+		return fmt.Errorf("cycle time seconds must be greater than 0")
+	}
+	if err := config.Resources.Validate(); err != nil {
+		return err
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("redis.port %d is invalid", config.Port)
+	}
+	if config.Username != "" && config.Password == "" {
+		return fmt.Errorf("redis.password is empty while redis.username is set")
+	}
+	return nil
+}
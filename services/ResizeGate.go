@@ -0,0 +1,183 @@
+package services
+
+import (
+	"fmt"
+	s "scaler/shared"
+)
+
+// Stops sending new sessions to a server, for example a load balancer or the server itself
+type drainer interface {
+	drain(server s.Server) error
+	undrain(server s.Server) error
+	// Whether the server is drained already, e.g. by a previous run of the scaler
+	drained(server s.Server) (bool, error)
+}
+
+// Optionally implemented by a drainer to get a drained server ready for its resize, e.g. by shutting its service down
+// The resize is held back until ready is returned
+type resizePreparer interface {
+	prepareResize(server s.Server, proposal s.ResourceScalingProposal) (ready bool, err error)
+}
+
+// Drain progress of a server, keyed by the server ID
+type serverDrain struct {
+	// Set once the resize went through, along with the resources the server had before it
+	resizing bool
+	cores    int32
+	bytes    int32
+	// Set once the server was seen not ready after the resize, as it is while rebooting
+	rebooted bool
+}
+
+// Resizing reboots a server, so sessions are drained from it first
+// Scale-ups are only drained when drainScaleUp is set, as holding them back would overload the server further
+type resizeGate struct {
+	drainer      drainer
+	drainScaleUp bool
+	drains       map[string]*serverDrain
+	// Servers checked for a drain left behind by a previous run
+	checked map[string]bool
+}
+
+func newResizeGate(drainer drainer, drainScaleUp bool) *resizeGate {
+	return &resizeGate{
+		drainer:      drainer,
+		drainScaleUp: drainScaleUp,
+		drains:       make(map[string]*serverDrain),
+		checked:      make(map[string]bool),
+	}
+}
+
+// Takes over the drain of a server drained by a previous run, e.g. when the scaler restarted in the middle of a drain
+// Each server is checked once, its drain is tracked in memory afterwards
+func (gate *resizeGate) recoverDrain(server s.Server) error {
+	if gate.checked[server.ServerId] {
+		return nil
+	}
+	if _, ok := gate.drains[server.ServerId]; !ok {
+		drained, err := gate.drainer.drained(server)
+		if err != nil {
+			return err
+		}
+		if drained {
+			gate.drains[server.ServerId] = &serverDrain{}
+		}
+	}
+	gate.checked[server.ServerId] = true
+	return nil
+}
+
+// Puts a server back into rotation once it is running again after a resize
+// It must also be called for servers that are not ready, so that the reboot is noticed
+func (gate *resizeGate) finishResize(server s.Server) error {
+	drain, ok := gate.drains[server.ServerId]
+	if !ok || !drain.resizing {
+		return nil
+	}
+	if !server.Ready {
+		drain.rebooted = true
+		return nil
+	}
+	if drain.rebooted || drain.cores != currentCores(server) || drain.bytes != currentBytes(server) {
+		return gate.undrain(server)
+	}
+	return nil
+}
+
+func (gate *resizeGate) undrain(server s.Server) error {
+	if err := gate.drainer.undrain(server); err != nil {
+		return err
+	}
+	delete(gate.drains, server.ServerId)
+	return nil
+}
+
+// Holds back a resize until the server is drained and has no sessions left
+// The sessions count is only trusted from the cycle after draining, as a session may have started in between
+func (gate *resizeGate) gateResize(server s.Server, sessionsCount int, proposal s.ResourceScalingProposal) (s.ResourceScalingProposal, error) {
+	if err := gate.recoverDrain(server); err != nil {
+		return holdResize(proposal, ""), err
+	}
+	drain, draining := gate.drains[server.ServerId]
+
+	// The server is neither rebooting nor resized yet, it stays drained while the resize is retried
+	if draining && drain.resizing {
+		if !isResize(proposal) {
+			// The last resize was dropped before reaching the server
+			return proposal, gate.undrain(server)
+		}
+		return proposal, nil
+	}
+
+	if !gate.needsDrain(proposal) {
+		// The resize is not needed anymore or does not need draining, put the server back into rotation
+		if draining {
+			return proposal, gate.undrain(server)
+		}
+		return proposal, nil
+	}
+
+	if !draining {
+		if err := gate.drainer.drain(server); err != nil {
+			return holdResize(proposal, ""), err
+		}
+		gate.drains[server.ServerId] = &serverDrain{}
+		return holdResize(proposal, "Drain: server drained"), nil
+	}
+
+	if sessionsCount > 0 {
+		return holdResize(proposal, fmt.Sprintf("Drain: waiting for %d sessions", sessionsCount)), nil
+	}
+
+	if preparer, ok := gate.drainer.(resizePreparer); ok {
+		ready, err := preparer.prepareResize(server, proposal)
+		if err != nil {
+			return holdResize(proposal, ""), err
+		}
+		if !ready {
+			return holdResize(proposal, "Drain: waiting for shutdown"), nil
+		}
+	}
+
+	drain.resizing = true
+	drain.cores = currentCores(server)
+	drain.bytes = currentBytes(server)
+	return proposal, nil
+}
+
+func (gate *resizeGate) needsDrain(proposal s.ResourceScalingProposal) bool {
+	if gate.drainScaleUp {
+		return isResize(proposal)
+	}
+	return proposal.Cpu.Direction == s.ScaleDown || proposal.Mem.Direction == s.ScaleDown
+}
+
+func isResize(proposal s.ResourceScalingProposal) bool {
+	return proposal.Cpu.Direction != s.ScaleNone || proposal.Mem.Direction != s.ScaleNone
+}
+
+func currentCores(server s.Server) int32 {
+	if server.ResourceState.Cpu == nil {
+		return 0
+	}
+	return server.ResourceState.Cpu.CurrentCores
+}
+
+func currentBytes(server s.Server) int32 {
+	if server.ResourceState.Memory == nil {
+		return 0
+	}
+	return server.ResourceState.Memory.CurrentBytes
+}
+
+// Replaces a proposal with a no-op while keeping the reasons of the original proposal
+func holdResize(proposal s.ResourceScalingProposal, reason string) s.ResourceScalingProposal {
+	for _, op := range []*s.ScaleOp{&proposal.Cpu, &proposal.Mem} {
+		if op.Direction != s.ScaleNone && reason != "" {
+			op.Reason = op.Reason + "," + reason
+		}
+		op.Direction = s.ScaleNone
+		op.Amount = 0
+	}
+	return proposal
+}
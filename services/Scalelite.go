@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	s "scaler/shared"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Scalelite is the load balancer in front of the BBB servers
+// Servers are cordoned in Scalelite before a resize so that no new meeting starts on them
+type ScaleliteConfig struct {
+	Url    string          `yaml:"url"`
+	Secret s.StringFromEnv `yaml:"secret"`
+	// Also cordon servers before a scale-up, by default scale-ups go through right away
+	DrainScaleUp bool `yaml:"drain_scale_up"`
+}
+
+// Server states as defined by the Scalelite server API
+const (
+	scaleliteStateEnabled  = "enabled"
+	scaleliteStateCordoned = "cordoned"
+)
+
+type scaleliteServer struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	State  string `json:"state"`
+	Online bool   `json:"online"`
+}
+
+type scaleliteClient struct {
+	config     ScaleliteConfig
+	httpClient *http.Client
+	hostname   func(s.Server) string
+	// Scalelite server IDs of the cordoned servers, keyed by the Ionos server ID
+	cordoned map[string]string
+}
+
+// The hostname function maps a server to the BBB hostname registered in Scalelite
+func newScaleliteClient(config ScaleliteConfig, hostname func(s.Server) string) *scaleliteClient {
+	return &scaleliteClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		hostname:   hostname,
+		cordoned:   make(map[string]string),
+	}
+}
+
+// Calls the Scalelite server API, the checksum is computed over the action name, the body and the secret
+func (sl *scaleliteClient) call(action string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	checksumRaw := sha256.Sum256([]byte(action + string(body) + string(sl.config.Secret)))
+	endpoint, err := url.JoinPath(sl.config.Url, "scalelite/api", action)
+	if err != nil {
+		return err
+	}
+	endpoint = fmt.Sprintf("%s?checksum=%s", endpoint, hex.EncodeToString(checksumRaw[:]))
+
+	resp, err := sl.httpClient.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("scalelite %s returned %d: %s", action, resp.StatusCode, respBody)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, response)
+}
+
+// Finds the Scalelite server whose BBB URL points to the given host
+func (sl *scaleliteClient) findServer(host string) (*scaleliteServer, error) {
+	var servers []scaleliteServer
+	if err := sl.call("getServers", struct{}{}, &servers); err != nil {
+		return nil, fmt.Errorf("error while getting scalelite servers: %s", err)
+	}
+	for _, server := range servers {
+		serverUrl, err := url.Parse(server.Url)
+		if err != nil {
+			continue
+		}
+		if serverUrl.Hostname() == host {
+			return &server, nil
+		}
+	}
+	return nil, fmt.Errorf("no scalelite server found for %s", host)
+}
+
+func (sl *scaleliteClient) setState(scaleliteId, state string) error {
+	request := map[string]any{
+		"id":     scaleliteId,
+		"server": map[string]string{"state": state},
+	}
+	if err := sl.call("updateServer", request, nil); err != nil {
+		return fmt.Errorf("error while setting scalelite server %s to %s: %s", scaleliteId, state, err)
+	}
+	return nil
+}
+
+func (sl *scaleliteClient) drain(server s.Server) error {
+	scaleliteServer, err := sl.findServer(sl.hostname(server))
+	if err != nil {
+		return err
+	}
+	if err := sl.setState(scaleliteServer.Id, scaleliteStateCordoned); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("Cordoned server %s (%s) in scalelite\n", server.ServerName, scaleliteServer.Id))
+	sl.cordoned[server.ServerId] = scaleliteServer.Id
+	return nil
+}
+
+// Cordoned servers are taken for servers drained by the scaler, so that they are enabled again after a restart
+func (sl *scaleliteClient) drained(server s.Server) (bool, error) {
+	scaleliteServer, err := sl.findServer(sl.hostname(server))
+	if err != nil {
+		return false, err
+	}
+	if scaleliteServer.State != scaleliteStateCordoned {
+		return false, nil
+	}
+	slog.Info(fmt.Sprintf("Found server %s (%s) cordoned in scalelite\n", server.ServerName, scaleliteServer.Id))
+	sl.cordoned[server.ServerId] = scaleliteServer.Id
+	return true, nil
+}
+
+func (sl *scaleliteClient) undrain(server s.Server) error {
+	scaleliteId, ok := sl.cordoned[server.ServerId]
+	if !ok {
+		return nil
+	}
+	if err := sl.setState(scaleliteId, scaleliteStateEnabled); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("Enabled server %s (%s) in scalelite\n", server.ServerName, scaleliteId))
+	delete(sl.cordoned, server.ServerId)
+	return nil
+}
+
+func (config ScaleliteConfig) Validate() error {
+	if config.Url == "" {
+		return fmt.Errorf("scalelite.url is empty")
+	}
+	urlParsed, err := url.Parse(config.Url)
+	if err != nil {
+		return fmt.Errorf("scalelite.url is invalid: %v", err)
+	}
+	if urlParsed.Scheme != "http" && urlParsed.Scheme != "https" {
+		return fmt.Errorf("scalelite.url scheme is invalid: %s", urlParsed.Scheme)
+	}
+	if config.Secret == "" {
+		return fmt.Errorf("scalelite.secret is empty")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	s "scaler/shared"
+	"testing"
+)
+
+func TestValidateBBBApiConfig(t *testing.T) {
+	s.ValidatePass(t, &BBBApiConfig{})
+	s.ValidatePass(t, &BBBApiConfig{UrlTemplate: "https://{{ .Host }}:8443/bbb/api/", ChecksumAlgorithm: "sha512"})
+	s.ValidateFail(t, &BBBApiConfig{UrlTemplate: "https://{{ .Host }"})
+	s.ValidateFail(t, &BBBApiConfig{ChecksumAlgorithm: "md5"})
+	s.ValidateFail(t, &BBBApiConfig{TimeoutSeconds: -1})
+	s.ValidateFail(t, &BBBApiConfig{Hostnames: map[string]string{"bbb-1": ""}})
+}
+
+func TestBBBClientUrlTemplate(t *testing.T) {
+	client, err := NewBBBClient(BBBApiConfig{
+		UrlTemplate: "https://{{ .Host }}/{{ .ServerId }}/api",
+		Hostnames:   map[string]string{"bbb.example.com": "bbb-1.public.example.com"},
+	}, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	got, err := client.SignedUrl(sampleBBBServer, "getMeetings", "")
+	if err != nil {
+		t.Fatalf("Failed to sign request: %v", err)
+	}
+	parsed, _ := url.Parse(got)
+	if parsed.Host != "bbb-1.public.example.com" || parsed.Path != "/5678/api/getMeetings" || parsed.Query().Get("checksum") == "" {
+		t.Fatalf("Unexpected url %s", got)
+	}
+}
+
+// Check a getMeetings call against a fake BBB server verifying SHA-256 checksums
+func TestBBBClientGetMeetings(t *testing.T) {
+	response, err := os.ReadFile("test_files/bbb_get_participants_ok.xml")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checksum := sha256.Sum256([]byte("getMeetings" + "secret"))
+		if r.URL.Path != "/bigbluebutton/api/getMeetings" || r.URL.Query().Get("checksum") != hex.EncodeToString(checksum[:]) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(response)
+	}))
+	defer fake.Close()
+
+	fakeUrl, _ := url.Parse(fake.URL)
+	client, err := NewBBBClient(BBBApiConfig{
+		UrlTemplate:       "http://{{ .Host }}/bigbluebutton/api/",
+		ChecksumAlgorithm: "sha256",
+		Hostnames:         map[string]string{sampleBBBServer.ServerName: fakeUrl.Host},
+	}, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	meetings, err := client.GetMeetings(sampleBBBServer)
+	if err != nil {
+		t.Fatalf("Failed to get meetings: %v", err)
+	}
+	if count := countParticipants(meetings); count != 2 {
+		t.Fatalf("Expected count to be 2 but got %d", count)
+	}
+
+	client.secret = "wrong"
+	if _, err := client.GetMeetings(sampleBBBServer); err == nil {
+		t.Fatalf("Expected error but got nil")
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	s "scaler/shared"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestValidatePrewarmingConfig(t *testing.T) {
+	s.ValidatePass(t, &BBBPrewarmingConfig{File: "meetings.json", LeadTimeSeconds: 900, ParticipantsPerCore: 10})
+	s.ValidatePass(t, &BBBPrewarmingConfig{Url: "https://lms.example.com/meetings", LeadTimeSeconds: 900, ParticipantsPerCore: 10})
+	s.ValidateFail(t, &BBBPrewarmingConfig{LeadTimeSeconds: 900, ParticipantsPerCore: 10})
+	s.ValidateFail(t, &BBBPrewarmingConfig{File: "meetings.json", Url: "https://lms.example.com/meetings", LeadTimeSeconds: 900, ParticipantsPerCore: 10})
+	s.ValidateFail(t, &BBBPrewarmingConfig{File: "meetings.json", ParticipantsPerCore: 10})
+	s.ValidateFail(t, &BBBPrewarmingConfig{File: "meetings.json", LeadTimeSeconds: 900})
+}
+
+func TestScheduleFromFile(t *testing.T) {
+	schedule := newMeetingSchedule(BBBPrewarmingConfig{File: "test_files/bbb_scheduled_meetings.json"}, time.Minute)
+	meetings := schedule.getMeetings()
+	if len(meetings) != 4 {
+		t.Fatalf("Expected 4 meetings but got %d", len(meetings))
+	}
+
+	leadTime := 15 * time.Minute
+	cases := map[string]int{
+		"2024-03-04T07:30:00Z": 0,
+		"2024-03-04T08:05:00Z": 12,
+		"2024-03-04T08:15:00Z": 0,
+		"2024-03-04T09:00:00Z": 0,
+		"2024-03-04T13:50:00Z": 60,
+	}
+	for now, expected := range cases {
+		nowParsed, _ := time.Parse(time.RFC3339, now)
+		if got := expectedParticipants(meetings, "bbb.example.com", nowParsed, leadTime); got != expected {
+			t.Errorf("Expected %d participants at %s but got %d", expected, now, got)
+		}
+	}
+}
+
+func TestScheduleFromUrl(t *testing.T) {
+	raw, err := os.ReadFile("test_files/bbb_scheduled_meetings.json")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	requests := 0
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(raw)
+	}))
+	defer fake.Close()
+
+	schedule := newMeetingSchedule(BBBPrewarmingConfig{Url: fake.URL, Token: "token"}, time.Minute)
+	if meetings := schedule.getMeetings(); len(meetings) != 4 {
+		t.Fatalf("Expected 4 meetings but got %d", len(meetings))
+	}
+	// The schedule is cached for the cycle time
+	schedule.getMeetings()
+	if requests != 1 {
+		t.Fatalf("Expected 1 request but got %d", requests)
+	}
+}
+
+// Check that a failing schedule endpoint is not called again before the cycle time
+func TestScheduleFromUrlFailure(t *testing.T) {
+	errorsTotalCounter = prometheus.NewCounter(prometheus.CounterOpts{Name: "test_errors_total"})
+	requests := 0
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer fake.Close()
+
+	schedule := newMeetingSchedule(BBBPrewarmingConfig{Url: fake.URL}, time.Minute)
+	for i := 0; i < 3; i++ {
+		if meetings := schedule.getMeetings(); len(meetings) != 0 {
+			t.Fatalf("Expected no meetings but got %d", len(meetings))
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected 1 request but got %d", requests)
+	}
+}
+
+func TestApplyPrewarming(t *testing.T) {
+	bbbConfig := *validBBBConfig
+	bbbConfig.Resources.Cpu = &s.CpuResources{MinCores: 2, MaxCores: 8, MaxUsage: 0.5}
+	bbbConfig.Prewarming = &BBBPrewarmingConfig{File: "meetings.json", LeadTimeSeconds: 900, ParticipantsPerCore: 10}
+	bbbService := BBBService{Config: bbbConfig}
+
+	server := sampleBBBServer
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0}
+
+	// Scale up ahead of 42 participants
+	proposal := bbbService.applyPrewarming(server, bbbService.computeScalingProposalInternal(server, 0, 0), 0, 42)
+	if proposal.Cpu.Direction != s.ScaleUp || proposal.Cpu.Amount != 3 {
+		t.Fatalf("Expected scale up by 3 cores but got %+v", proposal.Cpu)
+	}
+
+	// Never above the maximum
+	proposal = bbbService.applyPrewarming(server, bbbService.computeScalingProposalInternal(server, 0, 0), 0, 500)
+	if proposal.Cpu.Amount != 6 {
+		t.Fatalf("Expected scale up by 6 cores but got %+v", proposal.Cpu)
+	}
+
+	// An empty server is not scaled down below the scheduled need
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 6, CurrentUsage: 0}
+	proposal = bbbService.applyPrewarming(server, bbbService.computeScalingProposalInternal(server, 0, 0), 0, 42)
+	if proposal.Cpu.Direction != s.ScaleDown || proposal.Cpu.Amount != -1 {
+		t.Fatalf("Expected scale down by 1 core but got %+v", proposal.Cpu)
+	}
+	proposal = bbbService.applyPrewarming(server, bbbService.computeScalingProposalInternal(server, 0, 0), 0, 60)
+	if proposal.Cpu.Direction != s.ScaleNone {
+		t.Fatalf("Expected no scaling but got %+v", proposal.Cpu)
+	}
+
+	// A server with participants is not resized for upcoming meetings
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.2}
+	proposal = bbbService.applyPrewarming(server, bbbService.computeScalingProposalInternal(server, 5, 5), 5, 42)
+	if proposal.Cpu.Direction != s.ScaleNone {
+		t.Fatalf("Expected no scaling but got %+v", proposal.Cpu)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	s "scaler/shared"
+	"testing"
+	"time"
+)
+
+func gradualBBBService() BBBService {
+	config := *validBBBConfig
+	cpu := *config.Resources.Cpu
+	cpu.MaxCores = 8
+	cpu.MinUsage = 0.2
+	memory := *config.Resources.Memory
+	memory.MaxBytes = 16384
+	memory.MinUsage = 0.2
+	config.Resources = s.Resources{Cpu: &cpu, Memory: &memory}
+	config.GradualScaleDown = &BBBScaleDownConfig{IdleTimeSeconds: 600, MaxStepCores: 2}
+	return BBBService{Config: config}
+}
+
+func TestValidateBBBScaleDownConfig(t *testing.T) {
+	s.ValidatePass(t, BBBScaleDownConfig{IdleTimeSeconds: 600})
+	s.ValidateFail(t, BBBScaleDownConfig{})
+	s.ValidateFail(t, BBBScaleDownConfig{IdleTimeSeconds: 600, MaxStepCores: -1})
+
+	s.ValidatePass(t, gradualBBBService().Config)
+	config := *validBBBConfig
+	config.GradualScaleDown = &BBBScaleDownConfig{IdleTimeSeconds: 600}
+	s.ValidateFail(t, config)
+
+	// The rules need both resources
+	config = gradualBBBService().Config
+	config.Resources.Memory = nil
+	s.ValidateFail(t, config)
+	config = gradualBBBService().Config
+	config.Resources.Cpu = nil
+	s.ValidateFail(t, config)
+}
+
+// Check that the idle time starts again when participants join or the server is resized
+func TestBBBIdleTracker(t *testing.T) {
+	tracker := newBBBIdleTracker()
+	server := sampleBBBServer
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 6}
+	server.ResourceState.Memory = &s.MemoryResourceState{CurrentBytes: 8192}
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		minutes      int
+		participants int
+		cores        int32
+		expected     time.Duration
+	}{
+		{0, 10, 6, 0},
+		{5, 4, 6, 5 * time.Minute},
+		{10, 0, 6, 10 * time.Minute},
+		{15, 3, 6, 0},
+		{20, 0, 6, 5 * time.Minute},
+		{25, 0, 4, 0},
+		{30, 0, 4, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		server.ResourceState.Cpu.CurrentCores = test.cores
+		idle := tracker.observe(server, test.participants, start.Add(time.Duration(test.minutes)*time.Minute))
+		if idle != test.expected {
+			t.Errorf("At minute %d expected idle %s but got %s", test.minutes, test.expected, idle)
+		}
+	}
+}
+
+func TestBBBApplyGradualScaleDown(t *testing.T) {
+	bbb := gradualBBBService()
+	server := sampleBBBServer
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 6, CurrentUsage: 0.05}
+	server.ResourceState.Memory = &s.MemoryResourceState{CurrentBytes: 8192, CurrentUsage: 0.15}
+
+	// Rule 3 does not drop to the minimum without load anymore
+	proposal := bbb.computeScalingProposalInternal(server, 0, 0)
+	if isResize(proposal) {
+		t.Fatalf("Expected no resize without gradual rule but got %+v", proposal)
+	}
+
+	tests := []struct {
+		name      string
+		meetings  int
+		idle      time.Duration
+		cpuAmount int32
+		memAmount int32
+	}{
+		{"meetings running", 1, time.Hour, 0, 0},
+		{"not idle long enough", 0, 5 * time.Minute, 0, 0},
+		{"idle", 0, 15 * time.Minute, -2, -2048},
+	}
+	for _, test := range tests {
+		proposal := bbb.applyGradualScaleDown(server, bbb.computeScalingProposalInternal(server, 0, 0), test.meetings, test.idle)
+		if proposal.Cpu.Amount != test.cpuAmount || proposal.Mem.Amount != test.memAmount {
+			t.Errorf("%s: expected cpu %d and memory %d but got %+v", test.name, test.cpuAmount, test.memAmount, proposal)
+		}
+	}
+
+	// Steps never go below the configured minimum
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 3, CurrentUsage: 0.01}
+	proposal = bbb.applyGradualScaleDown(server, bbb.computeScalingProposalInternal(server, 0, 0), 0, time.Hour)
+	if proposal.Cpu.Direction != s.ScaleDown || proposal.Cpu.Amount != -1 {
+		t.Fatalf("Expected scale down to minimum but got %+v", proposal.Cpu)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	s "scaler/shared"
+	"testing"
+)
+
+var validGenericConfig = GenericServiceConfig{
+	CycleTimeSeconds: 60,
+	Resources: s.Resources{
+		Cpu: &s.CpuResources{
+			MinCores: 1,
+			MaxCores: 8,
+			MinUsage: 0.2,
+			MaxUsage: 0.7,
+		},
+	},
+	Probe: GenericProbeConfig{
+		UrlTemplate: "http://{{ .Name }}/status",
+		Busy:        &GenericExtractorConfig{JsonPath: "$.jobs.active"},
+	},
+}
+
+func TestValidateGenericConfig(t *testing.T) {
+	s.ValidatePass(t, validGenericConfig)
+	s.ValidateFail(t, GenericServiceConfig{})
+
+	config := validGenericConfig
+	config.Probe.Busy = nil
+	s.ValidateFail(t, config)
+
+	config.Probe.Busy = &GenericExtractorConfig{JsonPath: "$.jobs", Regex: "jobs: (\\d+)"}
+	s.ValidateFail(t, config)
+
+	config.Probe.Busy = &GenericExtractorConfig{JsonPath: "jobs.active"}
+	s.ValidateFail(t, config)
+
+	config.Probe.Busy = &GenericExtractorConfig{Regex: "jobs: ("}
+	s.ValidateFail(t, config)
+}
+
+func TestParseGenericConfigOK(t *testing.T) {
+	os.Setenv("GENERIC_PROBE_TOKEN", "Bearer 1234567890")
+	defer os.Unsetenv("GENERIC_PROBE_TOKEN")
+
+	config, err := s.OpenConfig("test_files/generic_config_ok.yml")
+	if err != nil {
+		t.Fatalf("Failed to open config: %v", err)
+	}
+	c, err := s.LoadConfig[GenericService](config)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if c.Config.Probe.Headers["Authorization"] != "Bearer 1234567890" {
+		t.Fatalf("Expected header from environment but got %s", c.Config.Probe.Headers["Authorization"])
+	}
+}
+
+func TestGenericExtract(t *testing.T) {
+	body := []byte(`{"jobs": {"active": 3, "queue": ["a", "b"]}, "workers": [{"load": "0.75"}], "state name": {"draining": true}}`)
+	tests := []struct {
+		config   GenericExtractorConfig
+		expected float64
+	}{
+		{GenericExtractorConfig{JsonPath: "$.jobs.active"}, 3},
+		{GenericExtractorConfig{JsonPath: "$.jobs.queue"}, 2},
+		{GenericExtractorConfig{JsonPath: "$.workers[0].load"}, 0.75},
+		{GenericExtractorConfig{JsonPath: "$['state name'].draining"}, 1},
+		{GenericExtractorConfig{Regex: `"active": (\d+)`}, 3},
+		{GenericExtractorConfig{Regex: `0\.\d+`}, 0.75},
+	}
+	for _, test := range tests {
+		extractor, err := test.config.compile()
+		if err != nil {
+			t.Fatalf("Failed to compile %+v: %v", test.config, err)
+		}
+		value, err := extractor.extract(body)
+		if err != nil {
+			t.Fatalf("Failed to extract %+v: %v", test.config, err)
+		}
+		if value != test.expected {
+			t.Errorf("Expected %f for %+v but got %f", test.expected, test.config, value)
+		}
+	}
+
+	for _, config := range []GenericExtractorConfig{{JsonPath: "$.jobs.missing"}, {JsonPath: "$.workers[1]"}, {JsonPath: "$.jobs"}, {Regex: "missing: (\\d+)"}} {
+		extractor, err := config.compile()
+		if err != nil {
+			t.Fatalf("Failed to compile %+v: %v", config, err)
+		}
+		if _, err := extractor.extract(body); err == nil {
+			t.Errorf("Expected error for %+v but got nil", config)
+		}
+	}
+}
+
+func TestGenericScalingRules(t *testing.T) {
+	generic := GenericService{Config: validGenericConfig}
+	state := func(cores int32, usage float32) s.ResourceState {
+		return s.ResourceState{Cpu: &s.CpuResourceState{CurrentCores: cores, CurrentUsage: usage}}
+	}
+
+	tests := []struct {
+		name      string
+		state     s.ResourceState
+		result    GenericProbeResult
+		direction s.ScaleDirection
+		amount    int32
+	}{
+		{"usage above maximum", state(2, 0.9), GenericProbeResult{}, s.ScaleUp, 1},
+		{"load above maximum", state(2, 0.1), GenericProbeResult{Busy: 1, Load: 1}, s.ScaleUp, 1},
+		{"usage below minimum", state(4, 0.1), GenericProbeResult{}, s.ScaleDown, -2},
+		{"usage below minimum while busy", state(4, 0.1), GenericProbeResult{Busy: 2}, s.ScaleNone, 0},
+		{"usage within bounds", state(4, 0.5), GenericProbeResult{Load: 0.4}, s.ScaleNone, 0},
+	}
+	for _, test := range tests {
+		proposal := generic.computeScalingProposalInternal(test.state, test.result)
+		if proposal.Cpu.Direction != test.direction || proposal.Cpu.Amount != test.amount {
+			t.Errorf("%s: expected cpu %s by %d but got %+v", test.name, test.direction, test.amount, proposal.Cpu)
+		}
+	}
+}
+
+// Fake application status endpoint checking the rendered URL and headers
+func TestGenericComputeScalingProposal(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/server-1" || r.Header.Get("X-Token") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"jobs": {"active": 0}}`))
+	}))
+	defer app.Close()
+
+	config := validGenericConfig
+	config.Probe.UrlTemplate = app.URL + "/status/{{ .Id }}"
+	config.Probe.Headers = map[string]s.StringFromEnv{"X-Token": "secret"}
+	generic := GenericService{Config: config}
+	if err := generic.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	server := s.Server{
+		ServerId:      "server-1",
+		ServerName:    "worker1.example.com",
+		Ready:         true,
+		ResourceState: s.ResourceState{Cpu: &s.CpuResourceState{CurrentCores: 4, CurrentUsage: 0.1}},
+	}
+	proposal, err := generic.ComputeScalingProposal(&server)
+	if err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if proposal.Cpu.Direction != s.ScaleDown {
+		t.Fatalf("Expected scale down but got %+v", proposal.Cpu)
+	}
+}
+
+// Check that a load outside [0, 1] is rejected as an invalid reading
+func TestGenericProbeLoadOutOfRange(t *testing.T) {
+	load := "1.5"
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"load": ` + load + `}`))
+	}))
+	defer app.Close()
+
+	probe, err := newGenericProbe(GenericProbeConfig{UrlTemplate: app.URL, Load: &GenericExtractorConfig{JsonPath: "$.load"}})
+	if err != nil {
+		t.Fatalf("Failed to create probe: %v", err)
+	}
+	server := s.Server{ServerName: "worker1.example.com"}
+	var invalidReading *s.InvalidReadingError
+	for _, load = range []string{"1.5", "-0.1"} {
+		if _, err := probe.Probe(&server); !errors.As(err, &invalidReading) {
+			t.Errorf("Expected invalid reading for load %s but got %v", load, err)
+		}
+	}
+	load = "0.4"
+	if result, err := probe.Probe(&server); err != nil || result.Load != 0.4 {
+		t.Errorf("Expected load 0.4 but got %f, %v", result.Load, err)
+	}
+}
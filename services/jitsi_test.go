@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"testing"
+)
+
+var validJitsiConfig = JitsiServiceConfig{
+	CycleTimeSeconds: 60,
+	Resources: s.Resources{
+		Cpu: &s.CpuResources{
+			MinCores: 2,
+			MaxCores: 8,
+			MinUsage: 0.2,
+			MaxUsage: 0.7,
+		},
+		Memory: &s.MemoryResources{
+			MinBytes: 4096,
+			MaxBytes: 16384,
+			MinUsage: 0.2,
+			MaxUsage: 0.8,
+		},
+	},
+}
+
+func TestValidateJitsiConfig(t *testing.T) {
+	s.ValidatePass(t, validJitsiConfig)
+	s.ValidateFail(t, JitsiServiceConfig{})
+	config := validJitsiConfig
+	config.UrlTemplate = "http://{{ .ServerName"
+	s.ValidateFail(t, config)
+}
+
+func jitsiServer(cores int32, cpuUsage float32) s.Server {
+	return s.Server{
+		ServerId:   "server-1",
+		ServerName: "jvb1.example.com",
+		Ready:      true,
+		ResourceState: s.ResourceState{
+			Cpu: &s.CpuResourceState{
+				CurrentCores: cores,
+				CurrentUsage: cpuUsage,
+			},
+			Memory: &s.MemoryResourceState{
+				CurrentBytes: 8192,
+				CurrentUsage: 0.5,
+			},
+		},
+	}
+}
+
+func TestJitsiScalingRules(t *testing.T) {
+	jitsi := JitsiService{Config: validJitsiConfig}
+
+	tests := []struct {
+		name         string
+		server       s.Server
+		stats        JitsiStatsJSON
+		cpuDirection s.ScaleDirection
+		cpuAmount    int32
+		memDirection s.ScaleDirection
+	}{
+		{"below minimum", jitsiServer(1, 0.5), JitsiStatsJSON{Conferences: 1}, s.ScaleUp, 1, s.ScaleNone},
+		{"cpu above maximum", jitsiServer(4, 0.9), JitsiStatsJSON{Conferences: 3}, s.ScaleUp, 1, s.ScaleNone},
+		{"stress above maximum", jitsiServer(4, 0.3), JitsiStatsJSON{Conferences: 3, StressLevel: 1.4}, s.ScaleUp, 2, s.ScaleNone},
+		{"usage above maximum without conferences", jitsiServer(4, 0.9), JitsiStatsJSON{}, s.ScaleDown, -2, s.ScaleDown},
+		{"usage within bounds", jitsiServer(4, 0.5), JitsiStatsJSON{Conferences: 2}, s.ScaleNone, 0, s.ScaleNone},
+	}
+	for _, test := range tests {
+		proposal := jitsi.computeScalingProposalInternal(test.server, test.stats)
+		if proposal.Cpu.Direction != test.cpuDirection || proposal.Cpu.Amount != test.cpuAmount {
+			t.Errorf("%s: expected cpu %s by %d but got %+v", test.name, test.cpuDirection, test.cpuAmount, proposal.Cpu)
+		}
+		if proposal.Mem.Direction != test.memDirection {
+			t.Errorf("%s: expected memory %s but got %+v", test.name, test.memDirection, proposal.Mem)
+		}
+	}
+}
+
+// Fake videobridge serving the colibri stats and drain endpoints
+func TestJitsiComputeScalingProposal(t *testing.T) {
+	conferences := 2
+	draining := false
+	shutdown := false
+	jvb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/colibri/stats":
+			// The bridge exits after its graceful shutdown
+			if shutdown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, `{"conferences": %d, "participants": %d, "stress_level": 0.1, "version": "2.3"}`, conferences, conferences*4)
+		case "/colibri/drain/enable":
+			draining = true
+		case "/colibri/drain/disable":
+			draining = false
+		case "/colibri/shutdown":
+			shutdown = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer jvb.Close()
+
+	config := validJitsiConfig
+	config.UrlTemplate = jvb.URL + "/colibri/"
+	config.GracefulShutdown = true
+	jitsi := JitsiService{Config: config}
+	if err := jitsi.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	// Conferences are running, CPU usage is high but at maximum cores
+	server := jitsiServer(8, 0.9)
+	proposal, err := jitsi.ComputeScalingProposal(&server)
+	if err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if isResize(proposal) || draining {
+		t.Fatalf("Expected no resize and no drain but got %+v", proposal)
+	}
+
+	// A scale-up is not drained, so the bridge keeps running
+	server = jitsiServer(1, 0.5)
+	proposal, err = jitsi.ComputeScalingProposal(&server)
+	if err != nil || proposal.Cpu.Direction != s.ScaleUp || draining || shutdown {
+		t.Fatalf("Expected scale-up without drain nor shutdown but got %+v, %v", proposal, err)
+	}
+	server = jitsiServer(8, 0.9)
+
+	// No conferences left, scale down is held back until the bridge is drained
+	conferences = 0
+	proposal, err = jitsi.ComputeScalingProposal(&server)
+	if err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if isResize(proposal) || !draining {
+		t.Fatalf("Expected held resize and drained bridge but got %+v", proposal)
+	}
+
+	// Drained and still without conferences, the bridge is shut down before the resize
+	proposal, err = jitsi.ComputeScalingProposal(&server)
+	if err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if isResize(proposal) || !shutdown {
+		t.Fatalf("Expected held resize and shut down bridge but got %+v", proposal)
+	}
+
+	// The bridge exited, the resize goes through
+	proposal, err = jitsi.ComputeScalingProposal(&server)
+	if err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if proposal.Cpu.Direction != s.ScaleDown {
+		t.Fatalf("Expected scale down once the bridge exited but got %+v", proposal)
+	}
+	if err := jitsi.ScaledObjectUpdated(&server, proposal); err != nil {
+		t.Fatalf("Failed to handle update: %v", err)
+	}
+	if len(jitsi.shutdowns) != 0 {
+		t.Fatalf("Expected the shutdown to be forgotten after the resize was sent")
+	}
+
+	// Back after the resize, the bridge is taken out of drain mode
+	shutdown = false
+	server = jitsiServer(2, 0.1)
+	server.ResourceState.Memory.CurrentBytes = 4096
+	if _, err := jitsi.ComputeScalingProposal(&server); err != nil {
+		t.Fatalf("Failed to compute proposal: %v", err)
+	}
+	if draining {
+		t.Fatalf("Expected bridge to be undrained after resize")
+	}
+}
@@ -4,6 +4,8 @@ import "github.com/prometheus/client_golang/prometheus"
 
 var (
 	errorsTotalCounter prometheus.Counter
+	loadScoreGauge     *prometheus.GaugeVec
+	participantsGauge  *prometheus.GaugeVec
 )
 
 func initMetricsExporter(serviceName string) error {
@@ -16,7 +18,17 @@ func initMetricsExporter(serviceName string) error {
 		Help:        "The total number of errors encountered by a component of the autoscaler",
 		ConstLabels: constLabels,
 	})
-	metrics := []prometheus.Collector{errorsTotalCounter}
+	loadScoreGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "autoscaler_service_load_score",
+		Help:        "The load score of a scaled object as computed by the service",
+		ConstLabels: constLabels,
+	}, []string{"object"})
+	participantsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "autoscaler_service_participants",
+		Help:        "The number of participants on a scaled object, for the conferencing services",
+		ConstLabels: constLabels,
+	}, []string{"object"})
+	metrics := []prometheus.Collector{errorsTotalCounter, loadScoreGauge, participantsGauge}
 	for _, metric := range metrics {
 		if err := prometheus.Register(metric); err != nil {
 			return err
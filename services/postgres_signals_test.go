@@ -0,0 +1,158 @@
+package services
+
+import (
+	"net/url"
+	"os"
+	s "scaler/shared"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestValidatePostgresDatabaseConfig(t *testing.T) {
+	s.ValidatePass(t, &PostgresDatabaseConfig{User: "scaler", MaxConnectionsUsage: 0.8, MinCacheHitRatio: 0.95})
+	s.ValidateFail(t, &PostgresDatabaseConfig{})
+	s.ValidateFail(t, &PostgresDatabaseConfig{User: "scaler", MaxConnectionsUsage: 1.5})
+	s.ValidateFail(t, &PostgresDatabaseConfig{User: "scaler", MaxReplicationLagSeconds: -1})
+}
+
+func TestPostgresDataSourceName(t *testing.T) {
+	config := PostgresDatabaseConfig{User: "scaler", Password: "p@ss word"}
+	cluster := samplePostgresCluster
+	cluster.DnsName = "pg-1234.postgresql.example.com"
+	dsn, err := url.Parse(config.dataSourceName(cluster))
+	if err != nil {
+		t.Fatalf("Failed to parse dsn: %v", err)
+	}
+	password, _ := dsn.User.Password()
+	if dsn.Host != "pg-1234.postgresql.example.com:5432" || password != "p@ss word" || dsn.Path != "/postgres" || dsn.Query().Get("sslmode") != "require" {
+		t.Fatalf("Unexpected dsn %s", dsn)
+	}
+}
+
+func TestCacheHitRatio(t *testing.T) {
+	previous := postgresBlockStats{hits: 1000, reads: 100}
+	if ratio := cacheHitRatio(previous, postgresBlockStats{hits: 1090, reads: 110}); ratio != 0.9 {
+		t.Fatalf("Expected ratio to be 0.9 but got %f", ratio)
+	}
+	if ratio := cacheHitRatio(previous, previous); ratio != 1 {
+		t.Fatalf("Expected ratio to be 1 without block access but got %f", ratio)
+	}
+	// Statistics reset
+	if ratio := cacheHitRatio(previous, postgresBlockStats{hits: 3, reads: 1}); ratio != 0.75 {
+		t.Fatalf("Expected ratio to be 0.75 after a reset but got %f", ratio)
+	}
+}
+
+func testPostgresApplyDatabaseRules(t *testing.T, signals PostgresSignals) s.ResourceScalingProposal {
+	postgresConfig := *validPostgresConfig
+	postgresConfig.Resources.Cpu = &s.CpuResources{MinCores: 2, MaxCores: 4, MinUsage: 0.1, MaxUsage: 0.5}
+	postgresConfig.Database = &PostgresDatabaseConfig{
+		User:                     "scaler",
+		MaxConnectionsUsage:      0.8,
+		MinCacheHitRatio:         0.9,
+		MaxReplicationLagSeconds: 30,
+	}
+	postgresService := PostgresService{Config: postgresConfig}
+
+	cluster := samplePostgresCluster
+	cluster.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.3}
+	cluster.ResourceState.Memory = &s.MemoryResourceState{CurrentBytes: 2048, CurrentUsage: 0.3}
+	proposal := postgresService.computeScalingProposalInternal(cluster)
+	return postgresService.applyDatabaseRules(cluster, proposal, signals)
+}
+
+// Check that healthy database signals do not change the proposal
+func TestPostgresDatabaseRulesDefault(t *testing.T) {
+	proposal := testPostgresApplyDatabaseRules(t, PostgresSignals{ConnectionsUsage: 0.5, CacheHitRatio: 0.99})
+	if proposal.Cpu.Direction != s.ScaleNone || proposal.Mem.Direction != s.ScaleNone {
+		t.Fatalf("Expected no scaling but got %+v", proposal)
+	}
+}
+
+// Check that a cluster running out of connections gets more memory
+func TestPostgresDatabaseRulesRule5(t *testing.T) {
+	proposal := testPostgresApplyDatabaseRules(t, PostgresSignals{ConnectionsUsage: 1, CacheHitRatio: 0.99})
+	if proposal.Mem.Direction != s.ScaleUp || proposal.Mem.Amount != 410 {
+		t.Fatalf("Expected memory scale up by 410 but got %+v", proposal.Mem)
+	}
+}
+
+// Check that a cluster with a low cache hit ratio gets more memory
+func TestPostgresDatabaseRulesRule6(t *testing.T) {
+	proposal := testPostgresApplyDatabaseRules(t, PostgresSignals{ConnectionsUsage: 0.5, CacheHitRatio: 0.45})
+	if proposal.Mem.Direction != s.ScaleUp || proposal.Mem.Amount != 1024 {
+		t.Fatalf("Expected memory scale up by 1024 but got %+v", proposal.Mem)
+	}
+}
+
+// Check that a cluster with lagging replicas gets more CPU
+func TestPostgresDatabaseRulesRule7(t *testing.T) {
+	proposal := testPostgresApplyDatabaseRules(t, PostgresSignals{ConnectionsUsage: 0.5, CacheHitRatio: 0.99, ReplicationLagSeconds: 60})
+	if proposal.Cpu.Direction != s.ScaleUp || proposal.Cpu.Amount != 1 {
+		t.Fatalf("Expected CPU scale up by 1 but got %+v", proposal.Cpu)
+	}
+}
+
+// Check that the usage based proposal is kept when the database can not be reached
+func TestPostgresDatabaseUnreachable(t *testing.T) {
+	postgresConfig := *validPostgresConfig
+	postgresConfig.Resources.Cpu = &s.CpuResources{MinCores: 2, MaxCores: 4, MinUsage: 0.1, MaxUsage: 0.5}
+	postgresConfig.Database = &PostgresDatabaseConfig{Host: "127.0.0.1", Port: 1, User: "scaler", SslMode: "disable", MaxConnectionsUsage: 0.8}
+	postgresService := PostgresService{Config: postgresConfig, databases: newPostgresDatabases(*postgresConfig.Database)}
+	errorsTotalCounter = prometheus.NewCounter(prometheus.CounterOpts{Name: "test_errors_total"})
+
+	cluster := samplePostgresCluster
+	cluster.Ready = true
+	cluster.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.9}
+	cluster.ResourceState.Memory = &s.MemoryResourceState{CurrentBytes: 2048, CurrentUsage: 0.3}
+	proposal, err := postgresService.ComputeScalingProposal(&cluster)
+	if err != nil {
+		t.Fatalf("ComputeScalingProposal() failed: %v", err)
+	}
+	if proposal.Cpu.Direction != s.ScaleUp {
+		t.Fatalf("Expected CPU scale up but got %+v", proposal.Cpu)
+	}
+}
+
+// Check that the pools of clusters that are not scaled anymore are closed
+func TestPostgresCloseUnused(t *testing.T) {
+	databases := newPostgresDatabases(PostgresDatabaseConfig{User: "scaler"})
+	if _, err := databases.get(samplePostgresCluster); err != nil {
+		t.Fatalf("Failed to open pool: %v", err)
+	}
+	databases.closeUnused(time.Now(), time.Minute)
+	if len(databases.databases) != 1 {
+		t.Fatalf("Expected pool to be kept but got %d pools", len(databases.databases))
+	}
+	databases.closeUnused(time.Now().Add(2*time.Minute), time.Minute)
+	if len(databases.databases) != 0 || len(databases.lastUsed) != 0 {
+		t.Fatalf("Expected pool to be closed but got %d pools", len(databases.databases))
+	}
+}
+
+// Reads the signals from a local Postgres, for example started with
+// docker run -e POSTGRES_PASSWORD=postgres -p 5432:5432 postgres
+func TestPostgresGetSignals(t *testing.T) {
+	host := os.Getenv("POSTGRES_TEST_HOST")
+	if host == "" {
+		t.Skip("POSTGRES_TEST_HOST is not set")
+	}
+	databases := newPostgresDatabases(PostgresDatabaseConfig{
+		Host:     host,
+		User:     s.StringFromEnv(os.Getenv("POSTGRES_TEST_USER")),
+		Password: s.StringFromEnv(os.Getenv("POSTGRES_TEST_PASSWORD")),
+		SslMode:  "disable",
+	})
+	signals, err := databases.GetSignals(samplePostgresCluster)
+	if err != nil {
+		t.Fatalf("Failed to get signals: %v", err)
+	}
+	if signals.ConnectionsUsage <= 0 || signals.ConnectionsUsage > 1 {
+		t.Fatalf("Unexpected connections usage %f", signals.ConnectionsUsage)
+	}
+	if signals.CacheHitRatio < 0 || signals.CacheHitRatio > 1 {
+		t.Fatalf("Unexpected cache hit ratio %f", signals.CacheHitRatio)
+	}
+}
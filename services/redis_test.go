@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	s "scaler/shared"
+	"strings"
+	"testing"
+)
+
+var validRedisConfig = RedisServiceConfig{
+	CycleTimeSeconds: 60,
+	Resources: s.Resources{
+		Cpu: &s.CpuResources{
+			MinCores: 1,
+			MaxCores: 4,
+			MinUsage: 0.2,
+			MaxUsage: 0.7,
+		},
+		Memory: &s.MemoryResources{
+			MinBytes: 2048,
+			MaxBytes: 16384,
+			MinUsage: 0.2,
+			MaxUsage: 0.8,
+		},
+	},
+}
+
+func TestValidateRedisConfig(t *testing.T) {
+	s.ValidatePass(t, validRedisConfig)
+	s.ValidateFail(t, RedisServiceConfig{})
+	config := validRedisConfig
+	config.Username = "scaler"
+	s.ValidateFail(t, config)
+}
+
+func TestParseRedisConfigOK(t *testing.T) {
+	os.Setenv("REDIS_PASSWORD", "1234567890")
+	defer os.Unsetenv("REDIS_PASSWORD")
+
+	config, err := s.OpenConfig("test_files/redis_config_ok.yml")
+	if err != nil {
+		t.Fatalf("Failed to open config: %v", err)
+	}
+	c, err := s.LoadConfig[RedisService](config)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if c.Config.Password != "1234567890" {
+		t.Fatalf("Expected password from environment but got %s", c.Config.Password)
+	}
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	raw, err := os.ReadFile("test_files/redis_info.txt")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	info, err := parseRedisInfo(strings.ReplaceAll(string(raw), "\n", "\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse info: %v", err)
+	}
+	expected := RedisInfo{UsedMemory: 3221225472, MaxMemory: 4294967296, ConnectedClients: 42, EvictedKeys: 17}
+	if info != expected {
+		t.Fatalf("Expected %+v but got %+v", expected, info)
+	}
+	if _, err := parseRedisInfo("# Memory\r\nused_memory:1\r\n"); err == nil {
+		t.Fatalf("Expected error but got nil")
+	}
+}
+
+// Fake Redis answering AUTH and INFO on a local port
+func TestRedisGetInfo(t *testing.T) {
+	raw, err := os.ReadFile("test_files/redis_info.txt")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// Each command is an array of bulk strings, only the command name matters here
+			header, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var argc int
+			fmt.Sscanf(header, "*%d", &argc)
+			var args []string
+			for i := 0; i < argc; i++ {
+				reader.ReadString('\n')
+				arg, _ := reader.ReadString('\n')
+				args = append(args, strings.TrimSpace(arg))
+			}
+			switch {
+			case args[0] == "AUTH" && args[1] == "secret":
+				conn.Write([]byte("+OK\r\n"))
+			case args[0] == "AUTH":
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			case args[0] == "INFO":
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(raw), raw)
+			}
+		}
+	}()
+
+	redis := RedisService{Config: validRedisConfig}
+	redis.Config.Password = "secret"
+	info, err := redis.GetInfo(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to get info: %v", err)
+	}
+	if info.ConnectedClients != 42 {
+		t.Fatalf("Expected 42 connected clients but got %d", info.ConnectedClients)
+	}
+}
+
+func testRedisApplyRulesMemory(t *testing.T, resourceState s.MemoryResourceState, info RedisInfo, evicting bool, expected s.ScaleDirection) s.ResourceScalingProposal {
+	redis := RedisService{Config: validRedisConfig}
+	server := sampleBBBServer
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.5}
+	server.ResourceState.Memory = &resourceState
+
+	proposal := redis.computeScalingProposalInternal(server, info, evicting)
+	if proposal.Mem.Direction != expected {
+		t.Fatalf("Expected memory scale direction to be %s but got %s", expected, proposal.Mem.Direction)
+	}
+	return proposal
+}
+
+// Check that used_memory close to maxmemory scales up even if the server memory usage is low
+func TestRedisApplyRulesRule2MaxMemory(t *testing.T) {
+	info := RedisInfo{UsedMemory: 3900 << 20, MaxMemory: 4096 << 20}
+	testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 4096, CurrentUsage: 0.5}, info, false, s.ScaleUp)
+}
+
+// Check that a server with low memory usage is scaled down
+func TestRedisApplyRulesRule4(t *testing.T) {
+	info := RedisInfo{UsedMemory: 512 << 20}
+	proposal := testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 8192, CurrentUsage: 0.1}, info, false, s.ScaleDown)
+	if proposal.Mem.Amount != -4096 {
+		t.Fatalf("Expected memory amount to be -4096 but got %d", proposal.Mem.Amount)
+	}
+}
+
+// Check that memory is not scaled down below the memory used by Redis
+func TestRedisApplyRulesRule4UsedMemory(t *testing.T) {
+	info := RedisInfo{UsedMemory: 6000 << 20}
+	proposal := testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 8192, CurrentUsage: 0.1}, info, false, s.ScaleDown)
+	if proposal.Mem.Amount != -2192 {
+		t.Fatalf("Expected memory amount to be -2192 but got %d", proposal.Mem.Amount)
+	}
+	info = RedisInfo{UsedMemory: 8192 << 20}
+	testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 8192, CurrentUsage: 0.1}, info, false, s.ScaleNone)
+}
+
+// Check that evictions scale memory up
+func TestRedisApplyRulesRule5(t *testing.T) {
+	info := RedisInfo{UsedMemory: 2048 << 20}
+	proposal := testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 4096, CurrentUsage: 0.5}, info, true, s.ScaleUp)
+	if proposal.Mem.Amount != 1024 {
+		t.Fatalf("Expected memory amount to be 1024 but got %d", proposal.Mem.Amount)
+	}
+}
+
+// Check that a server with normal usage is not scaled
+func TestRedisApplyRulesDefault(t *testing.T) {
+	info := RedisInfo{UsedMemory: 2048 << 20, MaxMemory: 4096 << 20}
+	testRedisApplyRulesMemory(t, s.MemoryResourceState{CurrentBytes: 4096, CurrentUsage: 0.5}, info, false, s.ScaleNone)
+}
+
+// Check that the direct scaling step never takes memory below the memory used by Redis
+func TestRedisApplyRulesDirectScalingUsedMemory(t *testing.T) {
+	info := RedisInfo{UsedMemory: 7500 << 20}
+	state := s.MemoryResourceState{CurrentBytes: 8192, CurrentUsage: 0.1}
+
+	redis := RedisService{Config: validRedisConfig, ScalingMode: s.DirectScaling}
+	server := sampleBBBServer
+	server.ResourceState.Cpu = &s.CpuResourceState{CurrentCores: 2, CurrentUsage: 0.5}
+	server.ResourceState.Memory = &state
+	proposal := redis.ScalingMode.Override(redis.computeScalingProposalInternal(server, info, false))
+	if proposal.Mem.Direction != s.ScaleNone || proposal.Mem.Amount != 0 {
+		t.Fatalf("Expected no memory scaling but got %+v", proposal.Mem)
+	}
+
+	// The step of 1024 is above the used memory
+	info = RedisInfo{UsedMemory: 6000 << 20}
+	proposal = redis.ScalingMode.Override(redis.computeScalingProposalInternal(server, info, false))
+	if proposal.Mem.Direction != s.ScaleDown || server.ResourceState.Memory.CurrentBytes+proposal.Mem.Amount < 6000 {
+		t.Fatalf("Expected memory scale down above the used memory but got %+v", proposal.Mem)
+	}
+
+	// The heuristic amount stops at the used memory
+	redis.ScalingMode = s.HeuristicScaling
+	info = RedisInfo{UsedMemory: 7500 << 20}
+	proposal = redis.ScalingMode.Override(redis.computeScalingProposalInternal(server, info, false))
+	if proposal.Mem.Direction != s.ScaleDown || proposal.Mem.Amount != -692 {
+		t.Fatalf("Expected memory scale down by 692 but got %+v", proposal.Mem)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	s "scaler/shared"
+	"testing"
+)
+
+// Fake Scalelite server API keeping the state of a single BBB server
+func newFakeScalelite(t *testing.T, state *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("checksum") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/scalelite/api/getServers":
+			json.NewEncoder(w).Encode([]scaleliteServer{
+				{Id: "sl-1", Url: "https://bbb.example.com/bigbluebutton/api", State: *state, Online: true},
+			})
+		case "/scalelite/api/updateServer":
+			var request struct {
+				Id     string `json:"id"`
+				Server struct {
+					State string `json:"state"`
+				} `json:"server"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Id != "sl-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*state = request.Server.State
+			w.Write([]byte("{}"))
+		default:
+			t.Errorf("unexpected scalelite call: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestValidateScaleliteConfig(t *testing.T) {
+	s.ValidatePass(t, &ScaleliteConfig{Url: "https://scalelite.example.com", Secret: "secret"})
+	s.ValidateFail(t, &ScaleliteConfig{Url: "https://scalelite.example.com"})
+	s.ValidateFail(t, &ScaleliteConfig{Url: "scalelite.example.com", Secret: "secret"})
+}
+
+// Check that a resize is held back until the server is cordoned and empty, and that it is re-enabled afterwards
+func TestScaleliteDrainBeforeResize(t *testing.T) {
+	state := scaleliteStateEnabled
+	fake := newFakeScalelite(t, &state)
+	defer fake.Close()
+
+	scalelite := newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), false)
+	server := sampleBBBServer
+	scaleDown := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{Direction: s.ScaleDown, Reason: "Default,Rule 3: load at or below threshold", Amount: -1},
+		Mem: s.ScaleOp{Direction: s.ScaleNone, Reason: "Default"},
+	}
+
+	// First cycle cordons the server and holds the resize
+	proposal, err := scalelite.gateResize(server, 0, scaleDown)
+	if err != nil {
+		t.Fatalf("gateResize() failed: %v", err)
+	}
+	if isResize(proposal) || state != scaleliteStateCordoned {
+		t.Fatalf("Expected resize to be held and server cordoned but got %+v and state %s", proposal, state)
+	}
+
+	// A meeting started before the cordon keeps the server from resizing
+	proposal, _ = scalelite.gateResize(server, 3, scaleDown)
+	if isResize(proposal) {
+		t.Fatalf("Expected resize to be held while participants are present")
+	}
+
+	// Once empty, the resize goes through and the server stays cordoned
+	proposal, _ = scalelite.gateResize(server, 0, scaleDown)
+	if !isResize(proposal) || state != scaleliteStateCordoned {
+		t.Fatalf("Expected resize to pass but got %+v and state %s", proposal, state)
+	}
+
+	// Still running with the same resources, the resize has not started yet
+	if err := scalelite.finishResize(server); err != nil {
+		t.Fatalf("finishResize() failed: %v", err)
+	}
+	if state != scaleliteStateCordoned {
+		t.Fatalf("Expected server to stay cordoned until it was resized")
+	}
+
+	// The server is enabled again once it is running after the reboot
+	server.Ready = false
+	scalelite.finishResize(server)
+	if state != scaleliteStateCordoned {
+		t.Fatalf("Expected server to stay cordoned while not ready")
+	}
+	server.Ready = true
+	if err := scalelite.finishResize(server); err != nil {
+		t.Fatalf("finishResize() failed: %v", err)
+	}
+	if state != scaleliteStateEnabled {
+		t.Fatalf("Expected server to be enabled but got %s", state)
+	}
+}
+
+// Check that a cordoned server is enabled again when the resize is not needed anymore
+func TestScaleliteDrainCancelled(t *testing.T) {
+	state := scaleliteStateEnabled
+	fake := newFakeScalelite(t, &state)
+	defer fake.Close()
+
+	scalelite := newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), true)
+	scaleUp := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{Direction: s.ScaleUp, Amount: 1},
+		Mem: s.ScaleOp{Direction: s.ScaleNone},
+	}
+	scalelite.gateResize(sampleBBBServer, 5, scaleUp)
+	if state != scaleliteStateCordoned {
+		t.Fatalf("Expected server to be cordoned but got %s", state)
+	}
+	scalelite.gateResize(sampleBBBServer, 5, holdResize(scaleUp, ""))
+	if state != scaleliteStateEnabled {
+		t.Fatalf("Expected server to be enabled but got %s", state)
+	}
+}
+
+// Check that scale-ups go through without draining unless configured otherwise
+func TestScaleliteScaleUpNotDrained(t *testing.T) {
+	state := scaleliteStateEnabled
+	fake := newFakeScalelite(t, &state)
+	defer fake.Close()
+
+	scalelite := newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), false)
+	scaleUp := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{Direction: s.ScaleUp, Reason: "Default,Rule 2: load above maximum", Amount: 2},
+		Mem: s.ScaleOp{Direction: s.ScaleNone, Reason: "Default"},
+	}
+	proposal, err := scalelite.gateResize(sampleBBBServer, 5, scaleUp)
+	if err != nil {
+		t.Fatalf("gateResize() failed: %v", err)
+	}
+	if proposal != scaleUp || state != scaleliteStateEnabled {
+		t.Fatalf("Expected scale-up to pass without draining but got %+v and state %s", proposal, state)
+	}
+}
+
+// Check that a server is enabled again when its resize was dropped on the way to the provider
+func TestScaleliteResizeDropped(t *testing.T) {
+	state := scaleliteStateEnabled
+	fake := newFakeScalelite(t, &state)
+	defer fake.Close()
+
+	scalelite := newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), false)
+	scaleDown := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{Direction: s.ScaleDown, Amount: -1},
+		Mem: s.ScaleOp{Direction: s.ScaleNone},
+	}
+	scalelite.gateResize(sampleBBBServer, 0, scaleDown)
+	if proposal, _ := scalelite.gateResize(sampleBBBServer, 0, scaleDown); !isResize(proposal) {
+		t.Fatalf("Expected resize to pass but got %+v", proposal)
+	}
+
+	scalelite.finishResize(sampleBBBServer)
+	scalelite.gateResize(sampleBBBServer, 0, holdResize(scaleDown, ""))
+	if state != scaleliteStateEnabled {
+		t.Fatalf("Expected server to be enabled but got %s", state)
+	}
+}
+
+// Check that a server cordoned before a restart of the scaler is taken over and enabled again
+func TestScaleliteDrainAfterRestart(t *testing.T) {
+	state := scaleliteStateCordoned
+	fake := newFakeScalelite(t, &state)
+	defer fake.Close()
+
+	scalelite := newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), false)
+	scaleDown := s.ResourceScalingProposal{
+		Cpu: s.ScaleOp{Direction: s.ScaleDown, Amount: -1},
+		Mem: s.ScaleOp{Direction: s.ScaleNone},
+	}
+	// The drain of the previous run is over once the server is empty
+	if proposal, err := scalelite.gateResize(sampleBBBServer, 0, scaleDown); err != nil || !isResize(proposal) {
+		t.Fatalf("Expected resize of the drained server to pass but got %+v, %v", proposal, err)
+	}
+
+	// Without a pending resize the server is put back into rotation
+	state = scaleliteStateCordoned
+	scalelite = newResizeGate(newScaleliteClient(ScaleliteConfig{Url: fake.URL, Secret: "secret"}, func(server s.Server) string { return server.ServerName }), false)
+	if _, err := scalelite.gateResize(sampleBBBServer, 3, holdResize(scaleDown, "")); err != nil {
+		t.Fatalf("gateResize() failed: %v", err)
+	}
+	if state != scaleliteStateEnabled {
+		t.Fatalf("Expected server to be enabled but got %s", state)
+	}
+}
@@ -3,13 +3,18 @@ package shared
 import "fmt"
 
 type AppDefinition struct {
-	Name                string            `yaml:"app_name"`
-	Stage               Stage             `yaml:"stage"`
-	ScalingMode         ScalingMode       `yaml:"scaling_mode"`
-	ServiceType         ServiceType       `yaml:"service_type"`
-	ProviderType        ProviderType      `yaml:"provider_type"`
-	MetricsSourceType   MetricsSourceType `yaml:"metrics_source_type"`
-	MetricsExporterPort IntFromEnv        `yaml:"metrics_exporter_port"`
+	Name              string            `yaml:"app_name"`
+	Stage             Stage             `yaml:"stage"`
+	ScalingMode       ScalingMode       `yaml:"scaling_mode"`
+	ServiceType       ServiceType       `yaml:"service_type"`
+	ProviderType      ProviderType      `yaml:"provider_type"`
+	MetricsSourceType MetricsSourceType `yaml:"metrics_source_type"`
+	// Replaces metrics_source_type to read the metrics from several sources
+	MetricsSources      []MetricsSourceDefinition `yaml:"metrics_sources"`
+	MetricsExporterPort IntFromEnv                `yaml:"metrics_exporter_port"`
+	// Optional, manages the DNS records of the scaled servers
+	DNSProviderType DNSProviderType `yaml:"dns_provider_type"`
+	DNSConfig       DNSConfig       `yaml:"dns_config"`
 }
 
 type Stage string
@@ -26,6 +31,39 @@ const (
 	HeuristicScaling = "heuristic"
 )
 
+// Fixed amounts of the direct scaling mode
+// TODO: make these configurable
+var (
+	DirectMemIncrease int32 = 1024
+	DirectMemDecrease int32 = -1024
+	DirectCpuIncrease int32 = 1
+	DirectCpuDecrease int32 = -1
+)
+
+// Replaces the amounts computed by the service with the fixed amounts in direct mode, the directions are kept
+func (mode ScalingMode) Override(proposal ResourceScalingProposal) ResourceScalingProposal {
+	if mode != DirectScaling {
+		return proposal
+	}
+	// Scale up CPU
+	if proposal.Cpu.Direction == ScaleUp {
+		proposal.Cpu.Amount = DirectCpuIncrease
+	}
+	// Scale up RAM
+	if proposal.Mem.Direction == ScaleUp {
+		proposal.Mem.Amount = DirectMemIncrease
+	}
+	// Scale down CPU
+	if proposal.Cpu.Direction == ScaleDown {
+		proposal.Cpu.Amount = DirectCpuDecrease
+	}
+	// Scale down RAM
+	if proposal.Mem.Direction == ScaleDown {
+		proposal.Mem.Amount = DirectMemDecrease
+	}
+	return proposal
+}
+
 func (a AppDefinition) Validate() error {
 	if a.Name == "" {
 		return fmt.Errorf("AppDefinition.Name is empty")
@@ -46,8 +84,29 @@ func (a AppDefinition) Validate() error {
 	if a.ProviderType == "" {
 		return fmt.Errorf("AppDefinition.Type is empty")
 	}
-	if a.MetricsSourceType == "" {
-		return fmt.Errorf("AppDefinition.MetricsSourceType is empty")
+	if a.MetricsSourceType == "" && len(a.MetricsSources) == 0 {
+		return fmt.Errorf("AppDefinition.MetricsSourceType and AppDefinition.MetricsSources are empty")
+	}
+	if a.MetricsSourceType != "" && len(a.MetricsSources) > 0 {
+		return fmt.Errorf("AppDefinition.MetricsSourceType and AppDefinition.MetricsSources are both set")
+	}
+	names := map[string]bool{}
+	for _, source := range a.MetricsSources {
+		if err := source.Validate(); err != nil {
+			return err
+		}
+		if names[source.Name] {
+			return fmt.Errorf("metrics source %s is defined twice", source.Name)
+		}
+		names[source.Name] = true
+	}
+	if a.DNSProviderType != "" {
+		if err := a.DNSProviderType.Validate(); err != nil {
+			return err
+		}
+		if err := a.DNSConfig.Validate(); err != nil {
+			return err
+		}
 	}
 	if a.MetricsExporterPort < 0 || a.MetricsExporterPort > 65535 {
 		return fmt.Errorf("AppDefinition.MetricsExporterPort %d is invalid", a.MetricsExporterPort)
@@ -9,6 +9,7 @@ import (
 type Cluster struct {
 	ClusterId     string `yaml:"cluster_id"`
 	ClusterName   string `yaml:"cluster_name"`
+	DnsName       string `yaml:"dns_name"`
 	ResourceState ResourceState
 	LastUpdated   time.Time `yaml:"last_updated"`
 	Ready         bool      `yaml:"ready"`
@@ -39,8 +40,13 @@ type ClusterSource struct {
 	Static  *ClusterStaticSource  `yaml:"static"`
 }
 
+// Clusters are selected by display name and/or the datacenter they are connected to
+// DBaaS clusters carry no labels themselves, so labels are matched against the connected datacenter
 type ClusterDynamicSource struct {
-	ClusterNameRegex string `yaml:"cluster_name_regex"`
+	ClusterNameRegex        string            `yaml:"cluster_name_regex"`
+	ClusterNameExcludeRegex string            `yaml:"cluster_name_exclude_regex"`
+	DatacenterIds           []string          `yaml:"datacenter_ids"`
+	DatacenterLabels        map[string]string `yaml:"datacenter_labels"`
 }
 
 type ClusterStaticSource struct {
@@ -71,12 +77,23 @@ func (ionos ClusterSource) Validate() error {
 }
 
 func (ionos ClusterDynamicSource) Validate() error {
-	if ionos.ClusterNameRegex == "" {
-		return fmt.Errorf("ionos.cluster_name_regex is empty")
+	if ionos.ClusterNameRegex == "" && len(ionos.DatacenterIds) == 0 && len(ionos.DatacenterLabels) == 0 {
+		return fmt.Errorf("ionos.cluster_name_regex, ionos.datacenter_ids and ionos.datacenter_labels are empty, at least one must be set")
 	}
 	if _, err := regexp.Compile(ionos.ClusterNameRegex); err != nil {
 		return fmt.Errorf("ionos.cluster_name_regex is invalid: %s", err)
 	}
+	if _, err := regexp.Compile(ionos.ClusterNameExcludeRegex); err != nil {
+		return fmt.Errorf("ionos.cluster_name_exclude_regex is invalid: %s", err)
+	}
+	for index, datacenterId := range ionos.DatacenterIds {
+		if datacenterId == "" {
+			return fmt.Errorf("ionos.datacenter_ids[%d] is empty", index)
+		}
+	}
+	if err := validateLabels(ionos.DatacenterLabels); err != nil {
+		return err
+	}
 	return nil
 }
 
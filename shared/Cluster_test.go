@@ -18,6 +18,18 @@ func TestValidateClusterDynamicSourceBadRegex(t *testing.T) {
 	ValidateFail(t, clusterSource)
 }
 
+func TestValidateClusterDynamicSourceDatacenterLabelsOK(t *testing.T) {
+	clusterSource := &ClusterDynamicSource{
+		DatacenterLabels: map[string]string{"env": "prod"},
+	}
+	ValidatePass(t, clusterSource)
+}
+
+func TestValidateClusterDynamicSourceNoSelector(t *testing.T) {
+	clusterSource := &ClusterDynamicSource{}
+	ValidateFail(t, clusterSource)
+}
+
 func TestValidateClusterStaticSourceOK(t *testing.T) {
 	clusterSource := &ClusterStaticSource{
 		ClusterIds: []string{"123"},
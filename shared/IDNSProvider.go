@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"text/template"
+)
+
+// Interface to manage the A and AAAA record sets of the scaled servers in a zone
+// Names are relative to the zone of the provider, e.g. bbb-1 for bbb-1.example.com.
+// The TTL and the description of the records are configured per zone
+type DNSProvider interface {
+	Validate() error
+	Init() error
+	// Returns the A and AAAA record sets of the zone
+	ListRecords() ([]DNSRecord, error)
+	// Returns nil if the record set does not exist
+	GetRecord(name string, recordType DNSRecordType) (*DNSRecord, error)
+	// Creates the record set with the description, which marks the records managed by the autoscaler
+	CreateRecord(name string, recordType DNSRecordType, ips []string) error
+	// Replaces the IPs of the record set
+	UpdateRecord(name string, recordType DNSRecordType, ips []string) error
+	DeleteRecord(name string, recordType DNSRecordType) error
+	// Adds an IP to the record set, which is created if it does not exist
+	AddRecordIp(name string, recordType DNSRecordType, ip string) error
+	// Removes an IP from the record set, which is deleted with its last IP
+	RemoveRecordIp(name string, recordType DNSRecordType, ip string) error
+}
+
+type DNSRecord struct {
+	Name        string
+	Type        DNSRecordType
+	Ips         []string
+	Ttl         int
+	Description string
+	// The record carries the description of the zone
+	Managed bool
+}
+
+type DNSRecordType string
+
+const (
+	DNSRecordTypeA    DNSRecordType = "A"
+	DNSRecordTypeAAAA DNSRecordType = "AAAA"
+)
+
+// Returns the record type of an IP, A for IPv4 and AAAA for IPv6
+func DNSRecordTypeOf(ip string) (DNSRecordType, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("%s is not an IP address", ip)
+	}
+	if parsed.To4() != nil {
+		return DNSRecordTypeA, nil
+	}
+	return DNSRecordTypeAAAA, nil
+}
+
+// Checks the IPs match the record type
+func (t DNSRecordType) ValidateIps(ips []string) error {
+	if len(ips) == 0 {
+		return fmt.Errorf("record set without IP")
+	}
+	for _, ip := range ips {
+		ipType, err := DNSRecordTypeOf(ip)
+		if err != nil {
+			return err
+		}
+		if ipType != t {
+			return fmt.Errorf("%s is not valid in a %s record", ip, t)
+		}
+	}
+	return nil
+}
+
+// Default description of the records, which marks the records managed by the autoscaler
+const DNSRecordDescription = "BBB Autoscaler"
+
+const DefaultDNSRecordTtl = 300
+
+// Options shared by the zones of all DNS providers
+type DNSZoneOptions struct {
+	// TTL of the created records in seconds, defaults to 300
+	Ttl int `yaml:"ttl"`
+	// Description of the created records, defaults to BBB Autoscaler
+	// Changing it makes the records created with the previous description unmanaged
+	Description string `yaml:"description"`
+}
+
+func (o DNSZoneOptions) GetTtl() int {
+	if o.Ttl == 0 {
+		return DefaultDNSRecordTtl
+	}
+	return o.Ttl
+}
+
+func (o DNSZoneOptions) GetDescription() string {
+	if o.Description == "" {
+		return DNSRecordDescription
+	}
+	return o.Description
+}
+
+func (o DNSZoneOptions) Validate() error {
+	if o.Ttl < 0 {
+		return fmt.Errorf("ttl %d is invalid", o.Ttl)
+	}
+	return nil
+}
+
+type DNSProviderType string
+
+const (
+	Otc      = "Otc"
+	IonosDns = "IonosDns"
+	Rfc2136  = "Rfc2136"
+)
+
+func (d DNSProviderType) Validate() error {
+	switch d {
+	case Otc, IonosDns, Rfc2136:
+		return nil
+	default:
+		return fmt.Errorf("unknown dns provider type: %s", d)
+	}
+}
+
+type DNSConfig struct {
+	// Go template of the record name with access to the Server fields, defaults to {{ .ServerName }}
+	// The rendered name is lowercased and relative to the zone
+	RecordNameTemplate string `yaml:"record_name_template"`
+	// Logs the changes of each cycle without applying them
+	DryRun bool `yaml:"dry_run"`
+	// Optional, takes servers out of DNS while they are not ready or their health check fails
+	Failover DNSFailoverConfig `yaml:"failover"`
+}
+
+type DNSFailoverConfig struct {
+	// Name of a record holding the IPs of all healthy servers, relative to the zone, e.g. bbb
+	RoundRobinRecord string `yaml:"round_robin_record"`
+	// IPs of a maintenance host the record of an unhealthy server points to until it is healthy again
+	MaintenanceIps []string `yaml:"maintenance_ips"`
+	// Optional HTTP health check, a 2xx response is healthy
+	// Go template of the URL with access to the Server fields and the Ip of the server
+	HealthCheckUrlTemplate string `yaml:"health_check_url_template"`
+	// Defaults to 5
+	HealthCheckTimeoutSeconds int `yaml:"health_check_timeout_seconds"`
+}
+
+// Data of the health check URL template
+type DNSHealthCheckData struct {
+	Server
+	// First IP of the server
+	Ip string
+}
+
+func (c DNSFailoverConfig) Enabled() bool {
+	return c.RoundRobinRecord != "" || len(c.MaintenanceIps) > 0
+}
+
+// Returns nil without health check
+func (c DNSFailoverConfig) ParseHealthCheckUrlTemplate() (*template.Template, error) {
+	if c.HealthCheckUrlTemplate == "" {
+		return nil, nil
+	}
+	parsed, err := template.New("dns_health_check_url").Option("missingkey=error").Parse(c.HealthCheckUrlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("dns_config.failover.health_check_url_template is invalid: %s", err)
+	}
+	// Catches references to unknown fields
+	if err := parsed.Execute(&bytes.Buffer{}, DNSHealthCheckData{}); err != nil {
+		return nil, fmt.Errorf("dns_config.failover.health_check_url_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (c DNSFailoverConfig) Validate() error {
+	if !c.Enabled() {
+		if c.HealthCheckUrlTemplate != "" {
+			return fmt.Errorf("dns_config.failover needs a round_robin_record or maintenance_ips")
+		}
+		return nil
+	}
+	for _, ip := range c.MaintenanceIps {
+		if _, err := DNSRecordTypeOf(ip); err != nil {
+			return fmt.Errorf("dns_config.failover.maintenance_ips is invalid: %s", err)
+		}
+	}
+	if c.HealthCheckTimeoutSeconds < 0 {
+		return fmt.Errorf("dns_config.failover.health_check_timeout_seconds %d is invalid", c.HealthCheckTimeoutSeconds)
+	}
+	_, err := c.ParseHealthCheckUrlTemplate()
+	return err
+}
+
+const defaultDNSRecordNameTemplate = "{{ .ServerName }}"
+
+func (c DNSConfig) ParseRecordNameTemplate() (*template.Template, error) {
+	recordNameTemplate := c.RecordNameTemplate
+	if recordNameTemplate == "" {
+		recordNameTemplate = defaultDNSRecordNameTemplate
+	}
+	parsed, err := template.New("dns_record_name").Option("missingkey=error").Parse(recordNameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("dns_config.record_name_template is invalid: %s", err)
+	}
+	// Catches references to unknown fields
+	if err := parsed.Execute(&bytes.Buffer{}, Server{}); err != nil {
+		return nil, fmt.Errorf("dns_config.record_name_template is invalid: %s", err)
+	}
+	return parsed, nil
+}
+
+func (c DNSConfig) Validate() error {
+	if _, err := c.ParseRecordNameTemplate(); err != nil {
+		return err
+	}
+	return c.Failover.Validate()
+}
@@ -0,0 +1,31 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestValidateDNSConfig(t *testing.T) {
+	ValidatePass(t, DNSConfig{})
+	ValidatePass(t, DNSConfig{RecordNameTemplate: "{{ .ServerName }}-{{ .DatacenterId }}"})
+	ValidateFail(t, DNSConfig{RecordNameTemplate: "{{ .Unknown }}"})
+	ValidatePass(t, DNSConfig{Failover: DNSFailoverConfig{RoundRobinRecord: "bbb", HealthCheckUrlTemplate: "https://{{ .Ip }}/bigbluebutton/api"}})
+	ValidatePass(t, DNSConfig{Failover: DNSFailoverConfig{MaintenanceIps: []string{"10.0.0.250", "fd00::250"}, HealthCheckTimeoutSeconds: 2}})
+	ValidateFail(t, DNSConfig{Failover: DNSFailoverConfig{HealthCheckUrlTemplate: "https://{{ .Ip }}/"}})
+	ValidateFail(t, DNSConfig{Failover: DNSFailoverConfig{MaintenanceIps: []string{"maintenance.example.com"}}})
+	ValidateFail(t, DNSConfig{Failover: DNSFailoverConfig{RoundRobinRecord: "bbb", HealthCheckUrlTemplate: "https://{{ .Host }}/"}})
+	ValidateFail(t, DNSConfig{Failover: DNSFailoverConfig{RoundRobinRecord: "bbb", HealthCheckTimeoutSeconds: -1}})
+}
+
+func TestDNSRecordTypeOf(t *testing.T) {
+	for ip, expected := range map[string]DNSRecordType{"10.0.0.1": DNSRecordTypeA, "fd00::1": DNSRecordTypeAAAA, "::ffff:10.0.0.1": DNSRecordTypeA} {
+		if recordType, err := DNSRecordTypeOf(ip); err != nil || recordType != expected {
+			t.Errorf("Expected %s for %s but got %s, %v", expected, ip, recordType, err)
+		}
+	}
+	if _, err := DNSRecordTypeOf("bbb-1"); err == nil {
+		t.Errorf("Expected error for a name")
+	}
+	if err := DNSRecordTypeA.ValidateIps([]string{"10.0.0.1", "fd00::1"}); err == nil {
+		t.Errorf("Expected error for an IPv6 address in an A record")
+	}
+}
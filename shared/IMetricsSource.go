@@ -1,6 +1,9 @@
 package shared
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
 
 // Interface to get the metrics for a scaled object
 type MetricsSource interface {
@@ -9,17 +12,70 @@ type MetricsSource interface {
 	GetMemoryUsage(ScaledObject) (float32, error)
 }
 
+// Returned when a reading is missing, stale or out of range
+// The object is skipped for the cycle instead of being scaled on bad data
+type InvalidReadingError struct {
+	Reason string
+}
+
+func (e *InvalidReadingError) Error() string {
+	return "invalid reading: " + e.Reason
+}
+
 type MetricsSourceType string
 
 const (
-	Prometheus = "Prometheus"
+	Prometheus      = "Prometheus"
+	IonosMonitoring = "IonosMonitoring"
+	Replay          = "Replay"
+	Otlp            = "Otlp"
+	InfluxDB        = "InfluxDB"
+	NodeExporter    = "NodeExporter"
 )
 
 func (m MetricsSourceType) Validate() error {
 	switch m {
-	case Prometheus:
+	case Prometheus, IonosMonitoring, Replay, Otlp, InfluxDB, NodeExporter:
 		return nil
 	default:
 		return fmt.Errorf("unknown metrics type: %s", m)
 	}
 }
+
+// One of several metrics sources, the sources routed to an object are tried in order until one answers
+// The remaining keys hold the config of the source, laid out like the top level config of its type
+type MetricsSourceDefinition struct {
+	Name       string                 `yaml:"name"`
+	Type       MetricsSourceType      `yaml:"type"`
+	ObjectType ScaledObjectType       `yaml:"object_type"`
+	NameRegex  string                 `yaml:"name_regex"`
+	Config     map[string]interface{} `yaml:",inline"`
+}
+
+// Checks whether the source is routed to the object, an empty routing rule matches every object
+func (m MetricsSourceDefinition) Matches(object ScaledObject) bool {
+	if m.ObjectType != "" && m.ObjectType != object.GetType() {
+		return false
+	}
+	if m.NameRegex != "" {
+		matched, err := regexp.MatchString(m.NameRegex, object.GetName())
+		return err == nil && matched
+	}
+	return true
+}
+
+func (m MetricsSourceDefinition) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("metrics_sources.name is empty")
+	}
+	if err := m.Type.Validate(); err != nil {
+		return fmt.Errorf("metrics source %s is invalid: %s", m.Name, err)
+	}
+	if m.ObjectType != "" && m.ObjectType != ServerType && m.ObjectType != ClusterType {
+		return fmt.Errorf("metrics source %s has an unknown object_type: %s", m.Name, m.ObjectType)
+	}
+	if _, err := regexp.Compile(m.NameRegex); err != nil {
+		return fmt.Errorf("metrics source %s has an invalid name_regex: %s", m.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package shared
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseMetricsSources(t *testing.T) {
+	raw := `
+app_name: scaler
+stage: prod
+scaling_mode: heuristic
+service_type: Postgres
+provider_type: Ionos
+metrics_sources:
+  - name: telemetry
+    type: Prometheus
+    object_type: Cluster
+    prometheus_config:
+      url: https://api.ionos.com/telemetry/
+  - name: own
+    type: Prometheus
+    name_regex: ^bbb-
+    prometheus_config:
+      url: https://prometheus.example.com
+`
+	app, err := LoadConfig[AppDefinition]([]byte(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if len(app.MetricsSources) != 2 {
+		t.Fatalf("Expected 2 metrics sources but got %d", len(app.MetricsSources))
+	}
+	config, err := yaml.Marshal(app.MetricsSources[0].Config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	expected := "prometheus_config:\n    url: https://api.ionos.com/telemetry/\n"
+	if string(config) != expected {
+		t.Fatalf("Expected config %q but got %q", expected, config)
+	}
+}
+
+func TestMetricsSourceDefinitionMatches(t *testing.T) {
+	server := &Server{ServerName: "bbb-1"}
+	cluster := &Cluster{ClusterName: "pg-1"}
+	tests := []struct {
+		definition MetricsSourceDefinition
+		object     ScaledObject
+		expected   bool
+	}{
+		{MetricsSourceDefinition{}, server, true},
+		{MetricsSourceDefinition{ObjectType: ClusterType}, server, false},
+		{MetricsSourceDefinition{ObjectType: ClusterType}, cluster, true},
+		{MetricsSourceDefinition{NameRegex: "^bbb-"}, server, true},
+		{MetricsSourceDefinition{NameRegex: "^bbb-"}, cluster, false},
+	}
+	for _, test := range tests {
+		if got := test.definition.Matches(test.object); got != test.expected {
+			t.Errorf("Expected %t for %+v and %s but got %t", test.expected, test.definition, test.object.GetName(), got)
+		}
+	}
+}
+
+func TestValidateMetricsSources(t *testing.T) {
+	app := AppDefinition{
+		Name:         "scaler",
+		Stage:        ProdStage,
+		ScalingMode:  HeuristicScaling,
+		ServiceType:  Postgres,
+		ProviderType: Ionos,
+		MetricsSources: []MetricsSourceDefinition{
+			{Name: "telemetry", Type: Prometheus, ObjectType: ClusterType},
+		},
+	}
+	ValidatePass(t, app)
+	app.MetricsSourceType = Prometheus
+	ValidateFail(t, app)
+	app.MetricsSourceType = ""
+	app.MetricsSources = append(app.MetricsSources, MetricsSourceDefinition{Name: "telemetry", Type: Prometheus})
+	ValidateFail(t, app)
+	app.MetricsSources = []MetricsSourceDefinition{{Name: "own", Type: Prometheus, NameRegex: "("}}
+	ValidateFail(t, app)
+	app.MetricsSources = []MetricsSourceDefinition{{Name: "own", Type: Prometheus, ObjectType: "Volume"}}
+	ValidateFail(t, app)
+}
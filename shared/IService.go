@@ -9,9 +9,17 @@ type Service interface {
 	ComputeScalingProposal(ScaledObject) (ResourceScalingProposal, error)
 }
 
+// Optionally implemented by services that act on an object once its resize was sent to the provider
+type UpdateListener interface {
+	ScaledObjectUpdated(ScaledObject, ResourceScalingProposal) error
+}
+
 type ServiceType string
 
 const (
 	BBB      = "BBB"
 	Postgres = "Postgres"
+	Redis    = "Redis"
+	Jitsi    = "Jitsi"
+	Generic  = "Generic"
 )
@@ -0,0 +1,21 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Ionos label keys may contain alphanumerics, dashes, underscores and dots
+var labelKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if !labelKeyRegex.MatchString(key) {
+			return fmt.Errorf("label key %q is invalid", key)
+		}
+		if value == "" {
+			return fmt.Errorf("label %s has an empty value", key)
+		}
+	}
+	return nil
+}
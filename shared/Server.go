@@ -12,6 +12,7 @@ type Server struct {
 	ServerName      string
 	CpuArchitecture string
 	ResourceState   ResourceState
+	Ips             []string
 	LastUpdated     time.Time
 	Ready           bool
 }
@@ -41,9 +42,13 @@ type ServerSource struct {
 	Dynamic *ServerDynamicSource `yaml:"dynamic"`
 }
 
+// Servers are selected by name and/or Ionos labels
+// If no datacenter IDs are given, all datacenters of the contract are searched
 type ServerDynamicSource struct {
-	DatacenterIds   []string `yaml:"datacenter_ids"`
-	ServerNameRegex string   `yaml:"server_name_regex"`
+	DatacenterIds          []string          `yaml:"datacenter_ids"`
+	ServerNameRegex        string            `yaml:"server_name_regex"`
+	ServerNameExcludeRegex string            `yaml:"server_name_exclude_regex"`
+	Labels                 map[string]string `yaml:"labels"`
 }
 
 type ServerStaticSource []struct {
@@ -75,15 +80,23 @@ func (ionos ServerSource) Validate() error {
 }
 
 func (ionos ServerDynamicSource) Validate() error {
-	if len(ionos.DatacenterIds) == 0 {
-		return fmt.Errorf("ionos.datacenter_ids is empty")
+	for index, datacenterId := range ionos.DatacenterIds {
+		if datacenterId == "" {
+			return fmt.Errorf("ionos.datacenter_ids[%d] is empty", index)
+		}
 	}
-	if ionos.ServerNameRegex == "" {
-		return fmt.Errorf("ionos.server_name_regex is empty")
+	if ionos.ServerNameRegex == "" && len(ionos.Labels) == 0 {
+		return fmt.Errorf("ionos.server_name_regex and ionos.labels are empty, at least one must be set")
 	}
 	if _, err := regexp.Compile(ionos.ServerNameRegex); err != nil {
 		return fmt.Errorf("ionos.server_name_regex is invalid: %s", err)
 	}
+	if _, err := regexp.Compile(ionos.ServerNameExcludeRegex); err != nil {
+		return fmt.Errorf("ionos.server_name_exclude_regex is invalid: %s", err)
+	}
+	if err := validateLabels(ionos.Labels); err != nil {
+		return err
+	}
 	return nil
 }
 
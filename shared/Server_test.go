@@ -12,11 +12,43 @@ func TestValidateServerDynamicSourceOK(t *testing.T) {
 	ValidatePass(t, serverSource)
 }
 
+// All datacenters of the contract are searched when no datacenter IDs are given
 func TestValidateServerDynamicSourceEmptyDatacenterIds(t *testing.T) {
 	serverSource := &ServerDynamicSource{
 		DatacenterIds:   []string{},
 		ServerNameRegex: ".*",
 	}
+	ValidatePass(t, serverSource)
+}
+
+func TestValidateServerDynamicSourceLabelsOK(t *testing.T) {
+	serverSource := &ServerDynamicSource{
+		Labels: map[string]string{"role": "bbb", "env": "prod"},
+	}
+	ValidatePass(t, serverSource)
+}
+
+func TestValidateServerDynamicSourceBadLabels(t *testing.T) {
+	serverSource := &ServerDynamicSource{
+		Labels: map[string]string{"role": ""},
+	}
+	ValidateFail(t, serverSource)
+	serverSource.Labels = map[string]string{"ro le": "bbb"}
+	ValidateFail(t, serverSource)
+}
+
+func TestValidateServerDynamicSourceNoSelector(t *testing.T) {
+	serverSource := &ServerDynamicSource{
+		DatacenterIds: []string{"123"},
+	}
+	ValidateFail(t, serverSource)
+}
+
+func TestValidateServerDynamicSourceBadExcludeRegex(t *testing.T) {
+	serverSource := &ServerDynamicSource{
+		ServerNameRegex:        ".*",
+		ServerNameExcludeRegex: "*",
+	}
 	ValidateFail(t, serverSource)
 }
 